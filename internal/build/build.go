@@ -0,0 +1,318 @@
+// Package build prepares the context of an image built from a Dockerfile: it
+// selects the files honoring .dockerignore, hashes them to tag the image, and
+// writes them as the tar stream sent to the runtime.
+package build
+
+import (
+	"archive/tar"
+	"cderun/internal/container"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// entry is a file, directory or symlink of the build context.
+type entry struct {
+	rel  string // Slash-separated path relative to the context
+	path string // Path on the host
+	info fs.FileInfo
+}
+
+// Hash returns a hex digest of everything that affects the built image: the
+// content and mode of the context files, the Dockerfile, build args and target.
+// Modification times are ignored, so a fresh checkout produces the same hash.
+// They only tell which files of the context have to be read again, see
+// hashCache.
+func Hash(spec *container.BuildSpec) (string, error) {
+	h := sha256.New()
+	if spec.Inline != "" {
+		fmt.Fprintf(h, "inline\x00%s\x00target=%s\x00", spec.Inline, spec.Target)
+		writeArgs(h, spec.Args)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	entries, err := contextEntries(spec)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(h, "dockerfile=%s\x00target=%s\x00", spec.Dockerfile, spec.Target)
+	writeArgs(h, spec.Args)
+
+	cache := loadHashCache(spec.Context)
+
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\x00%o\x00", e.rel, e.info.Mode())
+		switch {
+		case e.info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read build context: %w", err)
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+		case e.info.Mode().IsRegular():
+			digest, err := cache.digest(e)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s\x00", digest)
+		}
+	}
+	cache.save()
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// racyWindow is how long after its modification a file may still change
+// without a new modification time, on file systems with coarse timestamps.
+const racyWindow = 2 * time.Second
+
+// cachedFile is the digest of a context file with its size and modification
+// time when it was read.
+type cachedFile struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Digest  string `json:"digest"`
+}
+
+// hashCache remembers the digests of the files of a build context, so unchanged
+// files of large contexts are not read on every run. A file is read again when
+// its size or modification time changes.
+type hashCache struct {
+	path    string // Empty if the cache directory is unavailable
+	files   map[string]cachedFile
+	used    map[string]cachedFile
+	changed bool
+}
+
+// loadHashCache reads the cache of the context. The cache is only an
+// optimization, so it starts empty when it cannot be read.
+func loadHashCache(context string) *hashCache {
+	c := &hashCache{files: map[string]cachedFile{}, used: map[string]cachedFile{}}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return c
+	}
+	sum := sha256.Sum256([]byte(context))
+	c.path = filepath.Join(dir, "cderun", "build", hex.EncodeToString(sum[:8])+".json")
+	if data, err := os.ReadFile(c.path); err == nil {
+		_ = json.Unmarshal(data, &c.files)
+	}
+	return c
+}
+
+// digest returns the hex digest of the content of a regular file.
+func (c *hashCache) digest(e entry) (string, error) {
+	f := cachedFile{Size: e.info.Size(), ModTime: e.info.ModTime().UnixNano()}
+	if cached, ok := c.files[e.rel]; ok && cached.Size == f.Size && cached.ModTime == f.ModTime {
+		c.used[e.rel] = cached
+		return cached.Digest, nil
+	}
+
+	h := sha256.New()
+	if err := copyFile(h, e.path); err != nil {
+		return "", err
+	}
+	f.Digest = hex.EncodeToString(h.Sum(nil))
+	c.changed = true
+	if time.Since(e.info.ModTime()) > racyWindow {
+		c.used[e.rel] = f
+	}
+	return f.Digest, nil
+}
+
+// save writes the digests used by this run, dropping files that are gone.
+func (c *hashCache) save() {
+	if c.path == "" || !c.changed && len(c.used) == len(c.files) {
+		return
+	}
+	data, err := json.Marshal(c.used)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return
+	}
+	// Renamed into place, so concurrent runs never read a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".hash-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+func writeArgs(w io.Writer, args map[string]string) {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "arg=%s=%s\x00", k, args[k])
+	}
+}
+
+// Tar writes the build context as a tar stream. For an inline Dockerfile, the
+// stream only contains the Dockerfile.
+func Tar(spec *container.BuildSpec, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	if spec.Inline != "" {
+		hdr := &tar.Header{Name: spec.Dockerfile, Mode: 0644, Size: int64(len(spec.Inline)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, spec.Inline); err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+
+	entries, err := contextEntries(spec)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		var link string
+		if e.info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(e.path); err != nil {
+				return fmt.Errorf("failed to read build context: %w", err)
+			}
+		}
+		hdr, err := tar.FileInfoHeader(e.info, link)
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %w", e.rel, err)
+		}
+		hdr.Name = e.rel
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+		// Files are owned by root in the image, like with "docker build"
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if e.info.Mode().IsRegular() {
+			if err := copyFile(tw, e.path); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read build context: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to read build context: %w", err)
+	}
+	return nil
+}
+
+// contextEntries lists the context in a stable order, without the files excluded
+// by .dockerignore. The Dockerfile is always included.
+func contextEntries(spec *container.BuildSpec) ([]entry, error) {
+	dockerfile := path.Clean(filepath.ToSlash(spec.Dockerfile))
+	if filepath.IsAbs(spec.Dockerfile) || dockerfile == ".." || strings.HasPrefix(dockerfile, "../") {
+		return nil, fmt.Errorf("dockerfile %s must be inside the build context %s", spec.Dockerfile, spec.Context)
+	}
+	if _, err := os.Stat(filepath.Join(spec.Context, filepath.FromSlash(dockerfile))); err != nil {
+		return nil, fmt.Errorf("failed to find dockerfile: %w", err)
+	}
+
+	ignore, err := loadIgnore(filepath.Join(spec.Context, ".dockerignore"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	// Match results of the directories, so their children are matched incrementally
+	parents := map[string]patternmatcher.MatchInfo{}
+	err = filepath.WalkDir(spec.Context, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(spec.Context, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		excluded, matchInfo, err := ignore.MatchesUsingParentResults(rel, parents[path.Dir(rel)])
+		if err != nil {
+			return fmt.Errorf("invalid .dockerignore: %w", err)
+		}
+		if d.IsDir() {
+			parents[rel] = matchInfo
+		}
+		if rel != dockerfile && excluded {
+			// Keep walking when a later "!pattern" could include something below
+			if d.IsDir() && !ignore.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			return nil // Sockets, devices and pipes cannot be sent
+		}
+		entries = append(entries, entry{rel: rel, path: p, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build context: %w", err)
+	}
+	return entries, nil
+}
+
+// loadIgnore reads the patterns of a .dockerignore file with the same rules as
+// "docker build", including "**" and "!" exceptions.
+func loadIgnore(file string) (*patternmatcher.PatternMatcher, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return patternmatcher.New(nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+	}
+	defer f.Close()
+
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+	}
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore: %w", err)
+	}
+	return pm, nil
+}
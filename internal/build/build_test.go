@@ -0,0 +1,180 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"cderun/internal/container"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func tarNames(t *testing.T, spec *container.BuildSpec) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, Tar(spec, &buf))
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestHash(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Dockerfile":     "FROM alpine\nCOPY . /src\n",
+		"src/main.go":    "package main\n",
+		".dockerignore":  "*.log\n",
+		"debug.log":      "noise",
+		"docs/README.md": "docs",
+	})
+	spec := &container.BuildSpec{Context: dir, Dockerfile: "Dockerfile"}
+
+	hash, err := Hash(spec)
+	require.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	t.Run("ignores modification times", func(t *testing.T) {
+		future := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "src", "main.go"), future, future))
+		again, err := Hash(spec)
+		require.NoError(t, err)
+		assert.Equal(t, hash, again)
+	})
+
+	t.Run("ignores excluded files", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"debug.log": "more noise"})
+		again, err := Hash(spec)
+		require.NoError(t, err)
+		assert.Equal(t, hash, again)
+	})
+
+	t.Run("changes with the inputs", func(t *testing.T) {
+		withArgs, err := Hash(&container.BuildSpec{Context: dir, Dockerfile: "Dockerfile", Args: map[string]string{"V": "1"}})
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, withArgs)
+
+		withTarget, err := Hash(&container.BuildSpec{Context: dir, Dockerfile: "Dockerfile", Target: "ci"})
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, withTarget)
+
+		writeFiles(t, dir, map[string]string{"src/main.go": "package main\n\nfunc main() {}\n"})
+		changed, err := Hash(spec)
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, changed)
+	})
+
+	t.Run("reads files again only when their size or modification time changes", func(t *testing.T) {
+		main := filepath.Join(dir, "src", "main.go")
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, os.Chtimes(main, past, past))
+		cached, err := Hash(spec)
+		require.NoError(t, err)
+
+		// Same size and modification time: the cached digest is used
+		require.NoError(t, os.WriteFile(main, []byte("package mail\n\nfunc main() {}\n"), 0644))
+		require.NoError(t, os.Chtimes(main, past, past))
+		again, err := Hash(spec)
+		require.NoError(t, err)
+		assert.Equal(t, cached, again)
+
+		touched := past.Add(time.Minute)
+		require.NoError(t, os.Chtimes(main, touched, touched))
+		again, err = Hash(spec)
+		require.NoError(t, err)
+		assert.NotEqual(t, cached, again)
+	})
+}
+
+func TestTar(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Dockerfile":              "FROM alpine\n",
+		"build/Dockerfile.ci":     "FROM alpine\n",
+		".dockerignore":           "# generated files\nnode_modules\n**/*.tmp\nbuild\n!build/keep.txt\n",
+		"app.js":                  "console.log(1)",
+		"node_modules/left-pad/x": "x",
+		"lib/cache.tmp":           "tmp",
+		"lib/util.js":             "util",
+		"build/keep.txt":          "keep",
+		"build/output.bin":        "bin",
+	})
+
+	names := tarNames(t, &container.BuildSpec{Context: dir, Dockerfile: "build/Dockerfile.ci"})
+	assert.Equal(t, []string{
+		".dockerignore",
+		"Dockerfile",
+		"app.js",
+		"build/Dockerfile.ci", // The Dockerfile is always sent
+		"build/keep.txt",
+		"lib/",
+		"lib/util.js",
+	}, names)
+}
+
+func TestDockerfileOutsideContext(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"ctx/app.js": ""})
+
+	_, err := Hash(&container.BuildSpec{Context: filepath.Join(dir, "ctx"), Dockerfile: "../Dockerfile"})
+	assert.ErrorContains(t, err, "must be inside the build context")
+
+	_, err = Hash(&container.BuildSpec{Context: filepath.Join(dir, "ctx"), Dockerfile: "Dockerfile"})
+	assert.ErrorContains(t, err, "failed to find dockerfile")
+}
+
+func TestDockerignore(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Dockerfile":          "FROM alpine\n",
+		".dockerignore":       "**/*.log\n/docs\n!docs/**/*.md\nsrc/[^a]*.go\n!important.log\n",
+		"debug.log":           "",
+		"important.log":       "",
+		"src/a.go":            "",
+		"src/b.go":            "",
+		"src/logs/trace.log":  "",
+		"docs/index.md":       "",
+		"docs/img/logo.png":   "",
+		"docs/guide/intro.md": "",
+	})
+
+	names := tarNames(t, &container.BuildSpec{Context: dir, Dockerfile: "Dockerfile"})
+	assert.Equal(t, []string{
+		".dockerignore",
+		"Dockerfile",
+		"docs/guide/intro.md",
+		"docs/index.md",
+		"important.log",
+		"src/",
+		"src/a.go",
+		"src/logs/",
+	}, names)
+
+	writeFiles(t, dir, map[string]string{".dockerignore": "[abc\n"})
+	_, err := Hash(&container.BuildSpec{Context: dir, Dockerfile: "Dockerfile"})
+	assert.ErrorContains(t, err, "invalid .dockerignore")
+}
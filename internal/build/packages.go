@@ -0,0 +1,56 @@
+package build
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PackageManagers are the values accepted for the package manager of a tool.
+// "auto" detects the package manager in the base image while building.
+var PackageManagers = []string{"auto", "apk", "apt", "dnf"}
+
+// validPackage keeps package names and version constraints like "jq=1.6-r2" or
+// "python3-pip" from being interpreted by the shell.
+var validPackage = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+:=~@/-]*$`)
+
+// installCommands install a space-separated list of packages, cleaning up the
+// package cache so it does not end up in the image.
+var installCommands = map[string]string{
+	"apk": "apk add --no-cache %s",
+	"apt": "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends %s && rm -rf /var/lib/apt/lists/*",
+	"dnf": "dnf install -y %s && dnf clean all",
+}
+
+// PackagesDockerfile generates a Dockerfile that installs packages on top of a
+// base image, e.g.
+//
+//	FROM node:20
+//	RUN apt-get update && ... apt-get install -y --no-install-recommends jq && ...
+func PackagesDockerfile(base, manager string, packages []string) (string, error) {
+	for _, p := range packages {
+		if !validPackage.MatchString(p) {
+			return "", fmt.Errorf("invalid package name %q", p)
+		}
+	}
+	list := strings.Join(packages, " ")
+
+	var run string
+	switch manager {
+	case "apk", "apt", "dnf":
+		run = fmt.Sprintf(installCommands[manager], list)
+	case "", "auto":
+		// Tried in order, like a user would on an unknown image
+		run = fmt.Sprintf("if command -v apk >/dev/null; then %s; "+
+			"elif command -v apt-get >/dev/null; then %s; "+
+			"elif command -v dnf >/dev/null; then %s; "+
+			"else echo 'cderun: no supported package manager (apk, apt, dnf) found in %s' >&2; exit 1; fi",
+			fmt.Sprintf(installCommands["apk"], list),
+			fmt.Sprintf(installCommands["apt"], list),
+			fmt.Sprintf(installCommands["dnf"], list),
+			base)
+	default:
+		return "", fmt.Errorf("invalid package manager %q: must be one of %s", manager, strings.Join(PackageManagers, ", "))
+	}
+	return fmt.Sprintf("FROM %s\nRUN %s\n", base, run), nil
+}
@@ -0,0 +1,76 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"cderun/internal/container"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackagesDockerfile(t *testing.T) {
+	t.Run("explicit package manager", func(t *testing.T) {
+		dockerfile, err := PackagesDockerfile("alpine:3.20", "apk", []string{"jq", "git"})
+		require.NoError(t, err)
+		assert.Equal(t, "FROM alpine:3.20\nRUN apk add --no-cache jq git\n", dockerfile)
+
+		dockerfile, err = PackagesDockerfile("node:20", "apt", []string{"jq=1.6-2.1"})
+		require.NoError(t, err)
+		assert.Contains(t, dockerfile, "apt-get install -y --no-install-recommends jq=1.6-2.1")
+		assert.Contains(t, dockerfile, "rm -rf /var/lib/apt/lists/*")
+
+		dockerfile, err = PackagesDockerfile("fedora:40", "dnf", []string{"python3-pip"})
+		require.NoError(t, err)
+		assert.Equal(t, "FROM fedora:40\nRUN dnf install -y python3-pip && dnf clean all\n", dockerfile)
+	})
+
+	t.Run("auto detects the package manager", func(t *testing.T) {
+		for _, manager := range []string{"", "auto"} {
+			dockerfile, err := PackagesDockerfile("node:20", manager, []string{"jq"})
+			require.NoError(t, err)
+			assert.Contains(t, dockerfile, "if command -v apk >/dev/null; then apk add --no-cache jq;")
+			assert.Contains(t, dockerfile, "elif command -v apt-get >/dev/null;")
+			assert.Contains(t, dockerfile, "elif command -v dnf >/dev/null;")
+			assert.Contains(t, dockerfile, "no supported package manager (apk, apt, dnf) found in node:20")
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := PackagesDockerfile("node:20", "yum", []string{"jq"})
+		assert.ErrorContains(t, err, `invalid package manager "yum"`)
+
+		for _, p := range []string{"jq; rm -rf /", "$(id)", "-y", "a b", "jq>1"} {
+			_, err = PackagesDockerfile("node:20", "apt", []string{p})
+			assert.ErrorContains(t, err, "invalid package name", p)
+		}
+	})
+}
+
+func TestInlineBuild(t *testing.T) {
+	spec := &container.BuildSpec{Dockerfile: "Dockerfile", Inline: "FROM alpine\nRUN apk add --no-cache jq\n"}
+
+	hash, err := Hash(spec)
+	require.NoError(t, err)
+	again, err := Hash(&container.BuildSpec{Dockerfile: "Dockerfile", Inline: spec.Inline})
+	require.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	other, err := Hash(&container.BuildSpec{Dockerfile: "Dockerfile", Inline: "FROM alpine\nRUN apk add --no-cache git\n"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	var buf bytes.Buffer
+	require.NoError(t, Tar(spec, &buf))
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "Dockerfile", hdr.Name)
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	assert.Equal(t, spec.Inline, string(content))
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,176 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach CONTAINER|TOOL",
+	Short: "Attach to a running container started by cderun",
+	Long: `Reconnect the terminal to a running container started by cderun, e.g. after
+detaching from it with the detach key sequence (default ctrl-p,ctrl-q). The
+container can be selected by ID (or a unique prefix), by name or by its tool.
+cderun exits with the exit code of the container.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		toolsCfg, globalCfg := opts.loadConfigs()
+		rt, err := opts.connectRuntime(cmd, globalCfg)
+		if err != nil {
+			return err
+		}
+
+		containers, err := listManaged(cmd.Context(), rt, runtime.ContainerFilter{Labels: map[string]string{managedLabel: ""}})
+		if err != nil {
+			return err
+		}
+		// Services and keep-alive containers do not run the tool in their main process
+		var candidates []runtime.ContainerInfo
+		for _, c := range containers {
+			if c.Labels[serviceLabel] == "" && c.Labels[keepAliveLabel] != "true" {
+				candidates = append(candidates, c)
+			}
+		}
+		matched := selectContainers(candidates, args[0])
+		if len(matched) == 0 {
+			return fmt.Errorf("no running cderun container matches %q", args[0])
+		}
+		if len(matched) > 1 {
+			var ids []string
+			for _, c := range matched {
+				ids = append(ids, shortID(c.ID))
+			}
+			return fmt.Errorf("%q matches %d containers (%s), use the container ID", args[0], len(matched), strings.Join(ids, ", "))
+		}
+
+		// The list does not include the TTY and stdin settings
+		info, err := rt.InspectContainer(cmd.Context(), matched[0].ID)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+		detachKeys, err := config.ResolveDetachKeys(info.Labels[toolLabel], config.CLIOptions{
+			DetachKeys:          opts.detachKeys,
+			DetachKeysSet:       cmd.Flags().Changed("detach-keys"),
+			CderunDetachKeys:    opts.cderunDetachKeys,
+			CderunDetachKeysSet: cmd.Flags().Changed("cderun-detach-keys"),
+		}, toolsCfg, globalCfg)
+		if err != nil {
+			return err
+		}
+
+		drainTimeout, err := config.ResolveDrainTimeout(info.Labels[toolLabel], config.CLIOptions{
+			DrainTimeout:          opts.drainTimeout,
+			DrainTimeoutSet:       cmd.Flags().Changed("drain-timeout"),
+			CderunDrainTimeout:    opts.cderunDrainTimeout,
+			CderunDrainTimeoutSet: cmd.Flags().Changed("cderun-drain-timeout"),
+		}, toolsCfg, globalCfg)
+		if err != nil {
+			return err
+		}
+		timeout, _ := time.ParseDuration(drainTimeout)
+
+		exitCode, err := attachSession(cmd.Context(), rt, info, detachKeys, timeout)
+		if err != nil {
+			return err
+		}
+		exitFunc(exitCode)
+		return nil
+	},
+}
+
+// attachSession connects the terminal to a running container with TTY resize and
+// signal forwarding, and returns its exit code once it exits. If the user detaches,
+// the container keeps running and 0 is returned.
+func attachSession(ctx context.Context, rt runtime.ContainerRuntime, info *runtime.ContainerInfo, detachKeys string, drainTimeout time.Duration) (int, error) {
+	ctxG, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	restoreTerminal := makeRawTerminal(info.TTY)
+	defer restoreTerminal()
+
+	// Like "docker attach", proxy every signal cderun can forward
+	var names []string
+	for name := range signalsByName {
+		names = append(names, name)
+	}
+	sigChan := make(chan os.Signal, 4)
+	signal.Notify(sigChan, lookupSignals(names)...)
+	defer signal.Stop(sigChan)
+	forwarder := &signalForwarder{rt: rt, containerID: info.ID, tty: info.TTY, stopTimeout: 10 * time.Second}
+	go forwarder.run(ctxG, cancel, sigChan)
+
+	if info.TTY && term.IsTerminal(int(os.Stdout.Fd())) {
+		syncTerminalSize(ctxG, func(rows, cols uint) error {
+			return rt.ResizeContainerTTY(ctxG, info.ID, rows, cols)
+		})
+	}
+
+	var stdin io.Reader
+	if info.OpenStdin {
+		stdin = os.Stdin
+	}
+
+	attachCtx, cancelAttach := context.WithCancel(ctxG)
+	defer cancelAttach()
+
+	var detached atomic.Bool
+	attachDone := make(chan error, 1)
+	go func() {
+		err := rt.AttachContainer(attachCtx, info.ID, runtime.AttachOptions{TTY: info.TTY, DetachKeys: detachKeys}, stdin, os.Stdout, os.Stderr)
+		if errors.Is(err, runtime.ErrDetached) {
+			detached.Store(true)
+			cancel()
+		}
+		attachDone <- err
+	}()
+
+	exitCode, err := rt.WaitContainer(ctxG, info.ID)
+	if err != nil && detached.Load() {
+		restoreTerminal()
+		detachContainer(context.WithoutCancel(ctx), rt, info.Labels[toolLabel], info.ID, info.Name)
+		return 0, nil
+	}
+	if err != nil {
+		if code, ok := forwarder.exitCode(); ok && ctxG.Err() != nil && ctx.Err() == nil {
+			logging.Debug("Killing container after forced termination: %s", info.ID)
+			if err := rt.StopContainer(context.WithoutCancel(ctx), info.ID, 0); err != nil {
+				logging.Warn("failed to kill container: %v", err)
+			}
+			return code, nil
+		}
+		return 0, fmt.Errorf("failed to wait for container: %w", err)
+	}
+
+	if err := drainAttach(attachDone, cancelAttach, drainTimeout); err != nil {
+		return 0, err
+	}
+
+	if exitCode != 0 {
+		reportOOMKilled(ctx, rt, info.ID)
+	}
+	// The cderun process that started a detached container is gone, so clean up for it
+	if isDetached(info.Name) && info.Labels[removeLabel] == "true" {
+		if err := rt.RemoveContainer(context.WithoutCancel(ctx), info.ID); err != nil {
+			logging.Warn("failed to remove container: %v", err)
+		}
+	}
+	if code, ok := forwarder.exitCode(); ok {
+		return code, nil
+	}
+	return exitCode, nil
+}
@@ -0,0 +1,227 @@
+package command
+
+import (
+	"bytes"
+	"cderun/internal/config"
+	"cderun/internal/logging"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// For testing
+var captureNow = time.Now
+
+// outputCapture holds the writers passed to the runtime for the tool's output.
+// They copy the output to the files configured with --capture and --output-log.
+type outputCapture struct {
+	stdout, stderr io.Writer
+	files          []*os.File
+	transcript     *transcript
+}
+
+// openOutputCapture creates the configured files. Without any, the writers are
+// os.Stdout and os.Stderr.
+func openOutputCapture(resolved *config.ResolvedConfig) (*outputCapture, error) {
+	c := &outputCapture{stdout: os.Stdout, stderr: os.Stderr}
+	// The same file may be given for several streams (e.g. --capture stdout=run.log
+	// --capture stderr=run.log); it is opened once and its writes are serialized
+	writers := map[string]io.Writer{}
+	open := func(path string) (io.Writer, error) {
+		key := filepath.Clean(path)
+		if abs, err := filepath.Abs(key); err == nil {
+			key = abs
+		}
+		if w, ok := writers[key]; ok {
+			return w, nil
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to open output file: %w", err)
+		}
+		c.files = append(c.files, f)
+		writers[key] = &lockedWriter{w: f}
+		return writers[key], nil
+	}
+
+	var stdoutCopies, stderrCopies []io.Writer
+	if resolved.CaptureStdout != "" {
+		w, err := open(resolved.CaptureStdout)
+		if err != nil {
+			return nil, err
+		}
+		stdoutCopies = append(stdoutCopies, w)
+	}
+	if resolved.CaptureStderr != "" {
+		w, err := open(resolved.CaptureStderr)
+		if err != nil {
+			return nil, err
+		}
+		stderrCopies = append(stderrCopies, w)
+	}
+	if resolved.OutputLog != "" {
+		w, err := open(resolved.OutputLog)
+		if err != nil {
+			return nil, err
+		}
+		c.transcript = &transcript{w: w, jsonl: resolved.OutputLogFormat == "jsonl", pending: make(map[string][]byte)}
+		stdoutCopies = append(stdoutCopies, c.transcript.stream("stdout"))
+		stderrCopies = append(stderrCopies, c.transcript.stream("stderr"))
+	}
+
+	if len(stdoutCopies) > 0 {
+		c.stdout = &teeWriter{w: os.Stdout, copies: stdoutCopies}
+	}
+	if len(stderrCopies) > 0 {
+		c.stderr = &teeWriter{w: os.Stderr, copies: stderrCopies}
+	}
+	return c, nil
+}
+
+// Close writes what is left of the transcript and closes the files.
+func (c *outputCapture) Close() {
+	if c.transcript != nil {
+		if err := c.transcript.flush(); err != nil {
+			logging.Warn("failed to write output log: %v", err)
+		}
+	}
+	for _, f := range c.files {
+		if err := f.Close(); err != nil {
+			logging.Warn("failed to close output file: %v", err)
+		}
+	}
+	c.files = nil
+}
+
+// teeWriter writes to w and copies everything to the copies. A copy that fails is
+// dropped with a warning so the output on the terminal keeps flowing.
+type teeWriter struct {
+	w      io.Writer
+	copies []io.Writer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	kept := t.copies[:0]
+	for _, c := range t.copies {
+		if _, cerr := c.Write(p); cerr != nil {
+			logging.Warn("failed to copy output, stopping the copy: %v", cerr)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	t.copies = kept
+	return n, err
+}
+
+// lockedWriter serializes the writes of the streams sharing a file, which the
+// runtime delivers from different goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// transcript is a combined, timestamped record of stdout and stderr. The text
+// format has one line per output line, e.g.
+//
+//	2024-05-01T12:00:00.000Z stderr warning: deprecated flag
+//
+// and the jsonl format one object per chunk received from the runtime.
+// With a TTY, the runtime only delivers stdout.
+type transcript struct {
+	mu      sync.Mutex
+	w       io.Writer
+	jsonl   bool
+	pending map[string][]byte // Incomplete lines of the text format
+}
+
+type transcriptRecord struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Data   string    `json:"data"`
+}
+
+func (t *transcript) stream(name string) io.Writer {
+	return transcriptStream{t: t, name: name}
+}
+
+type transcriptStream struct {
+	t    *transcript
+	name string
+}
+
+func (s transcriptStream) Write(p []byte) (int, error) {
+	if err := s.t.write(s.name, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *transcript) write(stream string, p []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := captureNow().UTC()
+
+	if t.jsonl {
+		data, err := json.Marshal(transcriptRecord{Time: now, Stream: stream, Data: string(p)})
+		if err != nil {
+			return err
+		}
+		_, err = t.w.Write(append(data, '\n'))
+		return err
+	}
+
+	buf := append(t.pending[stream], p...)
+	var out bytes.Buffer
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		writeTranscriptLine(&out, now, stream, buf[:i])
+		buf = buf[i+1:]
+	}
+	t.pending[stream] = append([]byte(nil), buf...)
+	_, err := t.w.Write(out.Bytes())
+	return err
+}
+
+// flush writes incomplete lines of the text format, e.g. a prompt without a newline.
+func (t *transcript) flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := captureNow().UTC()
+
+	var out bytes.Buffer
+	for _, stream := range []string{"stdout", "stderr"} {
+		if len(t.pending[stream]) > 0 {
+			writeTranscriptLine(&out, now, stream, t.pending[stream])
+			delete(t.pending, stream)
+		}
+	}
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := t.w.Write(out.Bytes())
+	return err
+}
+
+func writeTranscriptLine(out *bytes.Buffer, now time.Time, stream string, line []byte) {
+	out.WriteString(now.Format("2006-01-02T15:04:05.000Z07:00"))
+	out.WriteByte(' ')
+	out.WriteString(stream)
+	out.WriteByte(' ')
+	out.Write(bytes.TrimSuffix(line, []byte("\r")))
+	out.WriteByte('\n')
+}
@@ -0,0 +1,164 @@
+package command
+
+import (
+	"bytes"
+	"cderun/internal/runtime"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkedOutputRuntime writes output chunks to stdout and stderr like the runtime
+// does while demultiplexing the attach stream.
+type chunkedOutputRuntime struct {
+	runtime.MockRuntime
+	chunks []struct{ stream, data string }
+}
+
+func (m *chunkedOutputRuntime) AttachContainer(ctx context.Context, containerID string, opts runtime.AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.AttachedContainerID = containerID
+	for _, c := range m.chunks {
+		w := stdout
+		if c.stream == "stderr" {
+			w = stderr
+		}
+		if _, err := io.WriteString(w, c.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestOutputCapture(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldNow := captureNow
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		captureNow = oldNow
+	})
+	exitFunc = func(int) {}
+	captureNow = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	mock := &chunkedOutputRuntime{chunks: []struct{ stream, data string }{
+		{"stdout", "ok 1\nok "},
+		{"stderr", "warning: slow\n"},
+		{"stdout", "2\ndone"},
+	}}
+	mock.CreatedContainerID = "c1"
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	t.Run("per-stream files", func(t *testing.T) {
+		dir := t.TempDir()
+		stdoutFile := filepath.Join(dir, "out.log")
+		stderrFile := filepath.Join(dir, "err.log")
+
+		output, err := executeCommand("--image", "alpine", "--capture", "stdout="+stdoutFile, "--capture", "stderr="+stderrFile, "prove")
+		require.NoError(t, err)
+		assert.Contains(t, output, "ok 1\nok warning: slow\n2\ndone", "the terminal still gets the output")
+
+		data, err := os.ReadFile(stdoutFile)
+		require.NoError(t, err)
+		assert.Equal(t, "ok 1\nok 2\ndone", string(data))
+		data, err = os.ReadFile(stderrFile)
+		require.NoError(t, err)
+		assert.Equal(t, "warning: slow\n", string(data))
+	})
+
+	t.Run("shared file for both streams", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "all.log")
+
+		_, err := executeCommand("--image", "alpine", "--capture", "stdout="+path, "--capture", "stderr="+filepath.Join(dir, ".", "all.log"), "prove")
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "ok 1\nok warning: slow\n2\ndone", string(data), "the file is opened once, so no stream overwrites the other")
+	})
+
+	t.Run("text transcript", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "run.log")
+
+		_, err := executeCommand("--image", "alpine", "--output-log", path, "prove")
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, strings.Join([]string{
+			"2024-05-01T12:00:00.000Z stdout ok 1",
+			"2024-05-01T12:00:00.000Z stderr warning: slow",
+			"2024-05-01T12:00:00.000Z stdout ok 2",
+			"2024-05-01T12:00:00.000Z stdout done",
+			"",
+		}, "\n"), string(data))
+	})
+
+	t.Run("jsonl transcript", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "run.jsonl")
+
+		_, err := executeCommand("--image", "alpine", "--output-log", path, "--output-log-format", "jsonl", "prove")
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 3)
+		var records []transcriptRecord
+		for _, line := range lines {
+			var r transcriptRecord
+			require.NoError(t, json.Unmarshal([]byte(line), &r))
+			records = append(records, r)
+		}
+		assert.Equal(t, transcriptRecord{Time: captureNow(), Stream: "stdout", Data: "ok 1\nok "}, records[0])
+		assert.Equal(t, "stderr", records[1].Stream)
+		assert.Equal(t, "warning: slow\n", records[1].Data)
+		assert.Equal(t, "2\ndone", records[2].Data)
+	})
+
+	t.Run("unwritable file fails before the container is created", func(t *testing.T) {
+		mock.CreatedConfig = nil
+		_, err := executeCommand("--image", "alpine", "--output-log", filepath.Join(t.TempDir(), "missing", "run.log"), "prove")
+		assert.ErrorContains(t, err, "failed to open output file")
+		assert.Nil(t, mock.CreatedConfig)
+	})
+
+	t.Run("invalid capture", func(t *testing.T) {
+		_, err := executeCommand("--image", "alpine", "--capture", "stdin=in.log", "prove")
+		assert.ErrorContains(t, err, "invalid capture")
+	})
+}
+
+type failingWriter struct{ writes int }
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	f.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestTeeWriter(t *testing.T) {
+	var primary, copied bytes.Buffer
+	failing := &failingWriter{}
+	w := &teeWriter{w: &primary, copies: []io.Writer{failing, &copied}}
+
+	for _, s := range []string{"a", "b"} {
+		n, err := io.WriteString(w, s)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	assert.Equal(t, "ab", primary.String())
+	assert.Equal(t, "ab", copied.String())
+	assert.Equal(t, 1, failing.writes, "a failed copy is dropped")
+}
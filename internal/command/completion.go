@@ -0,0 +1,250 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"cderun/internal/config"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate the shell completion script",
+	Long: `Generate the shell completion script for cderun.
+
+Before the tool name, cderun's own flags are completed. The tool name is
+completed from .tools.yaml. After the tool name, only --cderun-* flags are
+completed by cderun; other arguments are completed as files, or by the tool
+itself when it sets "completion: cobra" in .tools.yaml.
+
+To load the completions:
+  bash        source <(cderun completion bash)               in ~/.bashrc
+  zsh         source <(cderun completion zsh)                in ~/.zshrc
+  fish        cderun completion fish | source                in ~/.config/fish/config.fish
+  powershell  cderun completion powershell | Out-String | Invoke-Expression   in $PROFILE`,
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("completion requires a shell: bash, zsh, fish or powershell")
+		}
+		out := cmd.OutOrStdout()
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(out, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(out)
+		case "fish":
+			return rootCmd.GenFishCompletion(out, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(out)
+		default:
+			return fmt.Errorf("unsupported shell %q: must be bash, zsh, fish or powershell", args[0])
+		}
+	},
+}
+
+// toolCompletionRunner runs "TOOL __complete ARG..." in the container of a tool
+// and returns its output. It is a variable so tests can replace it.
+var toolCompletionRunner = func(tool string, args []string) ([]byte, error) {
+	exe, err := cderunExecutable()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmdArgs := append([]string{"--tty=false", "--interactive=false", "--auto-stdin=false", "--", tool, cobra.ShellCompNoDescRequestCmd}, args...)
+	return exec.CommandContext(ctx, exe, cmdArgs...).Output()
+}
+
+// isCompletionRequest reports whether args (including the executable name) are
+// a completion request of the scripts generated by "cderun completion".
+func isCompletionRequest(args []string) bool {
+	return len(args) > 1 && (args[1] == cobra.ShellCompRequestCmd || args[1] == cobra.ShellCompNoDescRequestCmd)
+}
+
+// completionArgs rewrites a completion request "cderun __complete ARG... WORD"
+// for cobra, which does not know cderun's argument boundary. Before the tool
+// name and for management commands (also after managementFlags) the request is
+// left to cobra, except that after cderun's flags or "--" only a tool name can
+// follow, which is completed like the value of --mount-tools instead of
+// cobra's subcommands. After the
+// tool name, --cderun-* flags are dropped since preprocessArgs hoists them, a
+// --cderun-* flag value is completed like the flag on cderun itself, and
+// anything else goes to completeTool with "--" so cobra does not complete the
+// flags of cderun.
+func completionArgs(args []string) []string {
+	words, toComplete := args[2:len(args)-1], args[len(args)-1]
+
+	tool := commandIndex(append([]string{args[0]}, words...)) - 1
+	if tool >= 0 && isManagementCommand(words[tool]) && onlyManagementFlags(words[:tool]) {
+		return args
+	}
+	if tool < 0 {
+		dash := -1
+		for i, w := range words {
+			if w == "--" {
+				dash = i
+				break
+			}
+		}
+		atTool := dash >= 0 && dash == len(words)-1 ||
+			dash < 0 && len(words) > 0 && commandIndex(append(append([]string{args[0]}, words...), "TOOL")) == len(words)+1
+		if atTool && !strings.HasPrefix(toComplete, "-") {
+			return []string{args[0], args[1], "--mount-tools", toComplete}
+		}
+		if dash < 0 || dash == len(words)-1 {
+			return args
+		}
+		tool = dash + 1
+	}
+
+	flags := rootCmd.PersistentFlags()
+	toolArgs := words[tool+1:]
+	if n := len(toolArgs); n > 0 && strings.HasPrefix(toolArgs[n-1], "--cderun-") && !strings.Contains(toolArgs[n-1], "=") {
+		if f := flags.Lookup(toolArgs[n-1][2:]); f != nil && f.NoOptDefVal == "" {
+			return []string{args[0], args[1], toolArgs[n-1], toComplete}
+		}
+	}
+	if strings.HasPrefix(toComplete, "--cderun-") && strings.Contains(toComplete, "=") {
+		return []string{args[0], args[1], toComplete}
+	}
+
+	newArgs := []string{args[0], args[1], "--", words[tool]}
+	for i := 0; i < len(toolArgs); i++ {
+		if !strings.HasPrefix(toolArgs[i], "--cderun-") {
+			newArgs = append(newArgs, toolArgs[i])
+			continue
+		}
+		if f := flags.Lookup(toolArgs[i][2:]); f != nil && f.NoOptDefVal == "" && !strings.Contains(toolArgs[i], "=") {
+			i++ // Skip the flag value
+		}
+	}
+	return append(newArgs, toComplete)
+}
+
+// hideOverrideFlags hides the --cderun-* flags from cobra's flag completion,
+// since they are only allowed after the tool name. It returns a function that
+// shows them again.
+func hideOverrideFlags() func() {
+	var hidden []*pflag.Flag
+	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if strings.HasPrefix(f.Name, "cderun-") && !f.Hidden {
+			f.Hidden = true
+			hidden = append(hidden, f)
+		}
+	})
+	return func() {
+		for _, f := range hidden {
+			f.Hidden = false
+		}
+	}
+}
+
+// completeTool completes the tool name from the tools config and, after it,
+// the --cderun-* flags and the arguments of the tool.
+func completeTool(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	toolsCfg, _, _ := config.LoadToolsConfig()
+	if len(args) == 0 {
+		var comps []cobra.Completion
+		for name, tool := range toolsCfg {
+			if strings.HasPrefix(name, toComplete) {
+				comps = append(comps, cobra.CompletionWithDesc(name, tool.Image))
+			}
+		}
+		sort.Strings(comps)
+		return comps, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var comps []cobra.Completion
+	if strings.HasPrefix(toComplete, "-") && (strings.HasPrefix("--cderun-", toComplete) || strings.HasPrefix(toComplete, "--cderun-")) {
+		rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+			if strings.HasPrefix(f.Name, "cderun-") && strings.HasPrefix("--"+f.Name, toComplete) {
+				comps = append(comps, cobra.CompletionWithDesc("--"+f.Name, f.Usage))
+			}
+		})
+	}
+
+	tool := toolsCfg[args[0]]
+	switch tool.Completion {
+	case "none":
+		return comps, cobra.ShellCompDirectiveNoFileComp
+	case "cobra":
+		toolComps, directive := delegateCompletion(args[0], append(append([]string{}, args[1:]...), toComplete))
+		if len(comps) > 0 {
+			directive |= cobra.ShellCompDirectiveNoFileComp
+		}
+		return append(comps, toolComps...), directive
+	default:
+		if len(comps) > 0 {
+			return comps, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+}
+
+// delegateCompletion asks a tool built with Cobra for its completions, using
+// the same protocol as cderun's completion scripts.
+func delegateCompletion(tool string, args []string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	out, err := toolCompletionRunner(tool, args)
+	if err != nil {
+		cobra.CompDebugln(fmt.Sprintf("completion of %s failed: %v", tool, err), true)
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	var comps []cobra.Completion
+	directive := cobra.ShellCompDirectiveDefault
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			if d, err := strconv.Atoi(line[1:]); err == nil {
+				directive = cobra.ShellCompDirective(d)
+			}
+			continue
+		}
+		if line != "" {
+			comps = append(comps, line)
+		}
+	}
+	return comps, directive
+}
+
+// completeValues returns a completion function for a flag with fixed values.
+func completeValues(values ...string) cobra.CompletionFunc {
+	return cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp)
+}
+
+func completeToolNames(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return completeTool(cmd, nil, toComplete)
+}
+
+// registerFlagCompletions registers the completion of flag values. It is called
+// by the init of root.go, once the flags are defined.
+func registerFlagCompletions() {
+	for name, fn := range map[string]cobra.CompletionFunc{
+		"runtime":           completeValues("docker", "podman"),
+		"dry-run-format":    completeValues("yaml", "json", "simple"),
+		"log-level":         completeValues("error", "warn", "info", "debug", "trace"),
+		"log-format":        completeValues("text", "json"),
+		"output-log-format": completeValues("text", "jsonl"),
+		"network":           completeValues("bridge", "host", "none"),
+		"mount-tools":       completeToolNames,
+	} {
+		for _, flag := range []string{name, "cderun-" + name} {
+			_ = rootCmd.RegisterFlagCompletionFunc(flag, fn)
+		}
+	}
+}
+
+func init() {
+	rootCmd.ValidArgsFunction = completeTool
+	rootCmd.AddCommand(completionCmd)
+}
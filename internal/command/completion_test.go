@@ -0,0 +1,122 @@
+package command
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// complete runs a completion request and returns the completions without their
+// descriptions, followed by the directive.
+func complete(t *testing.T, args ...string) []string {
+	t.Helper()
+	out, err := executeCommand(append([]string{cobra.ShellCompRequestCmd}, args...)...)
+	require.NoError(t, err)
+	var comps []string
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" || strings.HasPrefix(line, "Completion ended") {
+			continue
+		}
+		name, _, _ := strings.Cut(line, "\t")
+		comps = append(comps, name)
+	}
+	return comps
+}
+
+func TestCompletion(t *testing.T) {
+	oldWd, _ := os.Getwd()
+	oldRunner := toolCompletionRunner
+	t.Cleanup(func() {
+		os.Chdir(oldWd)
+		toolCompletionRunner = oldRunner
+	})
+	require.NoError(t, os.Chdir(t.TempDir()))
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte(`
+node:
+  image: node:20
+nginx:
+  image: nginx
+kubectl:
+  image: bitnami/kubectl
+  completion: cobra
+jq:
+  image: jq
+  completion: none
+`), 0644))
+
+	t.Run("before the tool", func(t *testing.T) {
+		comps := complete(t, "n")
+		assert.Equal(t, []string{"nginx", "node", ":4"}, comps)
+
+		comps = complete(t, "")
+		assert.Contains(t, comps, "ps")
+		assert.Contains(t, comps, "kubectl")
+
+		comps = complete(t, "--dry")
+		assert.Equal(t, []string{"--dry-run", "--dry-run-format", ":4"}, comps)
+		comps = complete(t, "--cderun-")
+		assert.Equal(t, []string{":4"}, comps, "--cderun-* flags are not allowed before the tool")
+
+		comps = complete(t, "--runtime", "")
+		assert.Equal(t, []string{"docker", "podman", ":4"}, comps)
+		comps = complete(t, "--image", "node:20", "no")
+		assert.Equal(t, []string{"node", ":4"}, comps)
+		comps = complete(t, "--image", "node:20", "")
+		assert.Equal(t, []string{"jq", "kubectl", "nginx", "node", ":4"}, comps, "only tools follow cderun's flags")
+		comps = complete(t, "--tty", "--", "")
+		assert.Equal(t, []string{"jq", "kubectl", "nginx", "node", ":4"}, comps)
+		comps = complete(t, "--tty", "--dry")
+		assert.Equal(t, []string{"--dry-run", "--dry-run-format", ":4"}, comps)
+	})
+
+	t.Run("after the tool", func(t *testing.T) {
+		comps := complete(t, "node", "--cderun-dry")
+		assert.Equal(t, []string{"--cderun-dry-run", "--cderun-dry-run-format", ":4"}, comps)
+		comps = complete(t, "node", "--inspect", "--cderun-runtime", "")
+		assert.Equal(t, []string{"docker", "podman", ":4"}, comps)
+		comps = complete(t, "node", "--cderun-dry-run-format=")
+		assert.Equal(t, []string{"yaml", "json", "simple", ":4"}, comps)
+
+		comps = complete(t, "node", "--cderun-runtime", "docker", "index.js", "")
+		assert.Equal(t, []string{":0"}, comps, "arguments are completed as files")
+		comps = complete(t, "jq", "")
+		assert.Equal(t, []string{":4"}, comps)
+	})
+
+	t.Run("management command names as tools", func(t *testing.T) {
+		comps := complete(t, "ps", "--al")
+		assert.Equal(t, []string{"--all", ":4"}, comps, "ps is the management command")
+		comps = complete(t, "--tty", "ps", "--cderun-tt")
+		assert.Equal(t, []string{"--cderun-tty", ":4"}, comps, "ps is a tool")
+		comps = complete(t, "--", "ps", "--cderun-tt")
+		assert.Equal(t, []string{"--cderun-tty", ":4"}, comps)
+		comps = complete(t, "--runtime", "podman", "ps", "--al")
+		assert.Equal(t, []string{"--all", ":4"}, comps, "ps is the management command")
+	})
+
+	t.Run("delegation", func(t *testing.T) {
+		var got []string
+		toolCompletionRunner = func(tool string, args []string) ([]byte, error) {
+			got = append([]string{tool}, args...)
+			return []byte("pods\nservices\n:4\n"), nil
+		}
+		comps := complete(t, "kubectl", "--cderun-tty", "get", "")
+		assert.Equal(t, []string{"pods", "services", ":4"}, comps)
+		assert.Equal(t, []string{"kubectl", "get", ""}, got, "--cderun-* flags are not passed on")
+	})
+
+	t.Run("script", func(t *testing.T) {
+		for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+			out, err := executeCommand("completion", shell)
+			require.NoError(t, err, shell)
+			assert.Contains(t, out, "__complete", shell)
+		}
+		_, err := executeCommand("completion", "tcsh")
+		assert.ErrorContains(t, err, `unsupported shell "tcsh"`)
+		assert.False(t, rootCmd.PersistentFlags().Lookup("cderun-image").Hidden, "flags are shown again after completion")
+	})
+}
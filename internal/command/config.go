@@ -0,0 +1,145 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type configImportOptions struct {
+	config string
+	name   string
+	output string
+	force  bool
+}
+
+var configImportOpts = &configImportOptions{}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage cderun configuration files",
+	Args:  cobra.NoArgs,
+}
+
+var configImportCmd = &cobra.Command{
+	Use:   "import SOURCE [SERVICE...]",
+	Short: "Convert another configuration format into .tools.yaml entries",
+	Long: `Convert another configuration format into tools in .tools.yaml. Other
+tools and comments in the file are kept.
+
+Sources:
+  devcontainer   .devcontainer/devcontainer.json or .devcontainer.json
+  compose        compose.yaml or docker-compose.yml, one tool per service
+                 (all services unless SERVICE names are given)`,
+	Args:      cobra.MinimumNArgs(1),
+	ValidArgs: []string{"devcontainer", "compose"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		var tools config.ToolsConfig
+		var err error
+		switch args[0] {
+		case "devcontainer":
+			tools, err = importDevcontainer(args[1:])
+		case "compose":
+			tools, err = importCompose(args[1:])
+		default:
+			return fmt.Errorf("unknown import source %q: must be devcontainer or compose", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		return writeImported(cmd, tools)
+	},
+}
+
+// importCompose converts the services of a Compose file into tools named like
+// the services.
+func importCompose(services []string) (config.ToolsConfig, error) {
+	file := configImportOpts.config
+	if file == "" {
+		found, err := config.FindCompose(".")
+		if err != nil {
+			return nil, err
+		}
+		if found == "" {
+			return nil, fmt.Errorf("no compose file found (looked for %s)", strings.Join(config.ComposePaths, ", "))
+		}
+		file = found
+	}
+	compose, err := config.LoadComposeForImport(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		services = compose.ServiceNames()
+	}
+	if configImportOpts.name != "" && len(services) != 1 {
+		return nil, fmt.Errorf("--name can only be used when importing a single service")
+	}
+
+	tools := make(config.ToolsConfig, len(services))
+	for _, service := range services {
+		tool, err := compose.ToolConfig(service)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		name := service
+		if configImportOpts.name != "" {
+			name = configImportOpts.name
+		}
+		tools[name] = tool
+	}
+	return tools, nil
+}
+
+// writeImported adds tools to the tools file. Host paths below the directory of
+// the tools file are written relative to it, so the file can be committed.
+func writeImported(cmd *cobra.Command, tools config.ToolsConfig) error {
+	dir, err := filepath.Abs(filepath.Dir(configImportOpts.output))
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	names := make([]string, 0, len(tools))
+	for name, tool := range tools {
+		if tool.Build != nil {
+			if rel, err := filepath.Rel(dir, tool.Build.Context); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				tool.Build.Context = filepath.ToSlash(rel)
+			}
+		}
+		for i, v := range tool.Volumes {
+			if strings.HasPrefix(v, dir+":") || strings.HasPrefix(v, dir+string(filepath.Separator)) {
+				tool.Volumes[i] = "." + v[len(dir):]
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := config.WriteTools(configImportOpts.output, tools, configImportOpts.force); err != nil {
+		if errors.Is(err, config.ErrToolExists) {
+			return fmt.Errorf("%w (use --force to replace it, or --name to choose another name)", err)
+		}
+		return err
+	}
+	if len(names) == 1 {
+		fmt.Fprintf(cmd.OutOrStdout(), "Added tool %s to %s, run it with: cderun %s\n", names[0], configImportOpts.output, names[0])
+	} else {
+		fmt.Fprintf(cmd.OutOrStdout(), "Added tools %s to %s\n", strings.Join(names, ", "), configImportOpts.output)
+	}
+	return nil
+}
+
+func init() {
+	configImportCmd.Flags().StringVar(&configImportOpts.config, "config", "", "Path to the source file (default: the standard location of the source)")
+	configImportCmd.Flags().StringVar(&configImportOpts.name, "name", "", "Name of the tool (default: the name in the source)")
+	configImportCmd.Flags().StringVarP(&configImportOpts.output, "output", "o", ".tools.yaml", "Tools file to write")
+	configImportCmd.Flags().BoolVar(&configImportOpts.force, "force", false, "Replace existing tools with the same names")
+
+	configCmd.AddCommand(configImportCmd)
+	rootCmd.AddCommand(configCmd)
+}
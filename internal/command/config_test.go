@@ -0,0 +1,125 @@
+package command
+
+import (
+	"cderun/internal/runtime"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposeTools(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Chdir(oldWd)
+	})
+	exitFunc = func(int) {}
+
+	mock := &runtime.MockRuntime{CreatedContainerID: "c1"}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+	require.NoError(t, os.WriteFile(".env", []byte("PYTHON_VERSION=3.12\n"), 0644))
+	require.NoError(t, os.WriteFile("compose.yaml", []byte(`
+name: shop
+services:
+  python:
+    image: python:${PYTHON_VERSION}
+    working_dir: /src
+    volumes: [.:/src]
+    networks: [backend]
+  worker:
+    build: ./worker
+`), 0644))
+
+	t.Run("compose reference in the tools file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte("pytest:\n  compose: compose.yaml#python\n"), 0644))
+		output, err := executeCommand("--dry-run", "-f", "simple", "pytest", "-x")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Image: python:3.12\n")
+		assert.Contains(t, output, "Network: shop_backend\n")
+		assert.Contains(t, output, "Volumes: "+dir+":/src\n")
+		assert.Contains(t, output, "Workdir: /src\n")
+	})
+
+	t.Run("import", func(t *testing.T) {
+		require.NoError(t, os.Remove(".tools.yaml"))
+		output, err := executeCommand("config", "import", "compose")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Added tools python, worker to .tools.yaml")
+
+		data, err := os.ReadFile(".tools.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "python:\n"+
+			"  image: python:3.12\n"+
+			"  network: shop_backend\n"+
+			"  volumes:\n    - .:/src\n"+
+			"  workdir: /src\n"+
+			"worker:\n"+
+			"  build: worker\n", string(data))
+
+		output, err = executeCommand("config", "import", "compose", "python", "--name", "py")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Added tool py to .tools.yaml")
+
+		_, err = executeCommand("config", "import", "compose", "--name", "py")
+		assert.ErrorContains(t, err, "--name can only be used when importing a single service")
+
+		_, err = executeCommand("config", "import", "compose", "db")
+		assert.ErrorContains(t, err, "service db not found")
+
+		require.NoError(t, os.Remove("compose.yaml"))
+		_, err = executeCommand("config", "import", "compose")
+		assert.ErrorContains(t, err, "no compose file found")
+	})
+
+	t.Run("imported tools run", func(t *testing.T) {
+		_, err := executeCommand("python", "-V")
+		require.NoError(t, err)
+		assert.Equal(t, "python:3.12", mock.CreatedConfig.Image)
+		assert.Equal(t, dir, mock.CreatedConfig.Volumes[0].HostPath)
+
+		require.NoError(t, os.MkdirAll("worker", 0755))
+		require.NoError(t, os.WriteFile("worker/Dockerfile", []byte("FROM alpine\n"), 0644))
+		output, err := executeCommand("--dry-run", "-f", "simple", "worker")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Build: "+filepath.Join(dir, "worker")+" (dockerfile Dockerfile)")
+	})
+
+	t.Run("import never writes host environment values", func(t *testing.T) {
+		t.Setenv("MY_SECRET_TOKEN", "hunter2")
+		require.NoError(t, os.WriteFile(".env", []byte("DB_PASSWORD=s3cr3t\n"), 0644))
+		require.NoError(t, os.WriteFile("compose.yaml", []byte(`
+services:
+  app:
+    image: alpine
+    environment:
+      - MY_SECRET_TOKEN
+      - DB_PASSWORD=${DB_PASSWORD}
+      - DB_URL=postgres://app:${DB_PASSWORD}@db/app
+    build:
+      context: .
+      args: [MY_SECRET_TOKEN]
+`), 0644))
+		require.NoError(t, os.Remove(".tools.yaml"))
+		_, err := executeCommand("config", "import", "compose")
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(".tools.yaml")
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "hunter2")
+		assert.NotContains(t, string(data), "s3cr3t")
+		assert.Contains(t, string(data), "- MY_SECRET_TOKEN\n")
+		assert.Contains(t, string(data), "- DB_PASSWORD\n")
+		assert.Contains(t, string(data), "- DB_URL=postgres://app:${DB_PASSWORD}@db/app\n")
+	})
+}
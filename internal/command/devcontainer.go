@@ -0,0 +1,111 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"cderun/internal/logging"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type devcontainerOptions struct {
+	config string
+}
+
+var devcontainerOpts = &devcontainerOptions{}
+
+var devcontainerCmd = &cobra.Command{
+	Use:   "devcontainer COMMAND [ARG...]",
+	Short: "Run a command in the environment of devcontainer.json",
+	Long: `Run a command in the container described by .devcontainer/devcontainer.json
+(or .devcontainer.json): its image or build, mounts, containerEnv, remoteUser,
+workspaceFolder, forwardPorts and the supported runArgs. The workspace is
+mounted at the workspace folder, like in VS Code. cderun flags go before the
+command, e.g. "cderun devcontainer --dry-run npm test".`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		toolsCfg, globalCfg := opts.loadConfigs()
+
+		tool, err := loadDevcontainerTool(devcontainerOpts.config)
+		if err != nil {
+			return toExitError(fmt.Errorf("configuration error: %w", err))
+		}
+		// The devcontainer replaces the tool's own entry for this run
+		merged := make(config.ToolsConfig, len(toolsCfg)+1)
+		for name, t := range toolsCfg {
+			merged[name] = t
+		}
+		merged[args[0]] = tool
+		return toExitError(runContainer(cmd, args[0], args[1:], merged, globalCfg))
+	},
+}
+
+// loadDevcontainer loads devcontainer.json from file, or from the default
+// locations when file is empty.
+func loadDevcontainer(file string) (*config.DevcontainerConfig, string, error) {
+	if file == "" {
+		found, err := config.FindDevcontainer()
+		if err != nil {
+			return nil, "", err
+		}
+		if found == "" {
+			return nil, "", fmt.Errorf("no devcontainer found (looked for %s)", strings.Join(config.DevcontainerPaths, ", "))
+		}
+		file = found
+	}
+	d, err := config.LoadDevcontainer(file)
+	if err != nil {
+		return nil, "", err
+	}
+	logging.Debug("Loaded devcontainer from: %s", file)
+	return d, file, nil
+}
+
+// loadDevcontainerTool loads devcontainer.json like loadDevcontainer and
+// returns it as a tool.
+func loadDevcontainerTool(file string) (config.ToolConfig, error) {
+	d, file, err := loadDevcontainer(file)
+	if err != nil {
+		return config.ToolConfig{}, err
+	}
+	tool, err := d.ToolConfig()
+	if err != nil {
+		return config.ToolConfig{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return tool, nil
+}
+
+// importDevcontainer converts devcontainer.json into a tool.
+func importDevcontainer(args []string) (config.ToolsConfig, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("devcontainer does not take service names")
+	}
+	d, file, err := loadDevcontainer(configImportOpts.config)
+	if err != nil {
+		return nil, err
+	}
+	// The tools file may be committed, so host environment values stay out of it
+	tool, err := d.ImportToolConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	name := configImportOpts.name
+	if name == "" {
+		name = strings.Trim(strings.ToLower(invalidNameChars.ReplaceAllString(d.Name, "-")), "-.")
+	}
+	if name == "" {
+		name = "dev"
+	}
+	return config.ToolsConfig{name: tool}, nil
+}
+
+func init() {
+	devcontainerCmd.Flags().StringVar(&devcontainerOpts.config, "config", "", "Path to devcontainer.json (default .devcontainer/devcontainer.json or .devcontainer.json)")
+	// Flags after the command belong to the command
+	devcontainerCmd.Flags().SetInterspersed(false)
+
+	rootCmd.AddCommand(devcontainerCmd)
+}
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"cderun/internal/container"
+	"cderun/internal/runtime"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevcontainer(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Chdir(oldWd)
+	})
+	exitFunc = func(int) {}
+
+	mock := &runtime.MockRuntime{CreatedContainerID: "c1"}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+
+	t.Run("no devcontainer", func(t *testing.T) {
+		_, err := executeCommand("devcontainer", "npm", "test")
+		assert.ErrorContains(t, err, "no devcontainer found")
+	})
+
+	require.NoError(t, os.MkdirAll(".devcontainer", 0755))
+	require.NoError(t, os.WriteFile(".devcontainer/devcontainer.json", []byte(`{
+	"name": "My App",
+	"image": "node:20",
+	"containerEnv": {"NODE_ENV": "development"},
+	"remoteUser": "node",
+	"forwardPorts": [3000],
+}`), 0644))
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("npm:\n  image: node:18\n"), 0644))
+	workspace := "/workspaces/" + filepath.Base(dir)
+
+	t.Run("runs the command in the devcontainer", func(t *testing.T) {
+		_, err := executeCommand("devcontainer", "npm", "test", "--watch")
+		require.NoError(t, err)
+		cfg := mock.CreatedConfig
+		require.NotNil(t, cfg)
+		assert.Equal(t, "node:20", cfg.Image, "the devcontainer replaces the tool's entry")
+		assert.Equal(t, []string{"npm"}, cfg.Command)
+		assert.Equal(t, []string{"test", "--watch"}, cfg.Args)
+		assert.Equal(t, workspace, cfg.Workdir)
+		assert.Equal(t, "node", cfg.User)
+		assert.Contains(t, cfg.Env, "NODE_ENV=development")
+		assert.Contains(t, cfg.Volumes, container.VolumeMount{HostPath: dir, ContainerPath: workspace})
+		require.Len(t, cfg.Ports, 1)
+		assert.Equal(t, "3000", cfg.Ports[0].HostPort)
+	})
+
+	t.Run("cderun flags", func(t *testing.T) {
+		output, err := executeCommand("devcontainer", "--dry-run", "-f", "simple", "npm", "--cderun-image=node:22")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Image: node:22")
+		assert.Contains(t, output, "User: node")
+		assert.Contains(t, output, "Command: npm\n")
+	})
+
+	t.Run("import", func(t *testing.T) {
+		output, err := executeCommand("config", "import", "devcontainer")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Added tool my-app to .tools.yaml")
+
+		data, err := os.ReadFile(".tools.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "npm:\n  image: node:18\nmy-app:\n"+
+			"  image: node:20\n"+
+			"  volumes:\n    - .:"+workspace+"\n"+
+			"  env:\n    - NODE_ENV=development\n"+
+			"  workdir: "+workspace+"\n"+
+			"  user: node\n"+
+			"  ports:\n    - 3000:3000\n", string(data))
+
+		_, err = executeCommand("config", "import", "devcontainer")
+		assert.ErrorContains(t, err, "use --force to replace it")
+
+		_, err = executeCommand("config", "import", "devcontainer", "--name", "app", "--output", "tools.yaml")
+		require.NoError(t, err)
+		assert.FileExists(t, "tools.yaml")
+
+		// The imported tool runs like the devcontainer
+		_, err = executeCommand("my-app", "node", "--version")
+		require.NoError(t, err)
+		assert.Equal(t, "node:20", mock.CreatedConfig.Image)
+		assert.Contains(t, mock.CreatedConfig.Volumes, container.VolumeMount{HostPath: dir, ContainerPath: workspace})
+	})
+
+	t.Run("import never writes host environment values", func(t *testing.T) {
+		t.Setenv("MY_SECRET_TOKEN", "hunter2")
+		t.Setenv("OTHER_SECRET", "s3cr3t")
+		require.NoError(t, os.WriteFile(".devcontainer/devcontainer.json", []byte(`{
+	"name": "secrets",
+	"image": "node:20",
+	"containerEnv": {"TOKEN": "${localEnv:MY_SECRET_TOKEN}", "MY_SECRET_TOKEN": "${localEnv:MY_SECRET_TOKEN}"},
+	"runArgs": ["-e", "OTHER_SECRET"]
+}`), 0644))
+
+		output, err := executeCommand("config", "import", "devcontainer", "--output", "secrets.yaml")
+		require.NoError(t, err)
+		assert.Contains(t, output, "${localEnv:MY_SECRET_TOKEN} is not expanded")
+
+		data, err := os.ReadFile("secrets.yaml")
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "hunter2")
+		assert.NotContains(t, string(data), "s3cr3t")
+		assert.Contains(t, string(data), "    - MY_SECRET_TOKEN\n")
+		assert.Contains(t, string(data), "    - OTHER_SECRET\n")
+
+		// Bare names are taken from the host when the tool runs
+		t.Setenv("CDERUN_TOOLS_FILE", "secrets.yaml")
+		_, err = executeCommand("secrets", "env")
+		require.NoError(t, err)
+		assert.Contains(t, mock.CreatedConfig.Env, "MY_SECRET_TOKEN=hunter2")
+		assert.Contains(t, mock.CreatedConfig.Env, "OTHER_SECRET=s3cr3t")
+	})
+
+	t.Run("unknown source", func(t *testing.T) {
+		_, err := executeCommand("config", "import", "vagrant")
+		assert.ErrorContains(t, err, `unknown import source "vagrant"`)
+	})
+}
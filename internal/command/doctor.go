@@ -0,0 +1,354 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"cderun/internal/runtime"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// minAPIVersion is the oldest Docker API version cderun is tested with (Docker 20.10).
+const minAPIVersion = "1.41"
+
+var versionCmd = &cobra.Command{
+	Use:          "version",
+	Short:        "Show the version of cderun",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		ver, details := buildInfo()
+		fmt.Fprintf(out, "cderun version %s\n", ver)
+		w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+		for _, d := range details {
+			fmt.Fprintf(w, "%s:\t%s\n", d[0], d[1])
+		}
+		return w.Flush()
+	},
+}
+
+var infoCmd = &cobra.Command{
+	Use:          "info",
+	Short:        "Show the runtime and configuration cderun uses",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		ver, _ := buildInfo()
+		globalCfg, globalPath, globalErr := config.LoadCDERunConfig()
+		toolsCfg, toolsPath, toolsErr := config.LoadToolsConfig()
+		name, socket := opts.resolveRuntime(cmd, globalCfg)
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 1, ' ', 0)
+		fmt.Fprintf(w, "Version:\t%s\n", ver)
+		fmt.Fprintf(w, "Runtime:\t%s\n", name)
+		fmt.Fprintf(w, "Socket:\t%s\n", socket)
+		fmt.Fprintf(w, "Cderun config:\t%s\n", describeConfigFile(globalPath, globalErr, ""))
+		fmt.Fprintf(w, "Tools config:\t%s\n", describeConfigFile(toolsPath, toolsErr, fmt.Sprintf(" (%d tools)", len(toolsCfg))))
+		return w.Flush()
+	},
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment cderun runs in",
+	Long: `Check the environment cderun runs in: the configuration files, the runtime
+socket and daemon, the images of the tools, and PATH collisions between
+cderun links and host binaries. Exits non-zero if a check fails.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		r := &doctorReport{out: cmd.OutOrStdout()}
+
+		globalCfg, globalPath, err := config.LoadCDERunConfig()
+		if err != nil {
+			r.fail(err.Error(), "Fix or remove the file")
+		} else {
+			r.ok("Cderun config: %s", describeConfigFile(globalPath, nil, ""))
+		}
+		toolsCfg, toolsPath, err := config.LoadToolsConfig()
+		if err != nil {
+			r.fail(err.Error(), "Fix or remove the file")
+		} else {
+			r.ok("Tools config: %s", describeConfigFile(toolsPath, nil, fmt.Sprintf(" (%d tools)", len(toolsCfg))))
+		}
+
+		name, socket := opts.resolveRuntime(cmd, globalCfg)
+		if r.checkSocket(name, socket) {
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+			if rt := r.checkDaemon(ctx, name, socket); rt != nil {
+				r.checkImages(ctx, cmd, rt, toolsCfg, globalCfg)
+			}
+		}
+		r.checkPath(toolsCfg)
+
+		fmt.Fprintf(r.out, "\n%d failed, %d warnings\n", r.failures, r.warnings)
+		if r.failures > 0 {
+			cmd.SilenceUsage = true // The report already says what to do
+			return fmt.Errorf("%d of the checks failed", r.failures)
+		}
+		return nil
+	},
+}
+
+// version is set at build time with -ldflags "-X cderun/internal/command.version=...".
+// Use cderunVersion, which falls back to the module version.
+var version = "dev"
+
+// cderunVersion returns the version of cderun. It is set with -ldflags, or
+// taken from the module version for "go install".
+func cderunVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// buildInfo returns the version of cderun and details about the build.
+func buildInfo() (string, [][2]string) {
+	details := [][2]string{}
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		settings := map[string]string{}
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if rev := settings["vcs.revision"]; rev != "" {
+			if settings["vcs.modified"] == "true" {
+				rev += " (modified)"
+			}
+			details = append(details, [2]string{"Commit", rev})
+		}
+		if t := settings["vcs.time"]; t != "" {
+			details = append(details, [2]string{"Commit time", t})
+		}
+		details = append(details, [2]string{"Go version", info.GoVersion})
+	}
+	details = append(details, [2]string{"Platform", goruntime.GOOS + "/" + goruntime.GOARCH})
+	return cderunVersion(), details
+}
+
+func describeConfigFile(path string, err error, suffix string) string {
+	switch {
+	case err != nil:
+		return "error: " + err.Error()
+	case path == "":
+		return "none"
+	default:
+		return path + suffix
+	}
+}
+
+// doctorReport prints the results of the checks of "cderun doctor".
+type doctorReport struct {
+	out      io.Writer
+	warnings int
+	failures int
+}
+
+func (r *doctorReport) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "[ok]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(msg, hint string) {
+	r.warnings++
+	fmt.Fprintf(r.out, "[warn] %s\n       %s\n", msg, hint)
+}
+
+func (r *doctorReport) fail(msg, hint string) {
+	r.failures++
+	fmt.Fprintf(r.out, "[fail] %s\n       %s\n", msg, hint)
+}
+
+// checkSocket checks that the runtime socket exists and can be connected to.
+func (r *doctorReport) checkSocket(name, socket string) bool {
+	info, err := os.Stat(socket)
+	if os.IsNotExist(err) {
+		r.fail(fmt.Sprintf("Socket %s does not exist", socket),
+			fmt.Sprintf("Start the %s daemon, or set the socket with --mount-socket or CDERUN_MOUNT_SOCKET", name))
+		return false
+	}
+	if err != nil {
+		r.fail(fmt.Sprintf("Cannot access socket %s: %v", socket, err), "Check the permissions of the socket and its directories")
+		return false
+	}
+
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrPermission):
+			r.fail(fmt.Sprintf("Permission denied on socket %s", socket),
+				"Add your user to the docker group (sudo usermod -aG docker $USER) and log in again, or use a rootless daemon")
+		case info.Mode()&os.ModeSocket == 0:
+			r.fail(fmt.Sprintf("%s is not a socket", socket), "Set the socket with --mount-socket or CDERUN_MOUNT_SOCKET")
+		default:
+			r.fail(fmt.Sprintf("Cannot connect to socket %s: %v", socket, err), fmt.Sprintf("Start the %s daemon", name))
+		}
+		return false
+	}
+	conn.Close()
+	r.ok("Socket %s is reachable", socket)
+	return true
+}
+
+// checkDaemon checks the version of the daemon and reports whether it runs
+// rootless. It returns nil if the daemon cannot be used.
+func (r *doctorReport) checkDaemon(ctx context.Context, name, socket string) runtime.ContainerRuntime {
+	rt, err := runtimeFactory(name, socket)
+	if err != nil {
+		r.fail(fmt.Sprintf("Cannot initialize runtime %s: %v", name, err), "Use --runtime docker or set runtime in .cderun.yaml")
+		return nil
+	}
+	info, err := rt.Info(ctx)
+	if err != nil {
+		r.fail(fmt.Sprintf("Daemon is not responding: %v", err), fmt.Sprintf("Check that the %s daemon is running", name))
+		return nil
+	}
+	if olderAPIVersion(info.APIVersion, minAPIVersion) {
+		r.fail(fmt.Sprintf("Daemon API version %s is older than %s", info.APIVersion, minAPIVersion),
+			"Upgrade to Docker 20.10 or later")
+		return nil
+	}
+	r.ok("Daemon %s %s (API %s, %s/%s)", name, info.ServerVersion, info.APIVersion, info.OS, info.Arch)
+	if info.Rootless {
+		r.ok("Rootless mode: yes")
+	} else {
+		r.ok("Rootless mode: no")
+	}
+	return rt
+}
+
+// checkImages checks that every tool resolves and whether its image exists
+// locally. Missing images are only a warning since they are pulled or built on
+// the first run.
+func (r *doctorReport) checkImages(ctx context.Context, cmd *cobra.Command, rt runtime.ContainerRuntime, toolsCfg config.ToolsConfig, globalCfg *config.CDERunConfig) {
+	names := make([]string, 0, len(toolsCfg))
+	for name := range toolsCfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		resolved, err := opts.resolveSettings(cmd, name, toolsCfg, globalCfg)
+		if err != nil {
+			r.fail(fmt.Sprintf("Tool %s: %v", name, err), "Fix the tool in the tools config")
+			continue
+		}
+		image := resolved.Image
+		built := resolved.Build != nil || len(resolved.Packages) > 0
+		if built {
+			if _, image, err = buildSpec(resolved, name); err != nil {
+				r.fail(fmt.Sprintf("Tool %s: %v", name, err), "Fix the build section or packages of the tool")
+				continue
+			}
+		}
+		exists, err := rt.ImageExists(ctx, image)
+		switch {
+		case err != nil:
+			r.fail(fmt.Sprintf("Tool %s: failed to inspect image %s: %v", name, image, err), "Check the image reference")
+		case exists:
+			r.ok("Tool %s: image %s", name, image)
+		case built:
+			r.warn(fmt.Sprintf("Tool %s: image %s is not built yet", name, image),
+				fmt.Sprintf("It is built on the first run of %s", name))
+		default:
+			r.warn(fmt.Sprintf("Tool %s: image %s is not present locally", name, image),
+				fmt.Sprintf("It is pulled on the first run, or pull it now with: docker pull %s", image))
+		}
+	}
+}
+
+// checkPath looks for tools that are both a cderun link and a host binary on
+// PATH. Only the first one on PATH runs.
+func (r *doctorReport) checkPath(toolsCfg config.ToolsConfig) {
+	names := make([]string, 0, len(toolsCfg))
+	for name := range toolsCfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	collisions := 0
+	for _, name := range names {
+		var link, host string
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			if dir == "" {
+				continue
+			}
+			path, err := exec.LookPath(filepath.Join(expandHome(dir), name))
+			if err != nil {
+				continue
+			}
+			if isCderunLink(path) {
+				if link == "" {
+					link = path
+				}
+			} else if host == "" {
+				host = path
+			}
+			if link != "" && host != "" {
+				break
+			}
+		}
+		if link == "" || host == "" {
+			continue
+		}
+
+		collisions++
+		if pathIndex(host) < pathIndex(link) {
+			r.fail(fmt.Sprintf("%s: the host binary %s comes before the cderun link %s on PATH", name, host, link),
+				fmt.Sprintf("Put %s before %s in PATH, or remove the link with: cderun uninstall --dir %s %s",
+					filepath.Dir(link), filepath.Dir(host), filepath.Dir(link), name))
+		} else {
+			r.warn(fmt.Sprintf("%s: the cderun link %s hides the host binary %s", name, link, host),
+				fmt.Sprintf("This is expected after cderun install --force; to use the host binary run: cderun uninstall --dir %s %s",
+					filepath.Dir(link), name))
+		}
+	}
+	if collisions == 0 {
+		r.ok("No PATH collisions between cderun links and host binaries")
+	}
+}
+
+// pathIndex returns the position of the directory of path in PATH.
+func pathIndex(path string) int {
+	dir := filepath.Dir(path)
+	for i, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(expandHome(p)) == dir {
+			return i
+		}
+	}
+	return -1
+}
+
+// olderAPIVersion reports whether the API version v (e.g. "1.41") is older than min.
+func olderAPIVersion(v, min string) bool {
+	parse := func(s string) (int, int) {
+		major, minor, _ := strings.Cut(s, ".")
+		a, _ := strconv.Atoi(major)
+		b, _ := strconv.Atoi(minor)
+		return a, b
+	}
+	vMajor, vMinor := parse(v)
+	minMajor, minMinor := parse(min)
+	return vMajor < minMajor || (vMajor == minMajor && vMinor < minMinor)
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd, infoCmd, doctorCmd)
+}
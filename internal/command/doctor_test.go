@@ -0,0 +1,134 @@
+package command
+
+import (
+	"cderun/internal/runtime"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionAndInfo(t *testing.T) {
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(oldWd) })
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Setenv("HOME", t.TempDir())
+
+	out, err := executeCommand("version")
+	require.NoError(t, err)
+	assert.Contains(t, out, "cderun version ")
+	assert.Contains(t, out, "Platform:")
+
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("node:\n  image: node:20\njq:\n  image: jq\n"), 0644))
+	t.Setenv("CDERUN_MOUNT_SOCKET", "unix:///run/user/1000/docker.sock")
+	out, err = executeCommand("info")
+	require.NoError(t, err)
+	assert.Regexp(t, `Runtime: +docker\n`, out)
+	assert.Regexp(t, `Socket: +/run/user/1000/docker.sock\n`, out)
+	assert.Regexp(t, `Cderun config: +none\n`, out)
+	assert.Regexp(t, `Tools config: +\.tools\.yaml \(2 tools\)\n`, out)
+}
+
+func TestDoctor(t *testing.T) {
+	oldWd, _ := os.Getwd()
+	oldFactory := runtimeFactory
+	t.Cleanup(func() {
+		os.Chdir(oldWd)
+		runtimeFactory = oldFactory
+	})
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("PATH", "")
+
+	mock := &runtime.MockRuntime{
+		RuntimeInfo: &runtime.RuntimeInfo{ServerVersion: "27.3.1", APIVersion: "1.47", OS: "linux", Arch: "amd64", Rootless: true},
+		Images:      map[string]bool{"node:20": true},
+	}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("node:\n  image: node:20\njq:\n  image: jq\nlint:\n  build: ./lint\n"), 0644))
+	require.NoError(t, os.MkdirAll("lint", 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("lint", "Dockerfile"), []byte("FROM alpine\n"), 0644))
+
+	t.Run("missing socket", func(t *testing.T) {
+		t.Setenv("CDERUN_MOUNT_SOCKET", filepath.Join(dir, "missing.sock"))
+		out, err := executeCommand("doctor")
+		assert.ErrorContains(t, err, "1 of the checks failed")
+		assert.Contains(t, out, "[fail] Socket "+filepath.Join(dir, "missing.sock")+" does not exist\n       Start the docker daemon")
+		assert.NotContains(t, out, "Usage:")
+	})
+
+	// Unix socket paths are limited to about 100 bytes
+	sockDir, err := os.MkdirTemp("", "cderun")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(sockDir) })
+	socket := filepath.Join(sockDir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	t.Setenv("CDERUN_MOUNT_SOCKET", socket)
+
+	t.Run("daemon and images", func(t *testing.T) {
+		out, err := executeCommand("doctor")
+		require.NoError(t, err, out)
+		assert.Contains(t, out, "[ok]   Socket "+socket+" is reachable")
+		assert.Contains(t, out, "[ok]   Daemon docker 27.3.1 (API 1.47, linux/amd64)")
+		assert.Contains(t, out, "[ok]   Rootless mode: yes")
+		assert.Contains(t, out, "[ok]   Tool node: image node:20")
+		assert.Contains(t, out, "[warn] Tool jq: image jq is not present locally\n       It is pulled on the first run, or pull it now with: docker pull jq")
+		assert.Regexp(t, `\[warn\] Tool lint: image cderun/lint:[0-9a-f]{12} is not built yet`, out)
+		assert.Contains(t, out, "0 failed, 2 warnings")
+	})
+
+	t.Run("old daemon", func(t *testing.T) {
+		mock.RuntimeInfo = &runtime.RuntimeInfo{ServerVersion: "19.03.1", APIVersion: "1.40"}
+		t.Cleanup(func() { mock.RuntimeInfo = nil })
+		out, err := executeCommand("doctor")
+		assert.Error(t, err)
+		assert.Contains(t, out, "[fail] Daemon API version 1.40 is older than 1.41")
+		assert.NotContains(t, out, "Tool node")
+	})
+
+	t.Run("daemon not responding", func(t *testing.T) {
+		mock.InfoErr = errors.New("connection reset")
+		t.Cleanup(func() { mock.InfoErr = nil })
+		out, err := executeCommand("doctor")
+		assert.Error(t, err)
+		assert.Contains(t, out, "[fail] Daemon is not responding: connection reset")
+	})
+
+	t.Run("PATH collisions", func(t *testing.T) {
+		exe, err := cderunExecutable()
+		require.NoError(t, err)
+		links := filepath.Join(dir, "links")
+		host := filepath.Join(dir, "host")
+		require.NoError(t, os.MkdirAll(links, 0755))
+		require.NoError(t, os.MkdirAll(host, 0755))
+		for _, tool := range []string{"node", "jq"} {
+			require.NoError(t, os.Symlink(exe, filepath.Join(links, tool)))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(host, "node"), []byte("#!/bin/sh\n"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "jq"), []byte("#!/bin/sh\n"), 0755))
+		t.Setenv("PATH", host+string(os.PathListSeparator)+links+string(os.PathListSeparator)+dir)
+
+		out, err := executeCommand("doctor")
+		assert.ErrorContains(t, err, "1 of the checks failed")
+		assert.Contains(t, out, "[fail] node: the host binary "+filepath.Join(host, "node")+" comes before the cderun link "+filepath.Join(links, "node")+" on PATH")
+		assert.Contains(t, out, "cderun uninstall --dir "+links+" node")
+		assert.Contains(t, out, "[warn] jq: the cderun link "+filepath.Join(links, "jq")+" hides the host binary "+filepath.Join(dir, "jq"))
+	})
+}
+
+func TestOlderAPIVersion(t *testing.T) {
+	assert.True(t, olderAPIVersion("1.40", "1.41"))
+	assert.True(t, olderAPIVersion("0.99", "1.41"))
+	assert.False(t, olderAPIVersion("1.41", "1.41"))
+	assert.False(t, olderAPIVersion("1.100", "1.41"))
+	assert.False(t, olderAPIVersion("2.0", "1.41"))
+}
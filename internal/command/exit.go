@@ -0,0 +1,46 @@
+package command
+
+import (
+	"cderun/internal/runtime"
+	"errors"
+)
+
+// Exit codes for failures of cderun itself, following "docker run".
+const (
+	exitCodeCderunError   = 125 // cderun or the container runtime failed
+	exitCodeNotExecutable = 126 // The command cannot be executed
+	exitCodeNotFound      = 127 // The command does not exist in the image
+)
+
+// ExitError is an error that makes cderun exit with a specific code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// toExitError maps an error that occurred while running a tool to an ExitError.
+func toExitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	code := exitCodeCderunError
+	switch {
+	case errors.Is(err, runtime.ErrCommandNotFound):
+		code = exitCodeNotFound
+	case errors.Is(err, runtime.ErrCommandNotExecutable):
+		code = exitCodeNotExecutable
+	}
+	return &ExitError{Code: code, Err: err}
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"cderun/internal/container"
+	"cderun/internal/logging"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+)
+
+const (
+	// containerSSHAuthSock is where the host SSH agent socket is mounted inside the container.
+	containerSSHAuthSock = "/run/ssh-agent.sock"
+	// dockerDesktopSSHAuthSock is the agent socket Docker Desktop exposes to containers on macOS.
+	dockerDesktopSSHAuthSock = "/run/host-services/ssh-auth.sock"
+)
+
+// forwardSSHAgent bind-mounts the host SSH agent socket and points SSH_AUTH_SOCK at it.
+// The runtime name and socket select Docker Desktop's agent proxy on macOS.
+func forwardSSHAgent(volumes []container.VolumeMount, env []string, runtimeName, socket string) ([]container.VolumeMount, []string) {
+	hostSock := os.Getenv("SSH_AUTH_SOCK")
+	if hostSock == "" {
+		logging.Warn("SSH agent forwarding requested but SSH_AUTH_SOCK is not set")
+		return volumes, env
+	}
+	if goruntime.GOOS == "darwin" && isDockerDesktop(runtimeName, socket) {
+		// Host sockets cannot be shared through the Docker Desktop VM; use its built-in proxy instead.
+		hostSock = dockerDesktopSSHAuthSock
+	}
+
+	volumes = append(volumes, container.VolumeMount{
+		HostPath:      hostSock,
+		ContainerPath: containerSSHAuthSock,
+		ReadOnly:      false, // Socket needs to be writable
+	})
+
+	for i, e := range env {
+		if strings.SplitN(e, "=", 2)[0] == "SSH_AUTH_SOCK" {
+			env[i] = "SSH_AUTH_SOCK=" + containerSSHAuthSock
+			return volumes, env
+		}
+	}
+	return volumes, append(env, "SSH_AUTH_SOCK="+containerSSHAuthSock)
+}
+
+// isDockerDesktop reports whether the runtime socket belongs to Docker Desktop,
+// whose socket lives in ~/.docker/run or its application data. Other engines
+// such as Colima or OrbStack do not provide dockerDesktopSSHAuthSock.
+func isDockerDesktop(runtimeName, socket string) bool {
+	if runtimeName != "docker" || socket == "" {
+		return false
+	}
+	// /var/run/docker.sock is a symlink to the Docker Desktop socket
+	if target, err := filepath.EvalSymlinks(socket); err == nil {
+		socket = target
+	}
+	socket = filepath.ToSlash(socket)
+	return strings.Contains(socket, "/.docker/run/") || strings.Contains(socket, "/com.docker.docker/")
+}
+
+// forwardGitConfig mounts the user's git configuration and SSH known hosts read-only.
+// System-wide locations are used as targets so they apply regardless of the container user.
+func forwardGitConfig(volumes []container.VolumeMount) []container.VolumeMount {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		logging.Warn("failed to locate home directory for git config forwarding: %v", err)
+		return volumes
+	}
+
+	files := []struct {
+		host      string
+		container string
+	}{
+		{filepath.Join(home, ".gitconfig"), "/etc/gitconfig"},
+		{filepath.Join(home, ".ssh", "known_hosts"), "/etc/ssh/ssh_known_hosts"},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.host); err != nil {
+			logging.Debug("Skipping %s: %v", f.host, err)
+			continue
+		}
+		volumes = append(volumes, container.VolumeMount{
+			HostPath:      f.host,
+			ContainerPath: f.container,
+			ReadOnly:      true,
+		})
+	}
+	return volumes
+}
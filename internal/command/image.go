@@ -0,0 +1,87 @@
+package command
+
+import (
+	"bytes"
+	"cderun/internal/build"
+	"cderun/internal/config"
+	"cderun/internal/container"
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// buildSpec converts the build section or the packages of a tool and returns the
+// image reference it is tagged with: the repository of the tool's image (default
+// cderun/<tool>) and the first 12 characters of the hash of the build inputs.
+// An image with packages is derived from the tool's image and always tagged
+// in cderun/<tool>.
+func buildSpec(resolved *config.ResolvedConfig, tool string) (*container.BuildSpec, string, error) {
+	var spec *container.BuildSpec
+	repo := imageRepository(resolved.Image)
+	if resolved.Build != nil {
+		spec = &container.BuildSpec{
+			Context:    resolved.Build.Context,
+			Dockerfile: resolved.Build.Dockerfile,
+			Args:       resolved.Build.Args,
+			Target:     resolved.Build.Target,
+		}
+	} else {
+		dockerfile, err := build.PackagesDockerfile(resolved.Image, resolved.PackageManager, resolved.Packages)
+		if err != nil {
+			return nil, "", err
+		}
+		spec = &container.BuildSpec{Dockerfile: "Dockerfile", Inline: dockerfile}
+		repo = ""
+	}
+	hash, err := build.Hash(spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if repo == "" {
+		repo = "cderun/" + strings.ToLower(invalidNameChars.ReplaceAllString(tool, "-"))
+	}
+	return spec, repo + ":" + hash[:12], nil
+}
+
+// imageRepository strips the tag and digest from an image reference, e.g.
+// "localhost:5000/lint:1.0" becomes "localhost:5000/lint".
+func imageRepository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// ensureImage builds the image of a tool with a build section unless it exists
+// already. Since the tag contains the hash of the build inputs, an existing image
+// is up to date. The build output is shown with --verbose, or when the build fails.
+func ensureImage(ctx context.Context, rt runtime.ContainerRuntime, cfg *container.ContainerConfig, verbose bool) error {
+	exists, err := rt.ImageExists(ctx, cfg.Image)
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", cfg.Image, err)
+	}
+	if exists {
+		logging.Debug("Image %s is up to date", cfg.Image)
+		return nil
+	}
+
+	logging.Info("Building image %s", cfg.Image)
+	var buffered bytes.Buffer
+	var output io.Writer = &buffered
+	if verbose {
+		output = os.Stderr
+	}
+	if err := rt.BuildImage(ctx, cfg.Build, cfg.Image, output); err != nil {
+		os.Stderr.Write(buffered.Bytes())
+		return fmt.Errorf("failed to build image %s: %w", cfg.Image, err)
+	}
+	return nil
+}
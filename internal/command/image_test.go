@@ -0,0 +1,155 @@
+package command
+
+import (
+	"cderun/internal/runtime"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildImage(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Chdir(oldWd)
+	})
+	exitFunc = func(int) {}
+
+	mock := &runtime.MockRuntime{CreatedContainerID: "c1", BuildOutput: "Step 1/2 : FROM golang\n"}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+	require.NoError(t, os.MkdirAll("tools/lint", 0755))
+	require.NoError(t, os.WriteFile("tools/lint/Dockerfile", []byte("FROM golang\nRUN go install lint\n"), 0644))
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("golint:\n  build:\n    context: tools/lint\n    args:\n      VERSION: \"1.0\"\n"), 0644))
+
+	tagPattern := regexp.MustCompile(`^cderun/golint:[0-9a-f]{12}$`)
+	var firstTag string
+
+	t.Run("builds a missing image", func(t *testing.T) {
+		output, err := executeCommand("golint", "./...")
+		require.NoError(t, err)
+		require.Len(t, mock.BuiltTags, 1)
+		firstTag = mock.BuiltTags[0]
+		assert.Regexp(t, tagPattern, firstTag)
+		assert.Equal(t, firstTag, mock.CreatedConfig.Image)
+		assert.Equal(t, filepath.Join(dir, "tools", "lint"), mock.BuiltSpecs[0].Context)
+		assert.Equal(t, map[string]string{"VERSION": "1.0"}, mock.BuiltSpecs[0].Args)
+		assert.Contains(t, output, "Building image "+firstTag)
+		assert.NotContains(t, output, "Step 1/2", "build output is only shown with --verbose")
+	})
+
+	t.Run("reuses the image while the inputs are unchanged", func(t *testing.T) {
+		_, err := executeCommand("golint", "./...")
+		require.NoError(t, err)
+		assert.Len(t, mock.BuiltTags, 1)
+		assert.Equal(t, firstTag, mock.CreatedConfig.Image)
+	})
+
+	t.Run("rebuilds when the context changes", func(t *testing.T) {
+		require.NoError(t, os.WriteFile("tools/lint/.golangci.yml", []byte("linters: {}\n"), 0644))
+		output, err := executeCommand("--verbose", "golint", "./...")
+		require.NoError(t, err)
+		require.Len(t, mock.BuiltTags, 2)
+		assert.NotEqual(t, firstTag, mock.BuiltTags[1])
+		assert.Contains(t, output, "Step 1/2", "--verbose streams the build output")
+	})
+
+	t.Run("dry-run shows the tag without building", func(t *testing.T) {
+		output, err := executeCommand("--dry-run", "-f", "simple", "golint")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Image: "+mock.BuiltTags[1])
+		assert.Contains(t, output, "Build: "+filepath.Join(dir, "tools", "lint")+" (dockerfile Dockerfile)")
+		assert.Len(t, mock.BuiltTags, 2)
+	})
+
+	t.Run("failed build shows the output", func(t *testing.T) {
+		require.NoError(t, os.WriteFile("tools/lint/Dockerfile", []byte("FROM golang\nRUN false\n"), 0644))
+		mock.BuildErr = errors.New("The command '/bin/sh -c false' returned a non-zero code: 1")
+		defer func() { mock.BuildErr = nil }()
+		mock.CreatedConfig = nil
+
+		output, err := executeCommand("golint")
+		assert.ErrorContains(t, err, "failed to build image")
+		assert.Contains(t, output, "Step 1/2")
+		assert.Nil(t, mock.CreatedConfig)
+	})
+
+	t.Run("image sets the repository", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte("golint:\n  image: registry.local:5000/lint:latest\n  build: tools/lint\n"), 0644))
+		_, err := executeCommand("golint")
+		require.NoError(t, err)
+		assert.Regexp(t, `^registry.local:5000/lint:[0-9a-f]{12}$`, mock.CreatedConfig.Image)
+	})
+}
+
+func TestPackagesImage(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Chdir(oldWd)
+	})
+	exitFunc = func(int) {}
+
+	mock := &runtime.MockRuntime{CreatedContainerID: "c1"}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	require.NoError(t, os.Chdir(t.TempDir()))
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("node:\n  image: node:20\n  packages: [jq, git]\n  packageManager: apt\n"), 0644))
+
+	tagPattern := regexp.MustCompile(`^cderun/node:[0-9a-f]{12}$`)
+
+	t.Run("builds the derived image once", func(t *testing.T) {
+		_, err := executeCommand("node", "index.js")
+		require.NoError(t, err)
+		require.Len(t, mock.BuiltTags, 1)
+		assert.Regexp(t, tagPattern, mock.BuiltTags[0])
+		assert.Equal(t, mock.BuiltTags[0], mock.CreatedConfig.Image)
+		assert.Empty(t, mock.BuiltSpecs[0].Context)
+		assert.Contains(t, mock.BuiltSpecs[0].Inline, "FROM node:20\n")
+		assert.Contains(t, mock.BuiltSpecs[0].Inline, "--no-install-recommends jq git")
+
+		_, err = executeCommand("node", "index.js")
+		require.NoError(t, err)
+		assert.Len(t, mock.BuiltTags, 1)
+	})
+
+	t.Run("dry-run shows the build steps", func(t *testing.T) {
+		output, err := executeCommand("--dry-run", "-f", "simple", "node")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Image: "+mock.BuiltTags[0])
+		assert.Contains(t, output, "Build steps:\n  FROM node:20\n  RUN apt-get update")
+	})
+
+	t.Run("packages apply to the image given with --image", func(t *testing.T) {
+		_, err := executeCommand("--image", "node:22", "node")
+		require.NoError(t, err)
+		require.Len(t, mock.BuiltTags, 2)
+		assert.Regexp(t, tagPattern, mock.BuiltTags[1])
+		assert.NotEqual(t, mock.BuiltTags[0], mock.BuiltTags[1])
+		assert.Contains(t, mock.BuiltSpecs[1].Inline, "FROM node:22\n")
+	})
+
+	t.Run("invalid package", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte("node:\n  image: node:20\n  packages: [\"jq; curl evil\"]\n"), 0644))
+		_, err := executeCommand("node")
+		assert.ErrorContains(t, err, "invalid package name")
+	})
+}
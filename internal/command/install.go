@@ -0,0 +1,257 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// shimMarker identifies the shims written by "cderun install --shim" and
+// "cderun shell-hook".
+const shimMarker = "# Generated by cderun"
+
+type installOptions struct {
+	dir   string
+	shim  bool
+	force bool
+}
+
+var installOpts = &installOptions{}
+
+var installCmd = &cobra.Command{
+	Use:   "install [TOOL...]",
+	Short: "Create symlinks or shims for the tools in .tools.yaml",
+	Long: `Create a symlink to cderun (or, with --shim, a small shell script calling
+cderun) for every tool in .tools.yaml, or for the given tools, so that running
+the tool name runs it in a container.
+
+Tools that are also found on PATH as a real host binary are skipped unless
+--force is given, since one of them would shadow the other. Files in the
+directory that are not cderun links are never replaced.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		toolsCfg, _ := opts.loadConfigs()
+
+		tools := args
+		if len(tools) == 0 {
+			for name := range toolsCfg {
+				tools = append(tools, name)
+			}
+			sort.Strings(tools)
+		}
+		if len(tools) == 0 {
+			return fmt.Errorf("no tools defined in .tools.yaml")
+		}
+		for _, tool := range tools {
+			if _, ok := toolsCfg[tool]; !ok {
+				return fmt.Errorf("tool %q not found in tools config", tool)
+			}
+		}
+
+		exe, err := cderunExecutable()
+		if err != nil {
+			return err
+		}
+		dir := expandHome(installOpts.dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+
+		out := cmd.OutOrStdout()
+		skipped := 0
+		for _, tool := range tools {
+			if !installTool(out, dir, tool, exe) {
+				skipped++
+			}
+		}
+		if !inPath(dir) {
+			fmt.Fprintf(out, "Note: %s is not in PATH\n", dir)
+		}
+		if skipped > 0 {
+			return fmt.Errorf("%d of %d tools were not installed", skipped, len(tools))
+		}
+		return nil
+	},
+}
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall [TOOL...]",
+	Short: "Remove the symlinks and shims created by cderun install",
+	Long: `Remove the symlinks and shims created by "cderun install" for the given
+tools, or all of them in the directory. Files that do not point at cderun are
+left alone.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := expandHome(installOpts.dir)
+		names := args
+		if len(names) == 0 {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", dir, err)
+			}
+			for _, e := range entries {
+				if isCderunLink(filepath.Join(dir, e.Name())) {
+					names = append(names, e.Name())
+				}
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				fmt.Fprintf(out, "%s is not installed\n", name)
+				continue
+			}
+			if !isCderunLink(path) {
+				fmt.Fprintf(out, "Leaving %s, it does not point at cderun\n", path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			fmt.Fprintf(out, "Removed %s\n", path)
+		}
+		return nil
+	},
+}
+
+// installTool creates the link or shim for a tool and reports what it did. It
+// returns false if the tool was skipped.
+func installTool(out io.Writer, dir, tool, exe string) bool {
+	path := filepath.Join(dir, tool)
+	if _, err := os.Lstat(path); err == nil && !isCderunLink(path) {
+		fmt.Fprintf(out, "Skipping %s: %s exists and does not point at cderun\n", tool, path)
+		return false
+	}
+	if host := hostBinary(tool, dir); host != "" {
+		if !installOpts.force {
+			fmt.Fprintf(out, "Skipping %s: %s is already on PATH (use --force to install anyway)\n", tool, host)
+			return false
+		}
+		fmt.Fprintf(out, "Warning: %s conflicts with %s, the one first on PATH wins\n", tool, host)
+	}
+
+	// Replace our own link, e.g. when switching between symlinks and shims
+	_ = os.Remove(path)
+	if installOpts.shim {
+		if err := writeShim(path, exe, tool, nil); err != nil {
+			fmt.Fprintf(out, "Skipping %s: %v\n", tool, err)
+			return false
+		}
+		fmt.Fprintf(out, "Installed %s (shim for %s)\n", path, exe)
+		return true
+	}
+	if err := os.Symlink(exe, path); err != nil {
+		fmt.Fprintf(out, "Skipping %s: %v\n", tool, err)
+		return false
+	}
+	fmt.Fprintf(out, "Installed %s -> %s\n", path, exe)
+	return true
+}
+
+// writeShim writes a shell script running tool with cderun and the given
+// NAME=VALUE environment variables.
+func writeShim(path, exe, tool string, vars []string) error {
+	env := ""
+	for _, v := range vars {
+		name, value, _ := strings.Cut(v, "=")
+		env += name + "=" + shellQuote(value) + " "
+	}
+	// "--" keeps tools named like a cderun command (e.g. "ps") a tool
+	script := fmt.Sprintf("#!/bin/sh\n%s\n%sexec %s -- %s \"$@\"\n", shimMarker, env, shellQuote(exe), shellQuote(tool))
+	return os.WriteFile(path, []byte(script), 0755)
+}
+
+// cderunExecutable returns the path of the running binary with symlinks
+// resolved, so links do not point at another link.
+func cderunExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+// isCderunLink reports whether path is a symlink to cderun (the running binary
+// or any file named cderun) or a shim written by cderun.
+func isCderunLink(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false
+		}
+		if strings.TrimSuffix(filepath.Base(target), ".exe") == "cderun" {
+			return true
+		}
+		exe, err := cderunExecutable()
+		resolved, rerr := filepath.EvalSymlinks(path)
+		return err == nil && rerr == nil && resolved == exe
+	}
+	if !info.Mode().IsRegular() || info.Size() > 4096 {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(data), "\n"+shimMarker+"\n")
+}
+
+// hostBinary returns the first executable named tool on PATH that is not a
+// cderun link, skipping the install directory itself.
+func hostBinary(tool, dir string) string {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if p == "" || filepath.Clean(expandHome(p)) == filepath.Clean(dir) {
+			continue
+		}
+		path, err := exec.LookPath(filepath.Join(p, tool))
+		if err != nil || isCderunLink(path) {
+			continue
+		}
+		return path
+	}
+	return ""
+}
+
+func inPath(dir string) bool {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(expandHome(p)) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func init() {
+	for _, c := range []*cobra.Command{installCmd, uninstallCmd} {
+		c.Flags().StringVar(&installOpts.dir, "dir", "~/.local/bin", "Directory for the links")
+	}
+	installCmd.Flags().BoolVar(&installOpts.shim, "shim", false, "Write shell scripts instead of symlinks")
+	installCmd.Flags().BoolVar(&installOpts.force, "force", false, "Install tools that are also found on PATH")
+
+	rootCmd.AddCommand(installCmd, uninstallCmd)
+}
@@ -0,0 +1,94 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstall(t *testing.T) {
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(oldWd) })
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("node:\n  image: node:20\npython:\n  image: python:3.12\nps:\n  image: alpine\n"), 0644))
+
+	bin := filepath.Join(dir, "bin")
+	host := filepath.Join(dir, "host")
+	require.NoError(t, os.MkdirAll(host, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(host, "python"), []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("PATH", host+string(os.PathListSeparator)+bin)
+
+	exe, err := cderunExecutable()
+	require.NoError(t, err)
+
+	t.Run("install", func(t *testing.T) {
+		out, err := executeCommand("install", "--dir", bin)
+		assert.ErrorContains(t, err, "1 of 3 tools were not installed")
+		assert.Contains(t, out, "Skipping python: "+filepath.Join(host, "python")+" is already on PATH (use --force to install anyway)")
+		assert.NotContains(t, out, "is not in PATH")
+
+		for _, tool := range []string{"node", "ps"} {
+			target, err := os.Readlink(filepath.Join(bin, tool))
+			require.NoError(t, err)
+			assert.Equal(t, exe, target)
+		}
+		_, err = os.Lstat(filepath.Join(bin, "python"))
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = executeCommand("install", "--dir", bin, "node")
+		assert.NoError(t, err, "reinstalling replaces our own links")
+		_, err = executeCommand("install", "--dir", bin, "ruby")
+		assert.ErrorContains(t, err, `tool "ruby" not found`)
+	})
+
+	t.Run("force and shims", func(t *testing.T) {
+		out, err := executeCommand("install", "--dir", bin, "--shim", "--force", "python")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Warning: python conflicts with")
+
+		data, err := os.ReadFile(filepath.Join(bin, "python"))
+		require.NoError(t, err)
+		assert.Equal(t, "#!/bin/sh\n"+shimMarker+"\nexec "+shellQuote(exe)+" -- 'python' \"$@\"\n", string(data))
+	})
+
+	t.Run("foreign files", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(bin, "ps")))
+		require.NoError(t, os.WriteFile(filepath.Join(bin, "ps"), []byte("#!/bin/sh\necho mine\n"), 0755))
+		out, err := executeCommand("install", "--dir", bin, "ps")
+		assert.Error(t, err)
+		assert.Contains(t, out, "exists and does not point at cderun")
+
+		require.NoError(t, os.Symlink("/bin/sh", filepath.Join(bin, "sh")))
+		out, err = executeCommand("uninstall", "--dir", bin, "ps", "ruby")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Leaving "+filepath.Join(bin, "ps")+", it does not point at cderun")
+		assert.Contains(t, out, "ruby is not installed")
+	})
+
+	t.Run("uninstall", func(t *testing.T) {
+		out, err := executeCommand("uninstall", "--dir", bin)
+		require.NoError(t, err)
+		assert.Contains(t, out, "Removed "+filepath.Join(bin, "node"))
+		assert.Contains(t, out, "Removed "+filepath.Join(bin, "python"))
+
+		entries, err := os.ReadDir(bin)
+		require.NoError(t, err)
+		var left []string
+		for _, e := range entries {
+			left = append(left, e.Name())
+		}
+		assert.Equal(t, []string{"ps", "sh"}, left, "only cderun links are removed")
+	})
+
+	t.Run("not in PATH", func(t *testing.T) {
+		other := filepath.Join(dir, "other")
+		out, err := executeCommand("install", "--dir", other, "node")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Note: "+other+" is not in PATH")
+	})
+}
@@ -0,0 +1,394 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"cderun/internal/container"
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var (
+	// For testing
+	keepAliveStateDir = func() (string, error) {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "cderun", "keepalive"), nil
+	}
+
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+)
+
+// keepAliveName returns a stable container name per tool and project directory.
+func keepAliveName(tool, dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return fmt.Sprintf("cderun-keepalive-%s-%s", invalidNameChars.ReplaceAllString(tool, "-"), hex.EncodeToString(sum[:])[:12])
+}
+
+// configHash fingerprints the settings baked into a keep-alive container.
+// Settings that only affect a single run (command, TTY, stdin) are excluded.
+func configHash(cfg *container.ContainerConfig) string {
+	c := *cfg
+	c.Command, c.Args = nil, nil
+	c.TTY, c.Interactive, c.Remove = false, false, false
+	c.Labels = nil
+	if cfg.KeepAlive != nil {
+		// The idle timeout only matters where the idle timer bakes it into the entrypoint
+		keepAlive := *cfg.KeepAlive
+		keepAlive.IdleTimeout = ""
+		keepAlive.Command = keepAliveEntrypoint(cfg.KeepAlive)
+		c.KeepAlive = &keepAlive
+	}
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// ensureKeepAliveContainer returns the ID of a running keep-alive container that
+// matches the current configuration, creating or recreating it as needed.
+func ensureKeepAliveContainer(ctx context.Context, rt runtime.ContainerRuntime, cfg *container.ContainerConfig) (string, error) {
+	spec := cfg.KeepAlive
+	hash := configHash(cfg)
+
+	info, err := rt.InspectContainer(ctx, spec.Name)
+	switch {
+	case errors.Is(err, runtime.ErrContainerNotFound):
+	case err != nil:
+		return "", fmt.Errorf("failed to inspect keep-alive container: %w", err)
+	case info.Labels[configHashLabel] != hash:
+		logging.Info("Configuration changed, recreating keep-alive container: %s", spec.Name)
+		if err := rt.RemoveContainer(ctx, info.ID); err != nil {
+			return "", fmt.Errorf("failed to remove outdated keep-alive container: %w", err)
+		}
+	case info.Running:
+		logging.Debug("Reusing keep-alive container: %s", spec.Name)
+		resetIdleTimer(ctx, rt, info.ID, spec)
+		return info.ID, nil
+	default:
+		logging.Debug("Starting stopped keep-alive container: %s", spec.Name)
+		if err := rt.StartContainer(ctx, info.ID); err != nil {
+			return "", keepAliveStartError(err, spec)
+		}
+		return info.ID, nil
+	}
+
+	create := *cfg
+	create.Name = spec.Name
+	create.Entrypoint = keepAliveEntrypoint(spec)
+	create.Command, create.Args = nil, nil
+	create.TTY, create.Interactive, create.Remove = false, false, false
+	create.Labels = map[string]string{}
+	for k, v := range cfg.Labels {
+		create.Labels[k] = v
+	}
+	create.Labels[managedLabel] = "true"
+	create.Labels[keepAliveLabel] = "true"
+	create.Labels[toolLabel] = cfg.Command[0]
+	create.Labels[configHashLabel] = hash
+	// The container outlives this process
+	delete(create.Labels, pidLabel)
+	delete(create.Labels, removeLabel)
+
+	logging.Info("Starting keep-alive container: %s", spec.Name)
+	containerID, err := rt.CreateContainer(ctx, &create)
+	if err != nil {
+		// Another cderun process may have created it concurrently
+		info, inspectErr := rt.InspectContainer(ctx, spec.Name)
+		if inspectErr != nil || info.Labels[configHashLabel] != hash {
+			return "", fmt.Errorf("failed to create keep-alive container: %w", err)
+		}
+		containerID = info.ID
+	}
+	if err := rt.StartContainer(ctx, containerID); err != nil {
+		return "", keepAliveStartError(err, spec)
+	}
+	return containerID, nil
+}
+
+// idleTimerScript keeps a keep-alive container running until no command has
+// been run in it for $1 seconds. SIGUSR1 restarts the timer. The container
+// stops itself, so it does not run forever when no cderun process reaps it.
+const idleTimerScript = `trap 'exit 0' TERM INT; trap 'kill $! 2>/dev/null' USR1; while :; do sleep "$1" & wait $! && exit 0; done`
+
+// keepAliveEntrypoint returns the command that keeps the container running:
+// the configured keepAliveCommand, or the idle timer.
+func keepAliveEntrypoint(spec *container.KeepAliveSpec) []string {
+	if len(spec.Command) > 0 {
+		return spec.Command
+	}
+	timeout, err := time.ParseDuration(spec.IdleTimeout)
+	if err != nil || timeout <= 0 {
+		return []string{"sleep", "infinity"}
+	}
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+	return []string{"sh", "-c", idleTimerScript, "sh", strconv.FormatInt(seconds, 10)}
+}
+
+// usesIdleTimer reports whether the container runs the idle timer.
+func usesIdleTimer(spec *container.KeepAliveSpec) bool {
+	timeout, err := time.ParseDuration(spec.IdleTimeout)
+	return len(spec.Command) == 0 && err == nil && timeout > 0
+}
+
+// resetIdleTimer restarts the idle timer of the container, so it does not stop
+// while a command runs in it.
+func resetIdleTimer(ctx context.Context, rt runtime.ContainerRuntime, containerID string, spec *container.KeepAliveSpec) {
+	if !usesIdleTimer(spec) {
+		return
+	}
+	if err := rt.SignalContainer(ctx, containerID, "SIGUSR1"); err != nil {
+		logging.Debug("Failed to reset the idle timer of %s: %v", spec.Name, err)
+	}
+}
+
+// keepAliveStartError explains a start failure caused by an image without the
+// commands the idle timer needs.
+func keepAliveStartError(err error, spec *container.KeepAliveSpec) error {
+	if errors.Is(err, runtime.ErrCommandNotFound) && usesIdleTimer(spec) {
+		return fmt.Errorf("failed to start keep-alive container: the idle timer needs sh and sleep in the image, set keepAliveCommand for images without them: %w", err)
+	}
+	return fmt.Errorf("failed to start keep-alive container: %w", err)
+}
+
+// runKeepAlive runs the command with ExecContainer in the tool's keep-alive container.
+func runKeepAlive(ctx context.Context, rt runtime.ContainerRuntime, resolved *config.ResolvedConfig, cfg *container.ContainerConfig, output *outputCapture) (int, error) {
+	reapIdleKeepAlive(ctx, rt, resolved.Socket)
+
+	containerID, err := ensureKeepAliveContainer(ctx, rt, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	ctxG, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	state := keepAliveState{
+		Name:        cfg.KeepAlive.Name,
+		Runtime:     rt.Name(),
+		Socket:      resolved.Socket,
+		IdleTimeout: cfg.KeepAlive.IdleTimeout,
+	}
+	state.touch()
+	defer state.touch()
+	// The idle timeout counts from the end of the command
+	defer resetIdleTimer(context.WithoutCancel(ctx), rt, containerID, cfg.KeepAlive)
+	// Keep long sessions from being reaped as idle by other cderun processes or the idle timer
+	if timeout, err := time.ParseDuration(state.IdleTimeout); err == nil && timeout > 0 {
+		go func() {
+			ticker := time.NewTicker(timeout / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					state.touch()
+					resetIdleTimer(ctxG, rt, containerID, cfg.KeepAlive)
+				case <-ctxG.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	marker, err := execMarker()
+	if err != nil {
+		return 0, err
+	}
+	logging.Trace("Creating exec session in container: %s", containerID)
+	execID, err := rt.ExecContainer(ctx, containerID, &container.ExecConfig{
+		Command:     append(append([]string{}, cfg.Command...), cfg.Args...),
+		TTY:         cfg.TTY,
+		Interactive: cfg.Interactive,
+		Env:         []string{marker},
+		Workdir:     cfg.Workdir,
+		User:        cfg.User,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create exec session: %w", err)
+	}
+
+	restoreTerminal := makeRawTerminal(cfg.TTY)
+	defer restoreTerminal()
+
+	// Handle signals and forward them to the processes of the exec session
+	sigChan := make(chan os.Signal, 4)
+	signal.Notify(sigChan, lookupSignals(resolved.ForwardSignals)...)
+	defer signal.Stop(sigChan)
+	signalExec := func(ctx context.Context, name string) error {
+		return signalExecSession(ctx, rt, containerID, cfg.User, marker, name)
+	}
+	forwarder := &signalForwarder{rt: rt, containerID: containerID, tty: cfg.TTY, execSignal: signalExec}
+	go forwarder.run(ctxG, cancel, sigChan)
+
+	if cfg.TTY && term.IsTerminal(int(os.Stdout.Fd())) {
+		syncTerminalSize(ctxG, func(rows, cols uint) error {
+			return rt.ResizeExecTTY(ctxG, execID, rows, cols)
+		})
+	}
+
+	var stdin io.Reader
+	if cfg.Interactive {
+		stdin = os.Stdin
+	}
+
+	logging.Trace("Attaching to exec session: %s", execID)
+	err = rt.AttachExec(ctxG, execID, cfg.TTY, stdin, output.stdout, output.stderr)
+	if code, ok := forwarder.exitCode(); ok && ctxG.Err() != nil && ctx.Err() == nil {
+		// Forced termination: kill the processes instead of leaving them running
+		if err := signalExec(context.WithoutCancel(ctx), "SIGKILL"); err != nil {
+			logging.Warn("failed to kill exec session: %v", err)
+		}
+		return code, nil
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return 0, fmt.Errorf("failed to attach to exec session: %w", err)
+	}
+
+	exitCode, err := rt.WaitExec(ctx, execID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wait for exec session: %w", err)
+	}
+	logging.Debug("Exec session exited with code: %d", exitCode)
+	if code, ok := forwarder.exitCode(); ok {
+		return code, nil
+	}
+	return exitCode, nil
+}
+
+// execMarkerVar is set to a random value in the environment of every exec
+// session, so its processes can be found inside the container.
+const execMarkerVar = "CDERUN_EXEC_ID"
+
+// execSignalScript sends the signal $2 to every process whose environment
+// contains $1. The PID returned by the exec inspect API is in the daemon's PID
+// namespace and cannot be used inside the container. Like a terminal signaling
+// its foreground process group, this also reaches the children of the command.
+const execSignalScript = `for p in /proc/[0-9]*; do grep -q "$1" "$p/environ" 2>/dev/null && kill -s "$2" "${p#/proc/}" 2>/dev/null; done; exit 0`
+
+// execMarker returns a new "CDERUN_EXEC_ID=..." environment entry.
+func execMarker() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate exec session ID: %w", err)
+	}
+	return execMarkerVar + "=" + hex.EncodeToString(id), nil
+}
+
+// signalExecSession sends a signal to the processes of the exec session marked
+// with marker by running kill in another exec session as the same user.
+func signalExecSession(ctx context.Context, rt runtime.ContainerRuntime, containerID, user, marker, name string) error {
+	execID, err := rt.ExecContainer(ctx, containerID, &container.ExecConfig{
+		Command: []string{"sh", "-c", execSignalScript, "sh", marker, strings.TrimPrefix(name, "SIG")},
+		User:    user,
+	})
+	if err != nil {
+		return err
+	}
+	if err := rt.AttachExec(ctx, execID, false, nil, io.Discard, io.Discard); err != nil {
+		return err
+	}
+	code, err := rt.WaitExec(ctx, execID)
+	if err != nil {
+		return err
+	}
+	if code == 126 || code == 127 {
+		return fmt.Errorf("cannot signal the command: the image has no sh, which is needed to find the processes of the exec session")
+	}
+	if code != 0 {
+		return fmt.Errorf("kill exited with code %d", code)
+	}
+	return nil
+}
+
+// keepAliveState records the last use of a keep-alive container. The file's
+// modification time is the last-used timestamp.
+type keepAliveState struct {
+	Name        string `json:"name"`
+	Runtime     string `json:"runtime"`
+	Socket      string `json:"socket"`
+	IdleTimeout string `json:"idleTimeout"`
+}
+
+func (s keepAliveState) touch() {
+	dir, err := keepAliveStateDir()
+	if err != nil {
+		logging.Debug("Keep-alive state directory unavailable: %v", err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logging.Debug("Failed to create keep-alive state directory: %v", err)
+		return
+	}
+	data, _ := json.Marshal(s)
+	if err := os.WriteFile(filepath.Join(dir, s.Name+".json"), data, 0600); err != nil {
+		logging.Debug("Failed to write keep-alive state: %v", err)
+	}
+}
+
+// reapIdleKeepAlive removes keep-alive containers of the same runtime that have
+// not been used within their idle timeout. It runs before every keep-alive run,
+// in "cderun reap" and "cderun prune", and on startup with reapOrphans.
+// It returns the names of the removed containers.
+func reapIdleKeepAlive(ctx context.Context, rt runtime.ContainerRuntime, socket string) []string {
+	dir, err := keepAliveStateDir()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var removed []string
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var state keepAliveState
+		if err := json.Unmarshal(data, &state); err != nil {
+			logging.Debug("Ignoring invalid keep-alive state %s: %v", path, err)
+			continue
+		}
+		if state.Runtime != rt.Name() || state.Socket != socket {
+			continue
+		}
+		timeout, err := time.ParseDuration(state.IdleTimeout)
+		if err != nil || timeout <= 0 || time.Since(fi.ModTime()) < timeout {
+			continue
+		}
+
+		logging.Info("Removing idle keep-alive container: %s", state.Name)
+		if err := rt.RemoveContainer(ctx, state.Name); err != nil {
+			logging.Warn("failed to remove idle keep-alive container %s: %v", state.Name, err)
+			continue
+		}
+		_ = os.Remove(path)
+		removed = append(removed, state.Name)
+	}
+	return removed
+}
@@ -0,0 +1,261 @@
+package command
+
+import (
+	"cderun/internal/container"
+	"cderun/internal/runtime"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keepAliveRuntime keeps track of named containers so that later runs can find them.
+type keepAliveRuntime struct {
+	runtime.MockRuntime
+	containers map[string]*runtime.ContainerInfo
+}
+
+func (k *keepAliveRuntime) CreateContainer(ctx context.Context, config *container.ContainerConfig) (string, error) {
+	_, _ = k.MockRuntime.CreateContainer(ctx, config)
+	id := "id-" + config.Name
+	k.containers[config.Name] = &runtime.ContainerInfo{ID: id, Labels: config.Labels}
+	return id, k.CreateErr
+}
+
+func (k *keepAliveRuntime) StartContainer(ctx context.Context, containerID string) error {
+	_ = k.MockRuntime.StartContainer(ctx, containerID)
+	for _, info := range k.containers {
+		if info.ID == containerID {
+			info.Running = true
+		}
+	}
+	return k.StartErr
+}
+
+func (k *keepAliveRuntime) RemoveContainer(ctx context.Context, containerID string) error {
+	_ = k.MockRuntime.RemoveContainer(ctx, containerID)
+	for name, info := range k.containers {
+		if info.ID == containerID || name == containerID {
+			delete(k.containers, name)
+		}
+	}
+	return k.RemoveErr
+}
+
+func (k *keepAliveRuntime) InspectContainer(ctx context.Context, containerID string) (*runtime.ContainerInfo, error) {
+	if info, ok := k.containers[containerID]; ok {
+		return info, nil
+	}
+	return nil, runtime.ErrContainerNotFound
+}
+
+func TestKeepAlive(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldStateDir := keepAliveStateDir
+	oldWd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		keepAliveStateDir = oldStateDir
+		os.Chdir(oldWd)
+	})
+
+	stateDir := t.TempDir()
+	keepAliveStateDir = func() (string, error) { return stateDir, nil }
+
+	var exitCode int
+	exitFunc = func(code int) { exitCode = code }
+
+	projectDir := t.TempDir()
+	require.NoError(t, os.Chdir(projectDir))
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	name := keepAliveName("git", cwd)
+	writeTools := func(content string) {
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte(content), 0644))
+	}
+	writeTools(`
+git:
+  image: alpine/git
+  keepAlive: true
+  idleTimeout: 1h
+`)
+
+	rt := &keepAliveRuntime{containers: map[string]*runtime.ContainerInfo{}}
+	rt.ExecID = "exec-1"
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return rt, nil
+	}
+
+	t.Run("first run starts a labelled container and execs into it", func(t *testing.T) {
+		rt.ExecExitCode = 3
+		_, err := executeCommand("git", "status")
+		require.NoError(t, err)
+
+		require.NotNil(t, rt.CreatedConfig)
+		assert.Equal(t, name, rt.CreatedConfig.Name)
+		assert.Equal(t, []string{"sh", "-c", idleTimerScript, "sh", "3600"}, rt.CreatedConfig.Entrypoint)
+		assert.Empty(t, rt.CreatedConfig.Command)
+		assert.Equal(t, "git", rt.CreatedConfig.Labels["cderun.tool"])
+		assert.Equal(t, "true", rt.CreatedConfig.Labels["cderun.keepalive"])
+		assert.NotEmpty(t, rt.CreatedConfig.Labels["cderun.config-hash"])
+
+		assert.Equal(t, "id-"+name, rt.ExecContainerID)
+		require.Len(t, rt.ExecConfigs, 1)
+		assert.Equal(t, []string{"git", "status"}, rt.ExecConfigs[0].Command)
+		require.Len(t, rt.ExecConfigs[0].Env, 1)
+		assert.Regexp(t, `^CDERUN_EXEC_ID=[0-9a-f]{16}$`, rt.ExecConfigs[0].Env[0])
+		assert.Equal(t, "exec-1", rt.AttachedExecID)
+		assert.Equal(t, "exec-1", rt.WaitedExecID)
+		assert.Equal(t, 3, exitCode)
+
+		assert.FileExists(t, filepath.Join(stateDir, name+".json"))
+	})
+
+	t.Run("later runs reuse the running container", func(t *testing.T) {
+		rt.CreatedConfig = nil
+		rt.ExecExitCode = 0
+		rt.Signals = nil
+		_, err := executeCommand("git", "log", "--cderun-tty")
+		require.NoError(t, err)
+
+		assert.Nil(t, rt.CreatedConfig, "no new container should be created")
+		assert.Equal(t, []string{"SIGUSR1", "SIGUSR1"}, rt.Signals, "the idle timer restarts when the command starts and ends")
+		require.Len(t, rt.ExecConfigs, 2)
+		assert.Equal(t, []string{"git", "log"}, rt.ExecConfigs[1].Command)
+		assert.True(t, rt.ExecConfigs[1].TTY)
+		assert.Equal(t, 0, exitCode)
+	})
+
+	t.Run("configuration change recreates the container", func(t *testing.T) {
+		rt.CreatedConfig = nil
+		_, err := executeCommand("-e", "FOO=bar", "git", "status")
+		require.NoError(t, err)
+
+		assert.Equal(t, "id-"+name, rt.RemovedContainerID)
+		require.NotNil(t, rt.CreatedConfig)
+		assert.Contains(t, rt.CreatedConfig.Env, "FOO=bar")
+	})
+
+	t.Run("idle containers are reaped", func(t *testing.T) {
+		statePath := filepath.Join(stateDir, name+".json")
+		old := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(statePath, old, old))
+		rt.RemovedContainerIDs = nil
+		rt.CreatedConfig = nil
+
+		_, err := executeCommand("-e", "FOO=bar", "git", "status")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{name}, rt.RemovedContainerIDs)
+		require.NotNil(t, rt.CreatedConfig, "a fresh container is started after reaping")
+		info, err := os.Stat(statePath)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+	})
+
+	t.Run("idle containers are removed by reap and prune", func(t *testing.T) {
+		for _, command := range []string{"reap", "prune"} {
+			_, err := executeCommand("git", "status")
+			require.NoError(t, err)
+			statePath := filepath.Join(stateDir, name+".json")
+			old := time.Now().Add(-2 * time.Hour)
+			require.NoError(t, os.Chtimes(statePath, old, old))
+			rt.RemovedContainerIDs = nil
+
+			output, err := executeCommand(command)
+			require.NoError(t, err, command)
+			assert.Equal(t, []string{name}, rt.RemovedContainerIDs, command)
+			assert.Contains(t, output, name+"\nRemoved 1 idle keep-alive container(s)", command)
+			assert.NoFileExists(t, statePath, command)
+		}
+	})
+
+	t.Run("keepAliveCommand replaces the idle timer", func(t *testing.T) {
+		writeTools(`
+git:
+  image: alpine/git
+  keepAlive: true
+  keepAliveCommand: [tail, -f, /dev/null]
+`)
+		rt.CreatedConfig = nil
+		rt.Signals = nil
+		_, err := executeCommand("git", "status")
+		require.NoError(t, err)
+		require.NotNil(t, rt.CreatedConfig)
+		assert.Equal(t, []string{"tail", "-f", "/dev/null"}, rt.CreatedConfig.Entrypoint)
+
+		_, err = executeCommand("git", "status")
+		require.NoError(t, err)
+		assert.Empty(t, rt.Signals, "only the idle timer is signaled")
+	})
+
+	t.Run("images without sh fail clearly", func(t *testing.T) {
+		writeTools(`
+git:
+  image: alpine/git
+  keepAlive: true
+`)
+		for k := range rt.containers {
+			delete(rt.containers, k)
+		}
+		rt.StartErr = runtime.ErrCommandNotFound
+		defer func() { rt.StartErr = nil }()
+		_, err := executeCommand("git", "status")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the idle timer needs sh and sleep in the image")
+	})
+
+	t.Run("disabled together with services", func(t *testing.T) {
+		writeTools(`
+git:
+  image: alpine/git
+  keepAlive: true
+  services:
+    db:
+      image: postgres
+`)
+		output, err := executeCommand("--dry-run", "git", "status")
+		require.NoError(t, err)
+		assert.NotContains(t, output, "keep_alive")
+	})
+}
+
+func TestConfigHash(t *testing.T) {
+	base := &container.ContainerConfig{
+		Image:     "alpine",
+		Command:   []string{"ls"},
+		Env:       []string{"A=1"},
+		KeepAlive: &container.KeepAliveSpec{Name: "x", IdleTimeout: "1m", Command: []string{"sleep", "infinity"}},
+	}
+	perRun := *base
+	perRun.Command = []string{"cat"}
+	perRun.Args = []string{"file"}
+	perRun.TTY = true
+	perRun.KeepAlive = &container.KeepAliveSpec{Name: "x", IdleTimeout: "1h", Command: []string{"sleep", "infinity"}}
+	assert.Equal(t, configHash(base), configHash(&perRun))
+
+	changed := *base
+	changed.Env = []string{"A=2"}
+	assert.NotEqual(t, configHash(base), configHash(&changed))
+
+	// The idle timer bakes the timeout into the entrypoint
+	timer := *base
+	timer.KeepAlive = &container.KeepAliveSpec{Name: "x", IdleTimeout: "1m"}
+	longer := *base
+	longer.KeepAlive = &container.KeepAliveSpec{Name: "x", IdleTimeout: "1h"}
+	assert.NotEqual(t, configHash(&timer), configHash(&longer))
+}
+
+func TestKeepAliveEntrypoint(t *testing.T) {
+	assert.Equal(t, []string{"sh", "-c", idleTimerScript, "sh", "90"}, keepAliveEntrypoint(&container.KeepAliveSpec{IdleTimeout: "1m30s"}))
+	assert.Equal(t, []string{"sh", "-c", idleTimerScript, "sh", "1"}, keepAliveEntrypoint(&container.KeepAliveSpec{IdleTimeout: "10ms"}))
+	assert.Equal(t, []string{"sleep", "infinity"}, keepAliveEntrypoint(&container.KeepAliveSpec{IdleTimeout: "0"}), "never idle")
+	assert.Equal(t, []string{"tail", "-f", "/dev/null"}, keepAliveEntrypoint(&container.KeepAliveSpec{IdleTimeout: "1m", Command: []string{"tail", "-f", "/dev/null"}}))
+}
@@ -0,0 +1,59 @@
+package command
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Labels attached to runtime resources created by cderun.
+const (
+	managedLabel    = "cderun.managed" // Any container or network created by cderun
+	toolLabel       = "cderun.tool"
+	versionLabel    = "cderun.version"
+	pidLabel        = "cderun.pid"    // PID of the cderun process that owns the container
+	pidNSLabel      = "cderun.pidns"  // PID namespace the owner's PID belongs to
+	removeLabel     = "cderun.remove" // The owner removes the container when it exits
+	cwdLabel        = "cderun.cwd"
+	hostLabel       = "cderun.host"
+	serviceLabel    = "cderun.service"
+	keepAliveLabel  = "cderun.keepalive"
+	configHashLabel = "cderun.config-hash"
+)
+
+// detachedNamePrefix marks containers the user detached from. Labels cannot be
+// changed after creation, so the container is renamed instead.
+const detachedNamePrefix = "cderun-detached-"
+
+// detachedName returns the name given to a container when the user detaches from it.
+func detachedName(tool, containerID string) string {
+	return detachedNamePrefix + invalidNameChars.ReplaceAllString(tool, "-") + "-" + shortID(containerID)
+}
+
+// isDetached reports whether the user detached from the container.
+func isDetached(name string) bool {
+	return strings.HasPrefix(name, detachedNamePrefix)
+}
+
+// runLabels returns the labels that identify a container started by this process.
+func runLabels(tool string, extra map[string]string) map[string]string {
+	labels := map[string]string{
+		managedLabel: "true",
+		toolLabel:    tool,
+		versionLabel: cderunVersion(),
+		pidLabel:     strconv.Itoa(os.Getpid()),
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		labels[cwdLabel] = cwd
+	}
+	if host, err := os.Hostname(); err == nil {
+		labels[hostLabel] = host
+	}
+	if ns := pidNamespace(); ns != "" {
+		labels[pidNSLabel] = ns
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
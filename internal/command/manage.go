@@ -0,0 +1,307 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type psOptions struct {
+	all   bool
+	quiet bool
+	tool  string
+}
+
+type stopOptions struct {
+	all     bool
+	timeout time.Duration
+}
+
+var (
+	psOpts   = &psOptions{}
+	stopOpts = &stopOptions{}
+)
+
+var psCmd = &cobra.Command{
+	Use:          "ps",
+	Short:        "List containers started by cderun",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := opts.managementRuntime(cmd)
+		if err != nil {
+			return err
+		}
+
+		filter := runtime.ContainerFilter{Labels: map[string]string{managedLabel: ""}, All: psOpts.all}
+		if psOpts.tool != "" {
+			filter.Labels[toolLabel] = psOpts.tool
+		}
+		containers, err := listManaged(cmd.Context(), rt, filter)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if psOpts.quiet {
+			for _, c := range containers {
+				fmt.Fprintln(out, shortID(c.ID))
+			}
+			return nil
+		}
+		printContainers(out, containers)
+		return nil
+	},
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop [CONTAINER|TOOL...]",
+	Short: "Stop running containers started by cderun",
+	Long: `Stop running containers started by cderun. Containers can be selected
+by ID (or a unique prefix), by name or by the tool they were started for.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !stopOpts.all {
+			return fmt.Errorf("specify containers to stop or use --all")
+		}
+		rt, err := opts.managementRuntime(cmd)
+		if err != nil {
+			return err
+		}
+
+		containers, err := listManaged(cmd.Context(), rt, runtime.ContainerFilter{Labels: map[string]string{managedLabel: ""}})
+		if err != nil {
+			return err
+		}
+
+		targets := containers
+		if !stopOpts.all {
+			targets = nil
+			for _, arg := range args {
+				matched := selectContainers(containers, arg)
+				if len(matched) == 0 {
+					return fmt.Errorf("no running cderun container matches %q", arg)
+				}
+				targets = append(targets, matched...)
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		stopped := map[string]bool{}
+		for _, c := range targets {
+			if stopped[c.ID] {
+				continue
+			}
+			stopped[c.ID] = true
+			if err := rt.StopContainer(cmd.Context(), c.ID, stopOpts.timeout); err != nil {
+				return fmt.Errorf("failed to stop container %s: %w", shortID(c.ID), err)
+			}
+			fmt.Fprintln(out, shortID(c.ID))
+		}
+		return nil
+	},
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove stopped containers started by cderun",
+	Long: `Remove stopped containers started by cderun, and keep-alive containers
+that have not been used within their idle timeout. Containers of cderun
+processes that are still running are kept, e.g. created containers that have
+not been started yet.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		_, globalCfg := opts.loadConfigs()
+		rt, err := opts.connectRuntime(cmd, globalCfg)
+		if err != nil {
+			return err
+		}
+		_, socket := opts.resolveRuntime(cmd, globalCfg)
+		out := cmd.OutOrStdout()
+		printIdleKeepAlive(out, reapIdleKeepAlive(cmd.Context(), rt, socket))
+
+		containers, err := listManaged(cmd.Context(), rt, runtime.ContainerFilter{Labels: map[string]string{managedLabel: ""}, All: true})
+		if err != nil {
+			return err
+		}
+
+		host, _ := os.Hostname()
+		removed := 0
+		for _, c := range containers {
+			if c.Running {
+				continue
+			}
+			// The cderun process may not have started it yet, or still inspects it for its exit code
+			if alive, _ := ownerAlive(c, host); alive {
+				logging.Debug("Keeping container %s of running cderun process %s", shortID(c.ID), c.Labels[pidLabel])
+				continue
+			}
+			if err := rt.RemoveContainer(cmd.Context(), c.ID); err != nil {
+				return fmt.Errorf("failed to remove container %s: %w", shortID(c.ID), err)
+			}
+			fmt.Fprintln(out, shortID(c.ID))
+			removed++
+		}
+		fmt.Fprintf(out, "Removed %d container(s)\n", removed)
+		return nil
+	},
+}
+
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Remove containers whose cderun process is gone",
+	Long: `Remove containers left behind by cderun processes on this host that no
+longer exist, e.g. after SIGKILL, an OOM kill or a host crash. Stopped
+containers of runs with --remove=false are kept. Keep-alive containers that
+have not been used within their idle timeout are removed too.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts.initEarlyLogging()
+		_, globalCfg := opts.loadConfigs()
+		rt, err := opts.connectRuntime(cmd, globalCfg)
+		if err != nil {
+			return err
+		}
+		_, socket := opts.resolveRuntime(cmd, globalCfg)
+		out := cmd.OutOrStdout()
+		printIdleKeepAlive(out, reapIdleKeepAlive(cmd.Context(), rt, socket))
+
+		removed, err := reapOrphans(cmd.Context(), rt)
+		if err != nil {
+			return err
+		}
+		for _, id := range removed {
+			fmt.Fprintln(out, shortID(id))
+		}
+		fmt.Fprintf(out, "Removed %d orphaned container(s)\n", len(removed))
+		return nil
+	},
+}
+
+// printIdleKeepAlive prints the names of the removed idle keep-alive containers.
+func printIdleKeepAlive(out io.Writer, names []string) {
+	for _, name := range names {
+		fmt.Fprintln(out, name)
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(out, "Removed %d idle keep-alive container(s)\n", len(names))
+	}
+}
+
+// managementRuntime initializes the container runtime for management commands.
+// Only the runtime and socket settings are resolved; tool settings do not apply.
+func (o *rootOptions) managementRuntime(cmd *cobra.Command) (runtime.ContainerRuntime, error) {
+	o.initEarlyLogging()
+	_, globalCfg := o.loadConfigs()
+	return o.connectRuntime(cmd, globalCfg)
+}
+
+// connectRuntime initializes the container runtime from the runtime and socket settings.
+func (o *rootOptions) connectRuntime(cmd *cobra.Command, globalCfg *config.CDERunConfig) (runtime.ContainerRuntime, error) {
+	rt, err := runtimeFactory(o.resolveRuntime(cmd, globalCfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize runtime: %w", err)
+	}
+	return rt, nil
+}
+
+// resolveRuntime returns the name and socket path of the container runtime.
+func (o *rootOptions) resolveRuntime(cmd *cobra.Command, globalCfg *config.CDERunConfig) (string, string) {
+	return config.ResolveRuntime(config.CLIOptions{
+		Runtime:              o.runtimeName,
+		RuntimeSet:           cmd.Flags().Changed("runtime"),
+		CderunRuntime:        o.cderunRuntime,
+		CderunRuntimeSet:     cmd.Flags().Changed("cderun-runtime"),
+		MountSocket:          o.mountSocket,
+		MountSocketSet:       cmd.Flags().Changed("mount-socket"),
+		CderunMountSocket:    o.cderunMountSocket,
+		CderunMountSocketSet: cmd.Flags().Changed("cderun-mount-socket"),
+	}, globalCfg)
+}
+
+// listManaged lists containers matching filter, oldest first.
+func listManaged(ctx context.Context, rt runtime.ContainerRuntime, filter runtime.ContainerFilter) ([]runtime.ContainerInfo, error) {
+	containers, err := rt.ListContainers(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].Created.Before(containers[j].Created)
+	})
+	return containers, nil
+}
+
+// selectContainers returns the containers whose ID starts with arg, or whose
+// name or tool equals arg.
+func selectContainers(containers []runtime.ContainerInfo, arg string) []runtime.ContainerInfo {
+	var matched []runtime.ContainerInfo
+	for _, c := range containers {
+		if strings.HasPrefix(c.ID, arg) || c.Name == arg || c.Labels[toolLabel] == arg {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+func printContainers(out io.Writer, containers []runtime.ContainerInfo) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER ID\tTOOL\tIMAGE\tSTATUS\tCREATED\tPID\tCWD")
+	for _, c := range containers {
+		tool := c.Labels[toolLabel]
+		if svc := c.Labels[serviceLabel]; svc != "" {
+			tool += " (" + svc + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			shortID(c.ID), tool, c.Image, c.Status, formatAge(c.Created), c.Labels[pidLabel], c.Labels[cwdLabel])
+	}
+	_ = w.Flush()
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// formatAge formats the time since t like "5m ago".
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+func init() {
+	psCmd.Flags().BoolVarP(&psOpts.all, "all", "a", false, "Show stopped containers too")
+	psCmd.Flags().BoolVarP(&psOpts.quiet, "quiet", "q", false, "Only print container IDs")
+	psCmd.Flags().StringVar(&psOpts.tool, "tool", "", "Only show containers of the given tool")
+
+	stopCmd.Flags().BoolVar(&stopOpts.all, "all", false, "Stop all running containers started by cderun")
+	stopCmd.Flags().DurationVarP(&stopOpts.timeout, "timeout", "t", 10*time.Second, "Time to wait before killing the container")
+
+	rootCmd.AddCommand(psCmd, stopCmd, pruneCmd, reapCmd, attachCmd)
+}
@@ -0,0 +1,392 @@
+package command
+
+import (
+	"cderun/internal/runtime"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagementCommands(t *testing.T) {
+	oldFactory := runtimeFactory
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+	})
+
+	var rt *runtime.MockRuntime
+	var factoryRuntime string
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		factoryRuntime = name
+		return rt, nil
+	}
+	reset := func() {
+		rt = &runtime.MockRuntime{Containers: []runtime.ContainerInfo{
+			{
+				ID:      "aaaaaaaaaaaa1111",
+				Name:    "brave_node",
+				Image:   "node:20",
+				Created: time.Now().Add(-5 * time.Minute),
+				Running: true,
+				Status:  "running",
+				Labels:  map[string]string{managedLabel: "true", toolLabel: "node", pidLabel: "42", cwdLabel: "/work"},
+			},
+			{
+				ID:      "bbbbbbbbbbbb2222",
+				Image:   "python:3",
+				Created: time.Now().Add(-2 * time.Hour),
+				Status:  "exited",
+				Labels:  map[string]string{managedLabel: "true", toolLabel: "python"},
+			},
+			{
+				ID:      "cccccccccccc3333",
+				Image:   "postgres",
+				Created: time.Now().Add(-time.Minute),
+				Running: true,
+				Status:  "running",
+				Labels:  map[string]string{managedLabel: "true", toolLabel: "node", serviceLabel: "db"},
+			},
+			{
+				ID:      "dddddddddddd4444",
+				Image:   "redis",
+				Running: true,
+				Status:  "running",
+				Labels:  map[string]string{"other": "true"},
+			},
+		}}
+	}
+
+	t.Run("ps lists running managed containers", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("ps")
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[0], "CONTAINER ID")
+		assert.Contains(t, lines[1], "aaaaaaaaaaaa")
+		assert.NotContains(t, lines[1], "aaaaaaaaaaaa1111")
+		assert.Contains(t, lines[1], "node:20")
+		assert.Contains(t, lines[1], "5m ago")
+		assert.Contains(t, lines[1], "/work")
+		assert.Contains(t, lines[2], "node (db)")
+		assert.NotContains(t, output, "python")
+		assert.NotContains(t, output, "redis")
+	})
+
+	t.Run("ps -a includes stopped containers", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("ps", "-a", "-q")
+		require.NoError(t, err)
+		assert.Equal(t, "bbbbbbbbbbbb\naaaaaaaaaaaa\ncccccccccccc\n", output)
+		assert.True(t, rt.ListFilter.All)
+	})
+
+	t.Run("ps --tool filters by tool", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("ps", "--tool", "python", "--all", "--quiet")
+		require.NoError(t, err)
+		assert.Equal(t, "bbbbbbbbbbbb\n", output)
+	})
+
+	t.Run("ps honours the runtime flag", func(t *testing.T) {
+		reset()
+		_, err := executeCommand("ps", "--runtime", "podman")
+		require.NoError(t, err)
+		assert.Equal(t, "podman", factoryRuntime)
+
+		reset()
+		factoryRuntime = ""
+		output, err := executeCommand("--runtime", "podman", "ps")
+		require.NoError(t, err)
+		assert.Equal(t, "podman", factoryRuntime)
+		assert.Contains(t, output, "aaaaaaaaaaaa", "ps is the management command before the flags it uses")
+		assert.Nil(t, rt.CreatedConfig)
+	})
+
+	t.Run("stop by ID prefix, name and tool", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("stop", "aaaa")
+		require.NoError(t, err)
+		assert.Equal(t, "aaaaaaaaaaaa\n", output)
+		assert.Equal(t, []string{"aaaaaaaaaaaa1111"}, rt.StoppedContainerIDs)
+		assert.Equal(t, 10*time.Second, rt.StopTimeout)
+
+		reset()
+		_, err = executeCommand("stop", "-t", "2s", "brave_node")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"aaaaaaaaaaaa1111"}, rt.StoppedContainerIDs)
+		assert.Equal(t, 2*time.Second, rt.StopTimeout)
+
+		reset()
+		_, err = executeCommand("stop", "node", "aaaa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"aaaaaaaaaaaa1111", "cccccccccccc3333"}, rt.StoppedContainerIDs)
+	})
+
+	t.Run("stop without match fails", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("stop", "python")
+		assert.ErrorContains(t, err, `no running cderun container matches "python"`)
+		assert.NotContains(t, output, "Usage:", "runtime errors do not print the usage")
+		assert.Empty(t, rt.StoppedContainerIDs)
+
+		_, err = executeCommand("stop")
+		assert.ErrorContains(t, err, "--all")
+	})
+
+	t.Run("stop --all", func(t *testing.T) {
+		reset()
+		_, err := executeCommand("stop", "--all")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"aaaaaaaaaaaa1111", "cccccccccccc3333"}, rt.StoppedContainerIDs)
+	})
+
+	t.Run("prune removes stopped containers", func(t *testing.T) {
+		reset()
+		host, err := os.Hostname()
+		require.NoError(t, err)
+		rt.Containers = append(rt.Containers, runtime.ContainerInfo{
+			ID:     "eeeeeeeeeeee5555",
+			Image:  "python:3",
+			Status: "created",
+			Labels: map[string]string{managedLabel: "true", toolLabel: "python", hostLabel: host, pidLabel: strconv.Itoa(os.Getppid()), pidNSLabel: pidNamespace()},
+		})
+		output, err := executeCommand("prune")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bbbbbbbbbbbb2222"}, rt.RemovedContainerIDs, "containers of running cderun processes are kept")
+		assert.Contains(t, output, "Removed 1 container(s)")
+	})
+
+	t.Run("tool named like a management command", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("--image", "alpine", "--dry-run", "ps", "aux")
+		require.NoError(t, err)
+		assert.Contains(t, output, "- ps")
+		assert.Contains(t, output, "- aux")
+		assert.Empty(t, rt.ListFilter.Labels)
+	})
+}
+
+func TestRunLabels(t *testing.T) {
+	labels := runLabels("node", map[string]string{"extra": "1"})
+	assert.Equal(t, "true", labels[managedLabel])
+	assert.Equal(t, "node", labels[toolLabel])
+	assert.Equal(t, cderunVersion(), labels[versionLabel])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), labels[pidLabel])
+	assert.Equal(t, "1", labels["extra"])
+	cwd, _ := os.Getwd()
+	assert.Equal(t, cwd, labels[cwdLabel])
+}
+
+func TestReapOrphans(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+	})
+	exitFunc = func(int) {}
+
+	// A PID that is guaranteed to be gone
+	proc := exec.Command("true")
+	require.NoError(t, proc.Run())
+	deadPID := strconv.Itoa(proc.Process.Pid)
+	alivePID := strconv.Itoa(os.Getppid())
+	host, err := os.Hostname()
+	require.NoError(t, err)
+
+	labels := func(pid string, extra ...string) map[string]string {
+		l := map[string]string{managedLabel: "true", hostLabel: host, pidLabel: pid, pidNSLabel: pidNamespace()}
+		for i := 0; i+1 < len(extra); i += 2 {
+			l[extra[i]] = extra[i+1]
+		}
+		return l
+	}
+	var rt *runtime.MockRuntime
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return rt, nil
+	}
+	reset := func() {
+		rt = &runtime.MockRuntime{Containers: []runtime.ContainerInfo{
+			{ID: "dead-running", Running: true, Labels: labels(deadPID)},
+			{ID: "dead-removable", Labels: labels(deadPID, removeLabel, "true")},
+			{ID: "dead-kept", Labels: labels(deadPID)},
+			{ID: "alive", Running: true, Labels: labels(alivePID, removeLabel, "true")},
+			{ID: "other-host", Running: true, Labels: map[string]string{managedLabel: "true", hostLabel: "elsewhere", pidLabel: deadPID}},
+			{ID: "other-pidns", Running: true, Labels: labels(deadPID, pidNSLabel, "4026531999")},
+			{ID: "keepalive", Running: true, Labels: map[string]string{managedLabel: "true", hostLabel: host, keepAliveLabel: "true"}},
+			{ID: "detached", Name: detachedName("python", "detached"), Running: true, Labels: labels(deadPID, removeLabel, "true")},
+		}}
+	}
+
+	t.Run("reap command", func(t *testing.T) {
+		reset()
+		output, err := executeCommand("reap")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dead-running", "dead-removable"}, rt.RemovedContainerIDs)
+		assert.Contains(t, output, "Removed 2 orphaned container(s)")
+	})
+
+	t.Run("on startup", func(t *testing.T) {
+		reset()
+		_, err := executeCommand("--image", "alpine", "ls")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dead-running", "dead-removable"}, rt.RemovedContainerIDs[:2])
+		require.NotNil(t, rt.CreatedConfig)
+		assert.Equal(t, strconv.Itoa(os.Getpid()), rt.CreatedConfig.Labels[pidLabel])
+		assert.Equal(t, pidNamespace(), rt.CreatedConfig.Labels[pidNSLabel])
+		assert.Equal(t, "true", rt.CreatedConfig.Labels[removeLabel])
+	})
+
+	t.Run("opt out", func(t *testing.T) {
+		t.Setenv("CDERUN_REAP_ORPHANS", "false")
+		reset()
+		_, err := executeCommand("--image", "alpine", "--remove=false", "ls")
+		require.NoError(t, err)
+		assert.Empty(t, rt.RemovedContainerIDs)
+		assert.Empty(t, rt.CreatedConfig.Labels[removeLabel])
+	})
+}
+
+// detachMockRuntime simulates the user typing the detach key sequence: attaching
+// returns ErrDetached and the container keeps running until the wait is canceled.
+type detachMockRuntime struct {
+	runtime.MockRuntime
+}
+
+func (m *detachMockRuntime) AttachContainer(ctx context.Context, containerID string, opts runtime.AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.MockRuntime.AttachContainer(ctx, containerID, opts, stdin, stdout, stderr)
+	return runtime.ErrDetached
+}
+
+func (m *detachMockRuntime) WaitContainer(ctx context.Context, containerID string) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestDetachAndAttach(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+	})
+	t.Setenv("CDERUN_REAP_ORPHANS", "false")
+
+	exitCode := -1
+	exitFunc = func(code int) { exitCode = code }
+	var rt runtime.ContainerRuntime
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return rt, nil
+	}
+
+	t.Run("detaching leaves the container running", func(t *testing.T) {
+		mock := &detachMockRuntime{MockRuntime: runtime.MockRuntime{CreatedContainerID: "c0ffee0000000001"}}
+		rt = mock
+		exitCode = -1
+		output, err := executeCommand("--image", "python:3", "--tty", "-i", "python")
+		require.NoError(t, err)
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "ctrl-p,ctrl-q", mock.AttachOptions.DetachKeys)
+		assert.True(t, mock.AttachOptions.Logs)
+		assert.Empty(t, mock.RemovedContainerIDs, "cleanup must be skipped")
+		assert.Equal(t, "c0ffee0000000001", mock.RenamedContainerID)
+		assert.Equal(t, "cderun-detached-python-c0ffee000000", mock.RenamedName)
+		assert.Contains(t, output, "reattach with: cderun attach cderun-detached-python-c0ffee000000")
+	})
+
+	t.Run("detach keys are configurable", func(t *testing.T) {
+		mock := &runtime.MockRuntime{CreatedContainerID: "c1"}
+		rt = mock
+		_, err := executeCommand("--image", "python:3", "--tty", "-i", "--detach-keys", "ctrl-x,x", "python")
+		require.NoError(t, err)
+		assert.Equal(t, "ctrl-x,x", mock.AttachOptions.DetachKeys)
+		assert.Empty(t, mock.RenamedContainerID)
+		assert.Equal(t, []string{"c1"}, mock.RemovedContainerIDs)
+
+		_, err = executeCommand("--image", "python:3", "--detach-keys", "ctrl-", "python")
+		assert.ErrorContains(t, err, "invalid detach keys")
+	})
+
+	containers := []runtime.ContainerInfo{
+		{
+			ID:      "aaaaaaaaaaaa1111",
+			Name:    "cderun-detached-python-aaaaaaaaaaaa",
+			Running: true,
+			Labels:  map[string]string{managedLabel: "true", toolLabel: "python", removeLabel: "true"},
+		},
+		{
+			ID:      "bbbbbbbbbbbb2222",
+			Name:    "brave_node",
+			Running: true,
+			Labels:  map[string]string{managedLabel: "true", toolLabel: "node", removeLabel: "true"},
+		},
+		{
+			ID:      "cccccccccccc3333",
+			Running: true,
+			Labels:  map[string]string{managedLabel: "true", toolLabel: "python", serviceLabel: "db"},
+		},
+		{
+			ID:      "dddddddddddd4444",
+			Running: true,
+			Labels:  map[string]string{managedLabel: "true", toolLabel: "node"},
+		},
+	}
+
+	t.Run("attach reconnects and removes the detached container on exit", func(t *testing.T) {
+		info := containers[0]
+		info.TTY, info.OpenStdin = true, true
+		mock := &runtime.MockRuntime{Containers: containers, InspectInfo: &info, ExitCode: 3}
+		rt = mock
+		exitCode = -1
+		_, err := executeCommand("attach", "python")
+		require.NoError(t, err)
+		assert.Equal(t, "aaaaaaaaaaaa1111", mock.AttachedContainerID)
+		assert.Equal(t, runtime.AttachOptions{TTY: true, DetachKeys: "ctrl-p,ctrl-q"}, mock.AttachOptions)
+		assert.Equal(t, 3, exitCode)
+		assert.Equal(t, []string{"aaaaaaaaaaaa1111"}, mock.RemovedContainerIDs)
+	})
+
+	t.Run("attach to a container still owned by its cderun process", func(t *testing.T) {
+		info := containers[1]
+		mock := &runtime.MockRuntime{Containers: containers, InspectInfo: &info}
+		rt = mock
+		_, err := executeCommand("attach", "--detach-keys", "ctrl-a", "brave_node")
+		require.NoError(t, err)
+		assert.Equal(t, "bbbbbbbbbbbb2222", mock.AttachedContainerID)
+		assert.Equal(t, "ctrl-a", mock.AttachOptions.DetachKeys)
+		assert.Empty(t, mock.RemovedContainerIDs, "the owning cderun process removes it")
+	})
+
+	t.Run("detaching again keeps the name", func(t *testing.T) {
+		info := containers[0]
+		info.TTY, info.OpenStdin = true, true
+		mock := &detachMockRuntime{MockRuntime: runtime.MockRuntime{Containers: containers, InspectInfo: &info}}
+		rt = mock
+		output, err := executeCommand("attach", "aaaa")
+		require.NoError(t, err)
+		assert.Empty(t, mock.RenamedContainerID)
+		assert.Empty(t, mock.RemovedContainerIDs)
+		assert.Contains(t, output, "cderun attach cderun-detached-python-aaaaaaaaaaaa")
+	})
+
+	t.Run("attach needs a unique running container", func(t *testing.T) {
+		rt = &runtime.MockRuntime{Containers: containers}
+		_, err := executeCommand("attach", "node")
+		assert.ErrorContains(t, err, `"node" matches 2 containers`)
+
+		_, err = executeCommand("attach", "ruby")
+		assert.ErrorContains(t, err, `no running cderun container matches "ruby"`)
+
+		_, err = executeCommand("attach")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"cderun/internal/container"
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ensureNetwork creates the requested network if it does not exist yet.
+// The returned function removes the network again when the spec asks for it and
+// no container is attached anymore; it is a no-op otherwise.
+func ensureNetwork(ctx context.Context, rt runtime.ContainerRuntime, spec *container.NetworkSpec) (func(), error) {
+	noop := func() {}
+
+	exists, err := rt.NetworkExists(ctx, spec.Name)
+	if err != nil {
+		return noop, fmt.Errorf("failed to inspect network %q: %w", spec.Name, err)
+	}
+	if !exists {
+		if spec.Labels == nil {
+			spec.Labels = map[string]string{managedLabel: "true"}
+		}
+		logging.Info("Creating network: %s", spec.Name)
+		if err := rt.CreateNetwork(ctx, spec); err != nil {
+			return noop, fmt.Errorf("failed to create network %q: %w", spec.Name, err)
+		}
+	} else {
+		logging.Debug("Network already exists: %s", spec.Name)
+	}
+
+	if !spec.Remove {
+		return noop, nil
+	}
+
+	cleanupCtx := context.WithoutCancel(ctx)
+	return func() {
+		logging.Trace("Removing network: %s", spec.Name)
+		err := rt.RemoveNetwork(cleanupCtx, spec.Name)
+		if errors.Is(err, runtime.ErrNetworkInUse) {
+			logging.Debug("Network %s is still in use, keeping it", spec.Name)
+		} else if err != nil {
+			logging.Warn("failed to remove network %s: %v", spec.Name, err)
+		}
+	}, nil
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package command
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// pidNamespace returns the inode of the PID namespace of this process, or an
+// empty string where namespaces do not exist. The same PID in two namespaces
+// refers to different processes, e.g. for a cderun running inside a container.
+func pidNamespace() string {
+	link, err := os.Readlink("/proc/self/ns/pid")
+	if err != nil {
+		return ""
+	}
+	// The link reads "pid:[4026531836]"
+	return strings.TrimSuffix(strings.TrimPrefix(link, "pid:["), "]")
+}
@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package command
+
+import "os"
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	// On Windows, FindProcess opens the process and fails if it does not exist
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// pidNamespace returns an empty string since Windows has no PID namespaces.
+func pidNamespace() string {
+	return ""
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"cderun/internal/secret"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reapOrphans removes containers left behind by cderun processes on this host
+// and in this PID namespace that no longer exist, e.g. after SIGKILL, an OOM
+// kill or a host crash, together with the secrets directories of those processes.
+// It returns the IDs of the removed containers.
+func reapOrphans(ctx context.Context, rt runtime.ContainerRuntime) ([]string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	containers, err := rt.ListContainers(ctx, runtime.ContainerFilter{
+		Labels: map[string]string{managedLabel: "", hostLabel: host, pidLabel: ""},
+		All:    true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	dirs, err := secret.RemoveStale(secretsOwnerGone)
+	for _, dir := range dirs {
+		logging.Info("Removed stale secrets directory %s", dir)
+	}
+	if err != nil {
+		logging.Warn("failed to remove stale secrets: %v", err)
+	}
+
+	var removed []string
+	for _, c := range containers {
+		if !isOrphan(c, host) {
+			continue
+		}
+		logging.Info("Removing orphaned container %s (tool %s, pid %s)", shortID(c.ID), c.Labels[toolLabel], c.Labels[pidLabel])
+		if err := rt.RemoveContainer(ctx, c.ID); err != nil {
+			logging.Warn("failed to remove orphaned container %s: %v", shortID(c.ID), err)
+			continue
+		}
+		removed = append(removed, c.ID)
+	}
+	return removed, nil
+}
+
+// secretsOwner identifies this process in the name of its secrets directory as
+// "<pidns>.<pid>".
+func secretsOwner() string {
+	return pidNamespace() + "." + strconv.Itoa(os.Getpid())
+}
+
+// secretsOwnerGone reports whether the process identified by secretsOwner no
+// longer exists. Owners in other PID namespaces are never considered gone.
+func secretsOwnerGone(owner string) bool {
+	ns, p, ok := strings.Cut(owner, ".")
+	if !ok || ns != pidNamespace() {
+		return false
+	}
+	pid, err := strconv.Atoi(p)
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return pid != os.Getpid() && !processAlive(pid)
+}
+
+// isOrphan reports whether the cderun process owning the container is gone and
+// the container would have been cleaned up by it. Stopped containers of runs
+// with --remove=false and running containers the user detached from are kept on purpose.
+func isOrphan(c runtime.ContainerInfo, host string) bool {
+	if c.Labels[keepAliveLabel] == "true" {
+		return false
+	}
+	if c.Running && isDetached(c.Name) {
+		return false
+	}
+	if alive, known := ownerAlive(c, host); !known || alive {
+		return false
+	}
+	return c.Running || c.Labels[removeLabel] == "true"
+}
+
+// ownerAlive reports whether the cderun process that started the container is
+// still running. known is false when this cannot be checked: the container has
+// no PID, or comes from another host or PID namespace (e.g. a cderun inside a
+// container sharing the hostname).
+func ownerAlive(c runtime.ContainerInfo, host string) (alive, known bool) {
+	if c.Labels[hostLabel] != host || c.Labels[pidNSLabel] != pidNamespace() {
+		return false, false
+	}
+	pid, err := strconv.Atoi(c.Labels[pidLabel])
+	if err != nil || pid <= 0 {
+		return false, false
+	}
+	return pid == os.Getpid() || processAlive(pid), true
+}
@@ -5,10 +5,13 @@ import (
 	"context"
 	"io"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type blockingMockRuntime struct {
@@ -17,7 +20,7 @@ type blockingMockRuntime struct {
 	blockAttach   chan struct{}
 }
 
-func (m *blockingMockRuntime) AttachContainer(ctx context.Context, containerID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+func (m *blockingMockRuntime) AttachContainer(ctx context.Context, containerID string, opts runtime.AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
 	m.AttachedContainerID = containerID
 	close(m.attachStarted)
 	select {
@@ -52,7 +55,7 @@ func TestExecuteRobustness(t *testing.T) {
 		// Run execute in a goroutine because we want to check if it finishes
 		done := make(chan struct{})
 		go func() {
-			_, _ = executeCommand("--image", "alpine", "ls")
+			_, _ = executeCommand("--image", "alpine", "--drain-timeout", "200ms", "ls")
 			close(done)
 		}()
 
@@ -65,7 +68,7 @@ func TestExecuteRobustness(t *testing.T) {
 		}
 
 		// executeCommand should eventually finish because WaitContainer returns immediately
-		// and AttachContainer will be canceled after 500ms grace period.
+		// and AttachContainer will be canceled after the drain timeout.
 		select {
 		case <-done:
 			// Success
@@ -77,10 +80,13 @@ func TestExecuteRobustness(t *testing.T) {
 	t.Run("handles double Ctrl+C to terminate", func(t *testing.T) {
 		oldFactory := runtimeFactory
 		oldExit := exitFunc
+		oldKill := killGracePeriod
 		defer func() {
 			runtimeFactory = oldFactory
 			exitFunc = oldExit
+			killGracePeriod = oldKill
 		}()
+		killGracePeriod = 50 * time.Millisecond
 
 		// Use a mock that blocks in WaitContainer to simulate long running process
 		mock := &blockingMockRuntime{
@@ -105,7 +111,8 @@ func TestExecuteRobustness(t *testing.T) {
 			}, nil
 		}
 
-		exitFunc = func(code int) {}
+		capturedExitCode := -1
+		exitFunc = func(code int) { capturedExitCode = code }
 
 		done := make(chan struct{})
 		go func() {
@@ -145,6 +152,59 @@ func TestExecuteRobustness(t *testing.T) {
 		case <-time.After(2 * time.Second):
 			t.Fatal("Process did not exit after second SIGINT")
 		}
+
+		// Forwarded, then stopped gracefully and killed when it did not exit
+		assert.Equal(t, []string{"SIGINT"}, mock.Signals)
+		assert.Equal(t, []string{"test-container", "test-container"}, mock.StoppedContainerIDs)
+		assert.Equal(t, time.Duration(0), mock.StopTimeout)
+		assert.Equal(t, 130, capturedExitCode)
+	})
+
+	t.Run("double Ctrl+C stops gracefully and reports the signal", func(t *testing.T) {
+		oldFactory := runtimeFactory
+		oldExit := exitFunc
+		oldWd, _ := os.Getwd()
+		defer func() {
+			runtimeFactory = oldFactory
+			exitFunc = oldExit
+			os.Chdir(oldWd)
+		}()
+		os.Chdir(t.TempDir())
+		os.WriteFile(".tools.yaml", []byte("nginx:\n  image: nginx\n  stopSignal: SIGQUIT\n  stopTimeout: 3s\n"), 0644)
+
+		mock := &stoppableMock{started: make(chan struct{}), stopped: make(chan struct{}), exitCode: 0}
+		mock.CreatedContainerID = "test-container"
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return mock, nil
+		}
+		capturedExitCode := -1
+		exitFunc = func(code int) { capturedExitCode = code }
+
+		done := make(chan struct{})
+		go func() {
+			_, _ = executeCommand("nginx")
+			close(done)
+		}()
+
+		// The signal handler is installed before the container is started
+		select {
+		case <-mock.started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("StartContainer was not called")
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		time.Sleep(50 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Process did not exit after being stopped")
+		}
+		assert.Equal(t, "SIGQUIT", mock.CreatedConfig.StopSignal)
+		assert.Equal(t, []string{"test-container"}, mock.StoppedContainerIDs)
+		assert.Equal(t, 3*time.Second, mock.StopTimeout)
+		assert.Equal(t, 128+int(syscall.SIGTERM), capturedExitCode)
 	})
 
 	t.Run("returns non-zero exit code correctly", func(t *testing.T) {
@@ -183,6 +243,34 @@ func TestExecuteRobustness(t *testing.T) {
 	})
 }
 
+// stoppableMock exits with exitCode once StopContainer is called.
+type stoppableMock struct {
+	runtime.MockRuntime
+	started  chan struct{}
+	stopped  chan struct{}
+	exitCode int
+}
+
+func (m *stoppableMock) StartContainer(ctx context.Context, containerID string) error {
+	close(m.started)
+	return nil
+}
+
+func (m *stoppableMock) StopContainer(ctx context.Context, containerID string, timeout time.Duration) error {
+	_ = m.MockRuntime.StopContainer(ctx, containerID, timeout)
+	close(m.stopped)
+	return nil
+}
+
+func (m *stoppableMock) WaitContainer(ctx context.Context, containerID string) (int, error) {
+	select {
+	case <-m.stopped:
+		return m.exitCode, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
 type waitBlockingMock struct {
 	*blockingMockRuntime
 	waitStarted chan struct{}
@@ -199,3 +287,261 @@ func (m *waitBlockingMock) WaitContainer(ctx context.Context, containerID string
 		return 0, ctx.Err()
 	}
 }
+
+func TestForwardSignals(t *testing.T) {
+	t.Run("forwards every signal and escalates interrupts", func(t *testing.T) {
+		mock := &runtime.MockRuntime{}
+		f := &signalForwarder{rt: mock, containerID: "c1", tty: true, stopTimeout: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sigChan := make(chan os.Signal)
+		done := make(chan struct{})
+		go func() {
+			f.run(ctx, cancel, sigChan)
+			close(done)
+		}()
+
+		sigChan <- syscall.SIGHUP
+		sigChan <- syscall.SIGUSR1
+		sigChan <- syscall.SIGTSTP // Only forwarded with a TTY
+		sigChan <- syscall.SIGINT
+		sigChan <- syscall.SIGTERM
+		sigChan <- syscall.SIGINT
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("third interrupt did not cancel")
+		}
+		assert.Error(t, ctx.Err())
+		assert.Equal(t, []string{"SIGHUP", "SIGUSR1", "SIGTSTP", "SIGINT"}, mock.Signals)
+		code, ok := f.exitCode()
+		assert.True(t, ok)
+		assert.Equal(t, 130, code)
+	})
+
+	t.Run("exec sessions cannot be signaled without sh", func(t *testing.T) {
+		mock := &runtime.MockRuntime{ExecID: "kill-1", ExecExitCode: 127}
+		err := signalExecSession(context.Background(), mock, "c1", "", "CDERUN_EXEC_ID=0123", "SIGTERM")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the image has no sh")
+	})
+
+	t.Run("exec sessions are signaled inside the container", func(t *testing.T) {
+		mock := &runtime.MockRuntime{ExecID: "kill-1"}
+		var sent []string
+		killed := make(chan struct{})
+		f := &signalForwarder{rt: mock, containerID: "c1", execSignal: func(ctx context.Context, name string) error {
+			sent = append(sent, name)
+			err := signalExecSession(ctx, mock, "c1", "node", "CDERUN_EXEC_ID=0123", name)
+			if name == "SIGKILL" {
+				close(killed)
+			}
+			return err
+		}}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sigChan := make(chan os.Signal)
+		done := make(chan struct{})
+		go func() {
+			f.run(ctx, cancel, sigChan)
+			close(done)
+		}()
+
+		sigChan <- syscall.SIGUSR1
+		sigChan <- syscall.SIGTERM
+		sigChan <- syscall.SIGTERM // Kills the session
+		<-killed
+		sigChan <- syscall.SIGTERM
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("third interrupt did not cancel")
+		}
+		assert.Empty(t, mock.Signals, "the container is not signaled")
+		assert.Equal(t, []string{"SIGUSR1", "SIGTERM", "SIGKILL"}, sent)
+		require.Len(t, mock.ExecConfigs, 3)
+		assert.Equal(t, []string{"sh", "-c", execSignalScript, "sh", "CDERUN_EXEC_ID=0123", "USR1"}, mock.ExecConfigs[0].Command)
+		assert.Equal(t, "node", mock.ExecConfigs[0].User)
+		assert.Equal(t, "KILL", mock.ExecConfigs[2].Command[5])
+		code, ok := f.exitCode()
+		assert.True(t, ok)
+		assert.Equal(t, 143, code)
+	})
+
+	t.Run("lookupSignals always includes interrupts", func(t *testing.T) {
+		signals := lookupSignals([]string{"SIGHUP", "SIGUNKNOWN"})
+		assert.ElementsMatch(t, []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM}, signals)
+		assert.Equal(t, "SIGQUIT", getSignalName(syscall.SIGQUIT))
+	})
+}
+
+// delayedOutputMockRuntime writes output some time after the container has exited,
+// like a slow daemon delivering the last output of a test reporter.
+type delayedOutputMockRuntime struct {
+	runtime.MockRuntime
+	delay  time.Duration
+	output string
+}
+
+func (m *delayedOutputMockRuntime) AttachContainer(ctx context.Context, containerID string, opts runtime.AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.AttachedContainerID = containerID
+	select {
+	case <-time.After(m.delay):
+		_, err := io.WriteString(stdout, m.output)
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestDrainOutput(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+	})
+	exitFunc = func(int) {}
+
+	var mock *delayedOutputMockRuntime
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	t.Run("late output is not truncated", func(t *testing.T) {
+		mock = &delayedOutputMockRuntime{delay: 800 * time.Millisecond, output: "PASS: 1024 tests\n"}
+
+		output, err := executeCommand("--image", "alpine", "go", "test")
+		require.NoError(t, err)
+		assert.Contains(t, output, "PASS: 1024 tests")
+	})
+
+	t.Run("0 waits until the output ends", func(t *testing.T) {
+		mock = &delayedOutputMockRuntime{delay: 300 * time.Millisecond, output: "done\n"}
+
+		output, err := executeCommand("--image", "alpine", "--drain-timeout", "0", "go", "test")
+		require.NoError(t, err)
+		assert.Contains(t, output, "done")
+	})
+
+	t.Run("returns as soon as the output ends", func(t *testing.T) {
+		mock = &delayedOutputMockRuntime{output: "fast\n"}
+
+		start := time.Now()
+		output, err := executeCommand("--image", "alpine", "echo", "fast")
+		require.NoError(t, err)
+		assert.Contains(t, output, "fast")
+		assert.Less(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("hanging stream is closed after the timeout", func(t *testing.T) {
+		mock = &delayedOutputMockRuntime{delay: time.Hour, output: "never"}
+
+		start := time.Now()
+		output, err := executeCommand("--image", "alpine", "--drain-timeout", "100ms", "sleep")
+		require.NoError(t, err)
+		assert.NotContains(t, output, "never")
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		mock = &delayedOutputMockRuntime{}
+
+		_, err := executeCommand("--image", "alpine", "--drain-timeout", "soon", "ls")
+		assert.ErrorContains(t, err, "invalid drain timeout")
+	})
+}
+
+// echoMockRuntime copies stdin to stdout until EOF, like "cat".
+type echoMockRuntime struct {
+	runtime.MockRuntime
+	gotStdin bool
+}
+
+func (m *echoMockRuntime) AttachContainer(ctx context.Context, containerID string, opts runtime.AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.AttachedContainerID = containerID
+	if stdin == nil {
+		return nil
+	}
+	m.gotStdin = true
+	_, err := io.Copy(stdout, stdin)
+	return err
+}
+
+func TestPipedStdin(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldStdin := os.Stdin
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Stdin = oldStdin
+	})
+	exitFunc = func(int) {}
+
+	var mock *echoMockRuntime
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	pipeStdin := func(t *testing.T, data string) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() { r.Close() })
+		go func() {
+			_, _ = io.WriteString(w, data)
+			w.Close()
+		}()
+		os.Stdin = r
+	}
+
+	t.Run("pipe is attached without -i", func(t *testing.T) {
+		mock = &echoMockRuntime{}
+		pipeStdin(t, `{"a":1}`)
+
+		output, err := executeCommand("--image", "alpine", "cat")
+		require.NoError(t, err)
+		assert.True(t, mock.gotStdin)
+		assert.True(t, mock.CreatedConfig.Interactive)
+		assert.Contains(t, output, `{"a":1}`)
+	})
+
+	t.Run("regular file is attached", func(t *testing.T) {
+		mock = &echoMockRuntime{}
+		path := filepath.Join(t.TempDir(), "input.txt")
+		require.NoError(t, os.WriteFile(path, []byte("from file"), 0644))
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		os.Stdin = f
+
+		output, err := executeCommand("--image", "alpine", "wc")
+		require.NoError(t, err)
+		assert.True(t, mock.gotStdin)
+		assert.Contains(t, output, "from file")
+	})
+
+	t.Run("auto-stdin can be disabled", func(t *testing.T) {
+		mock = &echoMockRuntime{}
+		pipeStdin(t, "ignored")
+
+		_, err := executeCommand("--image", "alpine", "--auto-stdin=false", "cat")
+		require.NoError(t, err)
+		assert.False(t, mock.gotStdin)
+		assert.False(t, mock.CreatedConfig.Interactive)
+	})
+
+	t.Run("device stdin is not attached", func(t *testing.T) {
+		mock = &echoMockRuntime{}
+		devNull, err := os.Open(os.DevNull)
+		require.NoError(t, err)
+		defer devNull.Close()
+		os.Stdin = devNull
+
+		_, err = executeCommand("--image", "alpine", "cat")
+		require.NoError(t, err)
+		assert.False(t, mock.gotStdin)
+	})
+}
@@ -5,15 +5,19 @@ import (
 	"cderun/internal/container"
 	"cderun/internal/logging"
 	"cderun/internal/runtime"
+	"cderun/internal/secret"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"time"
 	"strings"
+	"sync/atomic"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -21,15 +25,15 @@ import (
 )
 
 type rootOptions struct {
-	tty                 bool
-	interactive         bool
+	tty                 config.BoolOrAuto
+	interactive         config.BoolOrAuto
 	network             string
 	mountSocket         string
 	mountCderun         bool
 	image               string
 	remove              bool
-	cderunTTY           bool
-	cderunInteractive   bool
+	cderunTTY           config.BoolOrAuto
+	cderunInteractive   config.BoolOrAuto
 	cderunImage         string
 	cderunNetwork       string
 	cderunRemove        bool
@@ -62,6 +66,36 @@ type rootOptions struct {
 	cderunLogFormat      string
 	cderunLogTee         bool
 	cderunVerbose        int
+	forwardSSHAgent          bool
+	forwardGitConfig         bool
+	cderunForwardSSHAgent    bool
+	cderunForwardGitConfig   bool
+	publish                  []string
+	cderunPublish            []string
+	publishAll               bool
+	cderunPublishAll         bool
+	networkAliases           []string
+	cderunNetworkAliases     []string
+	addHosts                 []string
+	cderunAddHosts           []string
+	servicesLogs             bool
+	cderunServicesLogs       bool
+	keepAlive                bool
+	cderunKeepAlive          bool
+	autoStdin                bool
+	cderunAutoStdin          bool
+	detachKeys               string
+	cderunDetachKeys         string
+	drainTimeout             string
+	cderunDrainTimeout       string
+	splitStreams             bool
+	cderunSplitStreams       bool
+	outputLog                string
+	cderunOutputLog          string
+	outputLogFormat          string
+	cderunOutputLogFormat    string
+	capture                  []string
+	cderunCapture            []string
 }
 
 var (
@@ -81,6 +115,29 @@ var (
 	}
 )
 
+// initEarlyLogging initializes the logger from CLI flags and environment only.
+func (o *rootOptions) initEarlyLogging() {
+	initialLevel := "info"
+	vLevel := o.verbose
+	if o.cderunVerbose > vLevel {
+		vLevel = o.cderunVerbose
+	}
+	if vLevel >= 3 {
+		initialLevel = "trace"
+	} else if vLevel >= 2 {
+		initialLevel = "debug"
+	}
+	if env := os.Getenv("CDERUN_LOG_LEVEL"); env != "" {
+		initialLevel = env
+	}
+	if o.cderunLogLevel != "" {
+		initialLevel = o.cderunLogLevel
+	} else if o.logLevel != "" {
+		initialLevel = o.logLevel
+	}
+	_ = logging.Init(initialLevel, "text", "", false, true)
+}
+
 func (o *rootOptions) loadConfigs() (config.ToolsConfig, *config.CDERunConfig) {
 	logging.Trace("Loading configurations...")
 	globalCfg, path, err := config.LoadCDERunConfig()
@@ -173,24 +230,135 @@ func (o *rootOptions) resolveSettings(cmd *cobra.Command, subcommand string, too
 		CderunLogTee:          o.cderunLogTee,
 		CderunLogTeeSet:       cmd.Flags().Changed("cderun-log-tee"),
 		CderunVerbose:         o.cderunVerbose,
+		ForwardSSHAgent:           o.forwardSSHAgent,
+		ForwardSSHAgentSet:        cmd.Flags().Changed("forward-ssh-agent"),
+		CderunForwardSSHAgent:     o.cderunForwardSSHAgent,
+		CderunForwardSSHAgentSet:  cmd.Flags().Changed("cderun-forward-ssh-agent"),
+		ForwardGitConfig:          o.forwardGitConfig,
+		ForwardGitConfigSet:       cmd.Flags().Changed("forward-git-config"),
+		CderunForwardGitConfig:    o.cderunForwardGitConfig,
+		CderunForwardGitConfigSet: cmd.Flags().Changed("cderun-forward-git-config"),
+		Publish:                   o.publish,
+		CderunPublish:             o.cderunPublish,
+		PublishAll:                o.publishAll,
+		PublishAllSet:             cmd.Flags().Changed("publish-all"),
+		CderunPublishAll:          o.cderunPublishAll,
+		CderunPublishAllSet:       cmd.Flags().Changed("cderun-publish-all"),
+		NetworkAliases:            o.networkAliases,
+		CderunNetworkAliases:      o.cderunNetworkAliases,
+		AddHosts:                  o.addHosts,
+		CderunAddHosts:            o.cderunAddHosts,
+		ServicesLogs:              o.servicesLogs,
+		ServicesLogsSet:           cmd.Flags().Changed("services-logs"),
+		CderunServicesLogs:        o.cderunServicesLogs,
+		CderunServicesLogsSet:     cmd.Flags().Changed("cderun-services-logs"),
+		KeepAlive:                 o.keepAlive,
+		KeepAliveSet:              cmd.Flags().Changed("keep-alive"),
+		CderunKeepAlive:           o.cderunKeepAlive,
+		CderunKeepAliveSet:        cmd.Flags().Changed("cderun-keep-alive"),
+		AutoStdin:                 o.autoStdin,
+		AutoStdinSet:              cmd.Flags().Changed("auto-stdin"),
+		CderunAutoStdin:           o.cderunAutoStdin,
+		CderunAutoStdinSet:        cmd.Flags().Changed("cderun-auto-stdin"),
+		DetachKeys:                o.detachKeys,
+		DetachKeysSet:             cmd.Flags().Changed("detach-keys"),
+		CderunDetachKeys:          o.cderunDetachKeys,
+		CderunDetachKeysSet:       cmd.Flags().Changed("cderun-detach-keys"),
+		DrainTimeout:              o.drainTimeout,
+		DrainTimeoutSet:           cmd.Flags().Changed("drain-timeout"),
+		CderunDrainTimeout:        o.cderunDrainTimeout,
+		CderunDrainTimeoutSet:     cmd.Flags().Changed("cderun-drain-timeout"),
+		SplitStreams:              o.splitStreams,
+		SplitStreamsSet:           cmd.Flags().Changed("split-streams"),
+		CderunSplitStreams:        o.cderunSplitStreams,
+		CderunSplitStreamsSet:     cmd.Flags().Changed("cderun-split-streams"),
+		OutputLog:                 o.outputLog,
+		OutputLogSet:              cmd.Flags().Changed("output-log"),
+		CderunOutputLog:           o.cderunOutputLog,
+		CderunOutputLogSet:        cmd.Flags().Changed("cderun-output-log"),
+		OutputLogFormat:           o.outputLogFormat,
+		OutputLogFormatSet:        cmd.Flags().Changed("output-log-format"),
+		CderunOutputLogFormat:     o.cderunOutputLogFormat,
+		CderunOutputLogFormatSet:  cmd.Flags().Changed("cderun-output-log-format"),
+		Capture:                   o.capture,
+		CderunCapture:             o.cderunCapture,
 	}
 
 	return config.Resolve(subcommand, cliOpts, toolsCfg, globalCfg)
 }
 
 func (o *rootOptions) buildContainerConfig(resolved *config.ResolvedConfig, subcommand string, passthroughArgs []string, toolsCfg config.ToolsConfig) (*container.ContainerConfig, error) {
+	tty, ttyNote := decideContainerTTY(resolved)
+	if ttyNote != "" {
+		logging.Debug("TTY decided: %v (%s)", tty, ttyNote)
+	}
+	interactive, interactiveReason := decideInteractive(resolved.Interactive)
+	if interactiveReason != "" {
+		logging.Debug("Interactive auto-detected: %v (%s)", interactive, interactiveReason)
+	}
+
 	// Build ContainerConfig
 	containerConfig := &container.ContainerConfig{
-		Image:       resolved.Image,
-		Command:     []string{subcommand},
-		Args:        passthroughArgs,
-		TTY:         resolved.TTY,
-		Interactive: resolved.Interactive,
-		Network:     resolved.Network,
-		Remove:      resolved.Remove,
-		Volumes:     resolved.Volumes,
-		Env:         resolved.Env,
-		Workdir:     resolved.Workdir,
+		Image:          resolved.Image,
+		Command:        []string{subcommand},
+		Args:           passthroughArgs,
+		TTY:            tty,
+		Interactive:    interactive,
+		Network:        resolved.Network,
+		NetworkAliases: resolved.NetworkAliases,
+		NetworkCreate:  resolved.NetworkCreate,
+		ExtraHosts:     resolved.ExtraHosts,
+		Ports:          resolved.Ports,
+		PublishAll:     resolved.PublishAll,
+		Remove:         resolved.Remove,
+		StopSignal:     resolved.StopSignal,
+		StopTimeout:    resolved.StopTimeout,
+		Volumes:        resolved.Volumes,
+		Env:            resolved.Env,
+		Workdir:        resolved.Workdir,
+		User:           resolved.User,
+		Secrets:        resolved.Secrets,
+		Services:       resolved.Services,
+	}
+
+	if resolved.Build != nil || len(resolved.Packages) > 0 {
+		spec, image, err := buildSpec(resolved, subcommand)
+		if err != nil {
+			return nil, err
+		}
+		containerConfig.Build = spec
+		containerConfig.Image = image
+	}
+
+	if resolved.KeepAlive {
+		if len(containerConfig.Services) > 0 || len(containerConfig.Secrets) > 0 {
+			// Services and secrets only live as long as a single run
+			logging.Warn("keepAlive is not supported together with services or secrets, running without it")
+		} else {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get working directory: %w", err)
+			}
+			containerConfig.KeepAlive = &container.KeepAliveSpec{
+				Name:        keepAliveName(subcommand, cwd),
+				IdleTimeout: resolved.IdleTimeout,
+				Command:     resolved.KeepAliveCommand,
+			}
+		}
+	}
+
+	// Attach piped or redirected stdin even without --interactive (e.g. "cat data.json | cderun jq .")
+	if !containerConfig.Interactive && resolved.AutoStdin && stdinIsPipe() {
+		logging.Debug("Stdin is not a terminal, attaching it")
+		containerConfig.Interactive = true
+	}
+
+	// Handle credential forwarding
+	if resolved.ForwardSSHAgent {
+		containerConfig.Volumes, containerConfig.Env = forwardSSHAgent(containerConfig.Volumes, containerConfig.Env, resolved.Runtime, resolved.Socket)
+	}
+	if resolved.ForwardGitConfig {
+		containerConfig.Volumes = forwardGitConfig(containerConfig.Volumes)
 	}
 
 	// Handle mounting flags
@@ -248,8 +416,18 @@ func (o *rootOptions) buildContainerConfig(resolved *config.ResolvedConfig, subc
 	return containerConfig, nil
 }
 
-func (o *rootOptions) handleDryRun(containerConfig *container.ContainerConfig, dryRunFormat string) error {
-	switch strings.ToLower(dryRunFormat) {
+func (o *rootOptions) handleDryRun(containerConfig *container.ContainerConfig, resolved *config.ResolvedConfig) error {
+	// Show how "auto" settings were decided, e.g. "false (auto: stdin is not a terminal)"
+	_, ttyNote := decideContainerTTY(resolved)
+	interactiveNote := autoNote(resolved.Interactive, decideInteractive)
+	withNote := func(v bool, note string) string {
+		if note == "" {
+			return fmt.Sprint(v)
+		}
+		return fmt.Sprintf("%v (%s)", v, note)
+	}
+
+	switch strings.ToLower(resolved.DryRunFormat) {
 	case "json":
 		data, err := json.MarshalIndent(containerConfig, "", "  ")
 		if err != nil {
@@ -258,14 +436,39 @@ func (o *rootOptions) handleDryRun(containerConfig *container.ContainerConfig, d
 		fmt.Println(string(data))
 	case "simple":
 		fmt.Printf("Image: %s\n", containerConfig.Image)
+		if b := containerConfig.Build; b != nil && b.Inline != "" {
+			fmt.Println("Build steps:")
+			for _, step := range strings.Split(strings.TrimSpace(b.Inline), "\n") {
+				fmt.Printf("  %s\n", step)
+			}
+		} else if b != nil {
+			fmt.Printf("Build: %s (dockerfile %s)\n", b.Context, b.Dockerfile)
+		}
 		fullCmd := strings.Join(containerConfig.Command, " ")
 		if len(containerConfig.Args) > 0 {
 			fullCmd += " " + strings.Join(containerConfig.Args, " ")
 		}
 		fmt.Printf("Command: %s\n", fullCmd)
-		fmt.Printf("TTY: %v\n", containerConfig.TTY)
-		fmt.Printf("Interactive: %v\n", containerConfig.Interactive)
+		fmt.Printf("TTY: %s\n", withNote(containerConfig.TTY, ttyNote))
+		fmt.Printf("Interactive: %s\n", withNote(containerConfig.Interactive, interactiveNote))
 		fmt.Printf("Network: %s\n", containerConfig.Network)
+		if containerConfig.NetworkCreate != nil {
+			fmt.Printf("NetworkCreate: internal=%v, remove=%v\n", containerConfig.NetworkCreate.Internal, containerConfig.NetworkCreate.Remove)
+		}
+		if len(containerConfig.NetworkAliases) > 0 {
+			fmt.Printf("NetworkAliases: %s\n", strings.Join(containerConfig.NetworkAliases, ", "))
+		}
+		if len(containerConfig.ExtraHosts) > 0 {
+			fmt.Printf("ExtraHosts: %s\n", strings.Join(containerConfig.ExtraHosts, ", "))
+		}
+		if len(containerConfig.Ports) > 0 || containerConfig.PublishAll {
+			var ports []string
+			for _, p := range containerConfig.Ports {
+				ports = append(ports, formatPort(p))
+			}
+			fmt.Printf("Ports: %s\n", strings.Join(ports, ", "))
+			fmt.Printf("PublishAll: %v\n", containerConfig.PublishAll)
+		}
 		fmt.Printf("Remove: %v\n", containerConfig.Remove)
 		var volumes []string
 		for _, v := range containerConfig.Volumes {
@@ -274,11 +477,38 @@ func (o *rootOptions) handleDryRun(containerConfig *container.ContainerConfig, d
 		fmt.Printf("Volumes: %s\n", strings.Join(volumes, ", "))
 		fmt.Printf("Env: %s\n", strings.Join(containerConfig.Env, ", "))
 		fmt.Printf("Workdir: %s\n", containerConfig.Workdir)
+		if containerConfig.User != "" {
+			fmt.Printf("User: %s\n", containerConfig.User)
+		}
+		if len(containerConfig.Secrets) > 0 {
+			var secrets []string
+			for _, s := range containerConfig.Secrets {
+				secrets = append(secrets, fmt.Sprintf("%s(%s):%s", s.Name, s.SourceType, s.ContainerPath))
+			}
+			fmt.Printf("Secrets: %s\n", strings.Join(secrets, ", "))
+		}
+		if containerConfig.KeepAlive != nil {
+			fmt.Printf("KeepAlive: %s (idle timeout %s)\n", containerConfig.KeepAlive.Name, containerConfig.KeepAlive.IdleTimeout)
+		}
+		if len(containerConfig.Services) > 0 {
+			var services []string
+			for _, s := range containerConfig.Services {
+				services = append(services, fmt.Sprintf("%s(%s)", s.Name, s.Image))
+			}
+			fmt.Printf("Services: %s\n", strings.Join(services, ", "))
+		}
 	default: // Default to YAML
 		data, err := yaml.Marshal(containerConfig)
 		if err != nil {
 			return fmt.Errorf("failed to marshal YAML: %w", err)
 		}
+		// JSON has no comments, the decisions are in the debug log there
+		if ttyNote != "" {
+			fmt.Printf("# tty: %s\n", withNote(containerConfig.TTY, ttyNote))
+		}
+		if interactiveNote != "" {
+			fmt.Printf("# interactive: %s\n", withNote(containerConfig.Interactive, interactiveNote))
+		}
 		fmt.Print(string(data))
 	}
 	return nil
@@ -293,12 +523,81 @@ func (o *rootOptions) execute(ctx context.Context, resolved *config.ResolvedConf
 	ctxG, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// Set when the user detaches; the container and its network are then left running
+	var detached atomic.Bool
+
 	// Initialize Runtime
 	rt, err := runtimeFactory(resolved.Runtime, resolved.Socket)
 	if err != nil {
 		return 0, fmt.Errorf("failed to initialize runtime: %w", err)
 	}
 
+	if resolved.ReapOrphans {
+		if _, err := reapOrphans(ctx, rt); err != nil {
+			logging.Warn("failed to clean up orphaned containers: %v", err)
+		}
+		if containerConfig.KeepAlive == nil {
+			// Keep-alive runs do this themselves
+			reapIdleKeepAlive(ctx, rt, resolved.Socket)
+		}
+	}
+
+	if containerConfig.Build != nil {
+		if err := ensureImage(ctx, rt, containerConfig, o.verbose > 0 || o.cderunVerbose > 0); err != nil {
+			return 0, err
+		}
+	}
+
+	if containerConfig.NetworkCreate != nil {
+		removeNetwork, err := ensureNetwork(ctx, rt, containerConfig.NetworkCreate)
+		if err != nil {
+			return 0, err
+		}
+		// Registered before the container cleanup so it runs after the container is gone
+		defer func() {
+			if !detached.Load() {
+				removeNetwork()
+			}
+		}()
+	}
+
+	containerConfig.Labels = runLabels(containerConfig.Command[0], containerConfig.Labels)
+	if containerConfig.Remove {
+		containerConfig.Labels[removeLabel] = "true"
+	}
+
+	output, err := openOutputCapture(resolved)
+	if err != nil {
+		return 0, err
+	}
+	// Registered first so it runs after the output is drained
+	defer output.Close()
+
+	if containerConfig.KeepAlive != nil {
+		return runKeepAlive(ctx, rt, resolved, containerConfig, output)
+	}
+
+	if len(containerConfig.Services) > 0 {
+		stopServices, err := startServices(ctx, rt, containerConfig, resolved.ServicesLogs)
+		// Registered before the container cleanup so services outlive the main container
+		defer stopServices()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Materialize secrets right before creation so their values never reach the config or logs
+	secretMounts, cleanupSecrets, err := secret.Materialize(containerConfig.Secrets, secretsOwner())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare secrets: %w", err)
+	}
+	// Secrets are mounted as files, so a detached container keeps them after this cleanup
+	defer cleanupSecrets()
+	for i, m := range secretMounts {
+		logging.Debug("Mounting secret %s at %s", containerConfig.Secrets[i].Name, m.ContainerPath)
+	}
+	containerConfig.Volumes = append(containerConfig.Volumes, secretMounts...)
+
 	logging.Trace("Creating container...")
 	containerID, err := rt.CreateContainer(ctx, containerConfig)
 	if err != nil {
@@ -308,6 +607,9 @@ func (o *rootOptions) execute(ctx context.Context, resolved *config.ResolvedConf
 	if containerConfig.Remove {
 		cleanupCtx := context.WithoutCancel(ctx)
 		defer func() {
+			if detached.Load() {
+				return
+			}
 			logging.Trace("Removing container: %s", containerID)
 			if err := rt.RemoveContainer(cleanupCtx, containerID); err != nil {
 				logging.Warn("failed to remove container (defer): %v", err)
@@ -316,72 +618,31 @@ func (o *rootOptions) execute(ctx context.Context, resolved *config.ResolvedConf
 	}
 
 	// Set up terminal raw mode if TTY is requested and we are in a terminal
-	if containerConfig.TTY && term.IsTerminal(int(os.Stdin.Fd())) {
-		logging.Trace("Setting terminal to raw mode")
-		state, err := term.MakeRaw(int(os.Stdin.Fd()))
-		if err != nil {
-			logging.Warn("failed to set terminal to raw mode: %v", err)
-		} else {
-			defer term.Restore(int(os.Stdin.Fd()), state)
-		}
-	}
+	restoreTerminal := makeRawTerminal(containerConfig.TTY)
+	defer restoreTerminal()
 
 	// Handle signals and forward them to the container
-	sigChan := make(chan os.Signal, 1)
-	setupSignals(sigChan)
+	sigChan := make(chan os.Signal, 4)
+	signal.Notify(sigChan, lookupSignals(resolved.ForwardSignals)...)
 	defer signal.Stop(sigChan)
-	go func() {
-		firstSignal := true
-		for {
-			select {
-			case sig := <-sigChan:
-				if firstSignal {
-					sigName := getSignalName(sig)
-					logging.Debug("Forwarding signal %v to container", sig)
-					if err := rt.SignalContainer(ctxG, containerID, sigName); err != nil {
-						logging.Warn("failed to forward signal %v: %v", sig, err)
-					}
-					firstSignal = false
-				} else {
-					logging.Info("Received second signal, terminating...")
-					cancel()
-					return
-				}
-			case <-ctxG.Done():
-				return
-			}
-		}
-	}()
+	stopTimeout, _ := time.ParseDuration(containerConfig.StopTimeout)
+	forwarder := &signalForwarder{rt: rt, containerID: containerID, tty: containerConfig.TTY, stopTimeout: stopTimeout}
+	go forwarder.run(ctxG, cancel, sigChan)
 
 	logging.Trace("Starting container: %s", containerID)
 	if err := rt.StartContainer(ctx, containerID); err != nil {
 		return 0, fmt.Errorf("failed to start container: %w", err)
 	}
 
+	if len(containerConfig.Ports) > 0 || containerConfig.PublishAll {
+		logPublishedPorts(ctx, rt, containerID)
+	}
+
 	// Handle window resize synchronization
 	if containerConfig.TTY && term.IsTerminal(int(os.Stdout.Fd())) {
-		resizeChan := make(chan os.Signal, 1)
-		setupResizeSignal(resizeChan)
-		defer signal.Stop(resizeChan)
-		go func() {
-			for {
-				select {
-				case <-resizeChan:
-					w, h, err := term.GetSize(int(os.Stdout.Fd()))
-					if err == nil {
-						_ = rt.ResizeContainerTTY(ctxG, containerID, uint(h), uint(w))
-					}
-				case <-ctxG.Done():
-					return
-				}
-			}
-		}()
-
-		// Initial resize to match current terminal size
-		w, h, err := term.GetSize(int(os.Stdout.Fd()))
-		if err == nil {
-			_ = rt.ResizeContainerTTY(ctxG, containerID, uint(h), uint(w))
-		}
+		syncTerminalSize(ctxG, func(rows, cols uint) error {
+			return rt.ResizeContainerTTY(ctxG, containerID, rows, cols)
+		})
 	}
 
 	// Attach to container IO concurrently
@@ -393,31 +654,194 @@ func (o *rootOptions) execute(ctx context.Context, resolved *config.ResolvedConf
 	attachCtx, cancelAttach := context.WithCancel(ctxG)
 	defer cancelAttach()
 
+	attachOpts := runtime.AttachOptions{TTY: containerConfig.TTY, DetachKeys: resolved.DetachKeys, Logs: true}
+	if len(containerConfig.Services) > 0 {
+		// Services only live as long as this process
+		logging.Debug("Detaching is not supported together with services")
+		attachOpts.DetachKeys = ""
+	}
 	attachDone := make(chan error, 1)
 	go func() {
-		attachDone <- rt.AttachContainer(attachCtx, containerID, containerConfig.TTY, stdin, os.Stdout, os.Stderr)
+		err := rt.AttachContainer(attachCtx, containerID, attachOpts, stdin, output.stdout, output.stderr)
+		if errors.Is(err, runtime.ErrDetached) {
+			detached.Store(true)
+			cancel() // Stop waiting, the container keeps running
+		}
+		attachDone <- err
 	}()
 
 	logging.Trace("Waiting for container: %s", containerID)
 	exitCode, err := rt.WaitContainer(ctxG, containerID)
+	if err != nil && detached.Load() {
+		restoreTerminal()
+		detachContainer(context.WithoutCancel(ctx), rt, containerConfig.Command[0], containerID, "")
+		return 0, nil
+	}
 	if err != nil {
+		if code, ok := forwarder.exitCode(); ok && ctxG.Err() != nil && ctx.Err() == nil {
+			// Forced termination: kill the container now instead of leaving it running
+			logging.Debug("Killing container after forced termination: %s", containerID)
+			if err := rt.StopContainer(context.WithoutCancel(ctx), containerID, 0); err != nil {
+				logging.Warn("failed to kill container: %v", err)
+			}
+			return code, nil
+		}
 		return 0, fmt.Errorf("failed to wait for container: %w", err)
 	}
 
-	// After container exits, wait a short grace period for remaining output
+	// After the container exits, copy the remaining output until the stream ends
+	drainTimeout, _ := time.ParseDuration(resolved.DrainTimeout)
+	if err := drainAttach(attachDone, cancelAttach, drainTimeout); err != nil {
+		return 0, err
+	}
+
+	logging.Debug("Container exited with code: %d", exitCode)
+	if exitCode != 0 {
+		reportOOMKilled(context.WithoutCancel(ctx), rt, containerID)
+	}
+	if code, ok := forwarder.exitCode(); ok {
+		// Report the interrupt that stopped the container, like a shell would
+		return code, nil
+	}
+	return exitCode, nil
+}
+
+// drainAttach waits for the attach stream to report EOF after the container has exited,
+// so that output written just before the exit is not lost. If the stream does not end
+// within timeout, it is closed and the rest of the output is dropped. A timeout of 0
+// waits until the stream ends.
+func drainAttach(attachDone <-chan error, cancelAttach context.CancelFunc, timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
 	select {
 	case err := <-attachDone:
-		if err != nil && err != context.Canceled {
-			return 0, fmt.Errorf("failed to attach to container: %w", err)
+		if err != nil && err != context.Canceled && !errors.Is(err, runtime.ErrDetached) {
+			return fmt.Errorf("failed to attach to container: %w", err)
 		}
-	case <-time.After(500 * time.Millisecond):
-		logging.Debug("AttachContainer timed out after container exit, forcing close")
+	case <-expired:
+		logging.Warn("output did not end within %s after the container exited, it may be truncated (see --drain-timeout)", timeout)
 		cancelAttach()
 		<-attachDone
 	}
+	return nil
+}
 
-	logging.Debug("Container exited with code: %d", exitCode)
-	return exitCode, nil
+// reportOOMKilled tells the user when the container was killed for running out of memory.
+func reportOOMKilled(ctx context.Context, rt runtime.ContainerRuntime, containerID string) {
+	info, err := rt.InspectContainer(ctx, containerID)
+	if err != nil {
+		logging.Debug("Failed to inspect exited container: %v", err)
+		return
+	}
+	if info.OOMKilled {
+		fmt.Fprintf(os.Stderr, "cderun: container was killed because it ran out of memory (OOMKilled, exit code %d)\n", info.ExitCode)
+	}
+}
+
+// detachContainer marks a container the user detached from so it is not reaped
+// as an orphan, and tells the user how to reattach.
+func detachContainer(ctx context.Context, rt runtime.ContainerRuntime, tool, containerID, name string) {
+	target := name
+	if !isDetached(name) {
+		target = detachedName(tool, containerID)
+		if err := rt.RenameContainer(ctx, containerID, target); err != nil {
+			logging.Warn("failed to rename detached container: %v", err)
+			target = shortID(containerID)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "cderun: detached from container %s, reattach with: cderun attach %s\n", shortID(containerID), target)
+}
+
+// stdinIsPipe reports whether stdin is a pipe, socket or regular file rather than a
+// terminal or a device like /dev/null.
+func stdinIsPipe() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	mode := fi.Mode()
+	return mode&(os.ModeNamedPipe|os.ModeSocket) != 0 || mode.IsRegular()
+}
+
+// makeRawTerminal puts the terminal into raw mode when a TTY is requested and
+// stdin is a terminal. The returned function restores the previous state.
+func makeRawTerminal(tty bool) func() {
+	if !tty || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return func() {}
+	}
+	logging.Trace("Setting terminal to raw mode")
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		logging.Warn("failed to set terminal to raw mode: %v", err)
+		return func() {}
+	}
+	return func() { term.Restore(int(os.Stdin.Fd()), state) }
+}
+
+// syncTerminalSize applies the local terminal size now and on every window
+// change until ctx is done.
+func syncTerminalSize(ctx context.Context, resize func(rows, cols uint) error) {
+	resizeChan := make(chan os.Signal, 1)
+	setupResizeSignal(resizeChan)
+	go func() {
+		defer signal.Stop(resizeChan)
+		for {
+			select {
+			case <-resizeChan:
+				w, h, err := term.GetSize(int(os.Stdout.Fd()))
+				if err == nil {
+					_ = resize(uint(h), uint(w))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Initial resize to match current terminal size. The target may not accept
+	// a resize right away (e.g. an exec session that is still starting), so retry briefly.
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return
+	}
+	go func() {
+		for i := 0; i < 5; i++ {
+			if resize(uint(h), uint(w)) == nil {
+				return
+			}
+			select {
+			case <-time.After(time.Duration(i+1) * 10 * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// logPublishedPorts reports the host ports the runtime actually bound.
+func logPublishedPorts(ctx context.Context, rt runtime.ContainerRuntime, containerID string) {
+	info, err := rt.InspectContainer(ctx, containerID)
+	if err != nil {
+		logging.Warn("failed to inspect published ports: %v", err)
+		return
+	}
+	for _, p := range info.Ports {
+		logging.Info("Published port: %s", formatPort(p))
+	}
+}
+
+// formatPort renders a port mapping in Docker's [ip:]host:container/proto form.
+func formatPort(p container.PortMapping) string {
+	host := p.HostPort
+	if p.HostIP != "" {
+		host = net.JoinHostPort(p.HostIP, p.HostPort)
+	}
+	return fmt.Sprintf("%s:%s/%s", host, p.ContainerPort, p.Protocol)
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -428,74 +852,75 @@ var rootCmd = &cobra.Command{
 within a container. It separates its own flags from the flags
 intended for the subcommand.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 0 {
-			return cmd.Help()
-		}
+		return toExitError(runTool(cmd, args))
+	},
+}
 
-		// The first non-flag argument is the subcommand
-		subcommand := args[0]
-		passthroughArgs := args[1:]
+// runTool runs the tool named by the first argument in a container.
+func runTool(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return cmd.Help()
+	}
 
-		// Early logger initialization with CLI and Environment settings before config loading.
-		// This allows loadConfigs() to use the correct log level.
-		initialLevel := "info"
-		vLevel := opts.verbose
-		if opts.cderunVerbose > vLevel {
-			vLevel = opts.cderunVerbose
-		}
-		if vLevel >= 3 {
-			initialLevel = "trace"
-		} else if vLevel >= 2 {
-			initialLevel = "debug"
-		}
-		if env := os.Getenv("CDERUN_LOG_LEVEL"); env != "" {
-			initialLevel = env
-		}
-		if opts.cderunLogLevel != "" {
-			initialLevel = opts.cderunLogLevel
-		} else if opts.logLevel != "" {
-			initialLevel = opts.logLevel
-		}
-		_ = logging.Init(initialLevel, "text", "", false, true)
+	// The first non-flag argument is the subcommand
+	subcommand := args[0]
+	passthroughArgs := args[1:]
 
-		// Load configurations
-		toolsCfg, globalCfg := opts.loadConfigs()
+	// Early logger initialization with CLI and Environment settings before config loading.
+	// This allows loadConfigs() to use the correct log level.
+	opts.initEarlyLogging()
 
-		// Resolve settings using priority logic (CLI > Env > Config > Default)
-		resolved, err := opts.resolveSettings(cmd, subcommand, toolsCfg, globalCfg)
-		if err != nil {
-			return fmt.Errorf("configuration error: %w", err)
-		}
+	// Load configurations
+	toolsCfg, globalCfg := opts.loadConfigs()
 
-		// Re-initialize logger with fully resolved settings including those from config files.
-		if err := logging.Init(resolved.LogLevel, resolved.LogFormat, resolved.LogFile, resolved.LogTee, resolved.LogTimestamp); err != nil {
-			return fmt.Errorf("failed to initialize logger: %w", err)
-		}
-		logging.Debug("Logger initialized with level: %s", resolved.LogLevel)
+	return runContainer(cmd, subcommand, passthroughArgs, toolsCfg, globalCfg)
+}
 
-		// Build ContainerConfig
-		containerConfig, err := opts.buildContainerConfig(resolved, subcommand, passthroughArgs, toolsCfg)
-		if err != nil {
-			return fmt.Errorf("container configuration error: %w", err)
-		}
+// runContainer resolves the settings of a tool from the loaded configurations
+// and runs it.
+func runContainer(cmd *cobra.Command, subcommand string, passthroughArgs []string, toolsCfg config.ToolsConfig, globalCfg *config.CDERunConfig) error {
+	// Resolve settings using priority logic (CLI > Env > Config > Default)
+	resolved, err := opts.resolveSettings(cmd, subcommand, toolsCfg, globalCfg)
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
 
-		if resolved.DryRun {
-			return opts.handleDryRun(containerConfig, resolved.DryRunFormat)
-		}
+	// Re-initialize logger with fully resolved settings including those from config files.
+	if err := logging.Init(resolved.LogLevel, resolved.LogFormat, resolved.LogFile, resolved.LogTee, resolved.LogTimestamp); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	logging.Debug("Logger initialized with level: %s", resolved.LogLevel)
 
-		// Execute Container
-		exitCode, err := opts.execute(cmd.Context(), resolved, containerConfig)
-		if err != nil {
-			return err
-		}
-		exitFunc(exitCode)
-		return nil
-	},
+	// Build ContainerConfig
+	containerConfig, err := opts.buildContainerConfig(resolved, subcommand, passthroughArgs, toolsCfg)
+	if err != nil {
+		return fmt.Errorf("container configuration error: %w", err)
+	}
+
+	if resolved.DryRun {
+		return opts.handleDryRun(containerConfig, resolved)
+	}
+
+	// Execute Container
+	exitCode, err := opts.execute(cmd.Context(), resolved, containerConfig)
+	if err != nil {
+		return err
+	}
+	exitFunc(exitCode)
+	return nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(rawArgs []string) error {
+	// Completion requests must not be rewritten by preprocessArgs, the word being
+	// completed is not a complete argument. completionArgs keeps the boundary instead.
+	if isCompletionRequest(rawArgs) {
+		defer hideOverrideFlags()()
+		rootCmd.SetArgs(completionArgs(rawArgs)[1:])
+		return rootCmd.Execute()
+	}
+
 	args, err := preprocessArgs(rawArgs)
 	if err != nil {
 		return err
@@ -538,7 +963,18 @@ func preprocessArgs(args []string) ([]string, error) {
 		}
 	}
 
-	newArgs := make([]string, 0, len(args)+1)
+	// Management commands (ps, stop, ...) are only recognized as the first argument of
+	// cderun itself, or after the flags they use (managementFlags). Anywhere else a
+	// tool with the same name is meant, so "--" is inserted to keep cobra from
+	// dispatching to the management command.
+	escapeIdx := -1
+	if !isPolyglot {
+		if idx := commandIndex(args); idx > 1 && isManagementCommand(args[idx]) && !onlyManagementFlags(args[1:idx]) {
+			escapeIdx = idx
+		}
+	}
+
+	newArgs := make([]string, 0, len(args)+2)
 	if isPolyglot {
 		newArgs = append(newArgs, "cderun")
 	} else {
@@ -555,6 +991,9 @@ func preprocessArgs(args []string) ([]string, error) {
 	if !isPolyglot && subcmdIdx != -1 {
 		// Standard mode: hoist only from after the subcommand
 		for i := 1; i <= subcmdIdx; i++ {
+			if i == escapeIdx {
+				others = append(others, "--")
+			}
 			others = append(others, args[i])
 		}
 		startIdx = subcmdIdx + 1
@@ -564,6 +1003,9 @@ func preprocessArgs(args []string) ([]string, error) {
 		if strings.HasPrefix(args[i], "--cderun-") {
 			overrides = append(overrides, args[i])
 		} else {
+			if i == escapeIdx {
+				others = append(others, "--")
+			}
 			others = append(others, args[i])
 		}
 	}
@@ -573,6 +1015,9 @@ func preprocessArgs(args []string) ([]string, error) {
 
 	if isPolyglot {
 		// In polyglot mode, the original executable name becomes the subcommand
+		if isManagementCommand(execName) {
+			newArgs = append(newArgs, "--")
+		}
 		newArgs = append(newArgs, execName)
 	}
 
@@ -581,9 +1026,75 @@ func preprocessArgs(args []string) ([]string, error) {
 	return newArgs, nil
 }
 
+// commandIndex mirrors cobra's subcommand lookup: it returns the index of the
+// first argument that cobra treats as a command name, skipping flags and their values.
+func commandIndex(args []string) int {
+	flags := rootCmd.PersistentFlags()
+	for i := 1; i < len(args); i++ {
+		s := args[i]
+		switch {
+		case s == "--":
+			return -1
+		case strings.HasPrefix(s, "--") && !strings.Contains(s, "="):
+			if f := flags.Lookup(s[2:]); f == nil || f.NoOptDefVal == "" {
+				i++ // Skip the flag value
+			}
+		case strings.HasPrefix(s, "-") && !strings.Contains(s, "=") && len(s) == 2:
+			if f := flags.ShorthandLookup(s[1:]); f == nil || f.NoOptDefVal == "" {
+				i++
+			}
+		case s != "" && !strings.HasPrefix(s, "-"):
+			return i
+		}
+	}
+	return -1
+}
+
+// managementFlags are the flags of cderun that management commands use. Only
+// these may come before a management command, e.g. "cderun --runtime podman ps".
+var managementFlags = map[string]bool{
+	"runtime":       true,
+	"mount-socket":  true,
+	"verbose":       true,
+	"log-level":     true,
+	"log-file":      true,
+	"log-format":    true,
+	"log-tee":       true,
+	"log-timestamp": true,
+}
+
+// onlyManagementFlags reports whether args, the arguments of cderun before the
+// command, consist of managementFlags and their values only.
+func onlyManagementFlags(args []string) bool {
+	flags := rootCmd.PersistentFlags()
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+		if !strings.HasPrefix(args[i], "--") || !managementFlags[name] {
+			return false
+		}
+		if !hasValue && flags.Lookup(name).NoOptDefVal == "" {
+			i++ // Skip the flag value
+		}
+	}
+	return true
+}
+
+// isManagementCommand reports whether name is one of cderun's own subcommands.
+func isManagementCommand(name string) bool {
+	if name == "help" {
+		return true
+	}
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
-	rootCmd.PersistentFlags().BoolVar(&opts.tty, "tty", false, "Allocate a pseudo-TTY")
-	rootCmd.PersistentFlags().BoolVarP(&opts.interactive, "interactive", "i", false, "Keep STDIN open even if not attached")
+	rootCmd.PersistentFlags().Var(newBoolOrAutoValue(config.BoolFalse, &opts.tty), "tty", "Allocate a pseudo-TTY (true, false, auto: only if stdin and stdout are terminals)")
+	rootCmd.PersistentFlags().VarP(newBoolOrAutoValue(config.BoolFalse, &opts.interactive), "interactive", "i", "Keep STDIN open even if not attached (true, false, auto: if stdin is a terminal or pipe)")
 	rootCmd.PersistentFlags().StringVar(&opts.network, "network", "bridge", "Connect a container to a network")
 	rootCmd.PersistentFlags().StringVar(&opts.mountSocket, "mount-socket", "", "Mount container runtime socket (e.g., /var/run/docker.sock)")
 	rootCmd.PersistentFlags().BoolVar(&opts.mountCderun, "mount-cderun", false, "Mount cderun binary for use inside container")
@@ -595,8 +1106,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&opts.mountTools, "mount-tools", "", "Mount specified tools into the container")
 	rootCmd.PersistentFlags().BoolVar(&opts.mountAllTools, "mount-all-tools", false, "Mount all defined tools into the container")
 	rootCmd.PersistentFlags().BoolVar(&opts.remove, "remove", true, "Automatically remove the container when it exits")
-	rootCmd.PersistentFlags().BoolVar(&opts.cderunTTY, "cderun-tty", false, "Override TTY setting (highest priority, can be used after subcommand)")
-	rootCmd.PersistentFlags().BoolVar(&opts.cderunInteractive, "cderun-interactive", false, "Override interactive setting (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().Var(newBoolOrAutoValue(config.BoolFalse, &opts.cderunTTY), "cderun-tty", "Override TTY setting (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().Var(newBoolOrAutoValue(config.BoolFalse, &opts.cderunInteractive), "cderun-interactive", "Override interactive setting (highest priority, can be used after subcommand)")
 	rootCmd.PersistentFlags().StringVar(&opts.cderunImage, "cderun-image", "", "Override image (highest priority, can be used after subcommand)")
 	rootCmd.PersistentFlags().StringVar(&opts.cderunNetwork, "cderun-network", "", "Override network setting (highest priority, can be used after subcommand)")
 	rootCmd.PersistentFlags().BoolVar(&opts.cderunRemove, "cderun-remove", true, "Override remove setting (highest priority, can be used after subcommand)")
@@ -626,5 +1137,54 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&opts.cderunLogTee, "cderun-log-tee", false, "Override log-tee setting (highest priority, can be used after subcommand)")
 	rootCmd.PersistentFlags().CountVar(&opts.cderunVerbose, "cderun-verbose", "Override verbose level (highest priority, can be used after subcommand)")
 
+	rootCmd.PersistentFlags().BoolVar(&opts.forwardSSHAgent, "forward-ssh-agent", false, "Forward the host SSH agent ($SSH_AUTH_SOCK) into the container")
+	rootCmd.PersistentFlags().BoolVar(&opts.forwardGitConfig, "forward-git-config", false, "Mount ~/.gitconfig and ~/.ssh/known_hosts read-only into the container")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunForwardSSHAgent, "cderun-forward-ssh-agent", false, "Override forward-ssh-agent setting (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunForwardGitConfig, "cderun-forward-git-config", false, "Override forward-git-config setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().StringSliceVarP(&opts.publish, "publish", "p", nil, "Publish a container's port(s) to the host ([ip:]hostPort:containerPort[/proto])")
+	rootCmd.PersistentFlags().BoolVarP(&opts.publishAll, "publish-all", "P", false, "Publish all exposed ports to random host ports")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.cderunPublish, "cderun-publish", nil, "Override published ports (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunPublishAll, "cderun-publish-all", false, "Override publish-all setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().StringSliceVar(&opts.networkAliases, "network-alias", nil, "Add network-scoped alias for the container")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.addHosts, "add-host", nil, "Add a custom host-to-IP mapping (host:ip, ip may be host-gateway)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.cderunNetworkAliases, "cderun-network-alias", nil, "Override network aliases (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.cderunAddHosts, "cderun-add-host", nil, "Override extra hosts (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().BoolVar(&opts.servicesLogs, "services-logs", false, "Stream logs of sidecar services to stderr")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunServicesLogs, "cderun-services-logs", false, "Override services-logs setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().BoolVar(&opts.keepAlive, "keep-alive", false, "Run the command in a reusable long-lived container")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunKeepAlive, "cderun-keep-alive", false, "Override keep-alive setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().BoolVar(&opts.autoStdin, "auto-stdin", true, "Attach stdin automatically when it is a pipe or a file (use --auto-stdin=false to disable)")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunAutoStdin, "cderun-auto-stdin", false, "Override auto-stdin setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().StringVar(&opts.detachKeys, "detach-keys", "", "Key sequence for detaching from a TTY session (default ctrl-p,ctrl-q)")
+	rootCmd.PersistentFlags().StringVar(&opts.cderunDetachKeys, "cderun-detach-keys", "", "Override detach-keys setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().StringVar(&opts.drainTimeout, "drain-timeout", "", "Maximum time to wait for remaining output after the container exits, 0 waits until the output ends (default 5s)")
+	rootCmd.PersistentFlags().StringVar(&opts.cderunDrainTimeout, "cderun-drain-timeout", "", "Override drain-timeout setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().BoolVar(&opts.splitStreams, "split-streams", false, "Only allocate a TTY when stdout and stderr are terminals, so redirected output keeps stdout and stderr apart")
+	rootCmd.PersistentFlags().BoolVar(&opts.cderunSplitStreams, "cderun-split-streams", false, "Override split-streams setting (highest priority, can be used after subcommand)")
+
+	rootCmd.PersistentFlags().StringVar(&opts.outputLog, "output-log", "", "Also write a timestamped transcript of stdout and stderr to a file")
+	rootCmd.PersistentFlags().StringVar(&opts.cderunOutputLog, "cderun-output-log", "", "Override output-log setting (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().StringVar(&opts.outputLogFormat, "output-log-format", "text", "Format of the output log (text, jsonl)")
+	rootCmd.PersistentFlags().StringVar(&opts.cderunOutputLogFormat, "cderun-output-log-format", "", "Override output-log-format setting (highest priority, can be used after subcommand)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.capture, "capture", nil, "Also write a stream to a file (STREAM=FILE, e.g. stdout=out.log or stderr=err.log)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.cderunCapture, "cderun-capture", nil, "Override capture setting (highest priority, can be used after subcommand)")
+
+	// Like bool flags, --tty and --interactive mean true without a value
+	for _, name := range []string{"tty", "interactive", "cderun-tty", "cderun-interactive"} {
+		rootCmd.PersistentFlags().Lookup(name).NoOptDefVal = string(config.BoolTrue)
+	}
+
 	rootCmd.Flags().SetInterspersed(false)
+	// Anything that is not a management command is a tool name
+	rootCmd.Args = cobra.ArbitraryArgs
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	registerFlagCompletions()
 }
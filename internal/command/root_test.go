@@ -2,12 +2,19 @@ package command
 
 import (
 	"bytes"
+	"cderun/internal/config"
+	"cderun/internal/container"
 	"cderun/internal/runtime"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -20,15 +27,15 @@ func executeCommand(args ...string) (string, error) {
 
 func executeCommandRaw(args []string) (string, error) {
 	// Reset flag variables and Changed state
-	opts.tty = false
-	opts.interactive = false
+	opts.tty = config.BoolFalse
+	opts.interactive = config.BoolFalse
 	opts.network = "bridge"
 	opts.mountSocket = ""
 	opts.mountCderun = false
 	opts.image = ""
 	opts.remove = true
-	opts.cderunTTY = false
-	opts.cderunInteractive = false
+	opts.cderunTTY = config.BoolFalse
+	opts.cderunInteractive = config.BoolFalse
 	opts.cderunImage = ""
 	opts.cderunNetwork = ""
 	opts.cderunRemove = true
@@ -61,6 +68,42 @@ func executeCommandRaw(args []string) (string, error) {
 	opts.cderunLogFormat = ""
 	opts.cderunLogTee = false
 	opts.cderunVerbose = 0
+	opts.forwardSSHAgent = false
+	opts.forwardGitConfig = false
+	opts.cderunForwardSSHAgent = false
+	opts.cderunForwardGitConfig = false
+	opts.publish = nil
+	opts.cderunPublish = nil
+	opts.publishAll = false
+	opts.cderunPublishAll = false
+	opts.networkAliases = nil
+	opts.cderunNetworkAliases = nil
+	opts.addHosts = nil
+	opts.cderunAddHosts = nil
+	opts.servicesLogs = false
+	opts.cderunServicesLogs = false
+	opts.keepAlive = false
+	opts.cderunKeepAlive = false
+	opts.autoStdin = true
+	opts.cderunAutoStdin = false
+	opts.detachKeys = ""
+	opts.cderunDetachKeys = ""
+	opts.drainTimeout = ""
+	opts.cderunDrainTimeout = ""
+	opts.splitStreams = false
+	opts.cderunSplitStreams = false
+	opts.outputLog = ""
+	opts.cderunOutputLog = ""
+	opts.outputLogFormat = "text"
+	opts.cderunOutputLogFormat = ""
+	opts.capture = nil
+	opts.cderunCapture = nil
+	*psOpts = psOptions{}
+	*stopOpts = stopOptions{timeout: 10 * time.Second}
+	*devcontainerOpts = devcontainerOptions{}
+	*configImportOpts = configImportOptions{output: ".tools.yaml"}
+	*installOpts = installOptions{dir: "~/.local/bin"}
+	*shellHookOpts = shellHookOptions{}
 
 	rootCmd.Flags().VisitAll(func(f *pflag.Flag) {
 		f.Changed = false
@@ -69,6 +112,11 @@ func executeCommandRaw(args []string) (string, error) {
 	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
 		f.Changed = false
 	})
+	for _, c := range rootCmd.Commands() {
+		c.Flags().VisitAll(func(f *pflag.Flag) {
+			f.Changed = false
+		})
+	}
 
 	oldStdout := os.Stdout
 	oldStderr := os.Stderr
@@ -139,6 +187,41 @@ func TestPreprocessArgs(t *testing.T) {
 			args:     []string{},
 			expected: []string{},
 		},
+		{
+			name:     "management command",
+			args:     []string{"cderun", "ps", "-a"},
+			expected: []string{"cderun", "ps", "-a"},
+		},
+		{
+			name:     "tool named like a management command after flags",
+			args:     []string{"cderun", "--image", "alpine", "ps", "aux"},
+			expected: []string{"cderun", "--image", "alpine", "--", "ps", "aux"},
+		},
+		{
+			name:     "tool named like a management command after a boolean flag",
+			args:     []string{"cderun", "--tty", "stop", "now"},
+			expected: []string{"cderun", "--tty", "--", "stop", "now"},
+		},
+		{
+			name:     "management command after the flags it uses",
+			args:     []string{"cderun", "--runtime", "podman", "--verbose", "--log-level=debug", "ps", "-a"},
+			expected: []string{"cderun", "--runtime", "podman", "--verbose", "--log-level=debug", "ps", "-a"},
+		},
+		{
+			name:     "tool named like a management command after flags it does not use",
+			args:     []string{"cderun", "--runtime", "podman", "--image", "alpine", "ps", "aux"},
+			expected: []string{"cderun", "--runtime", "podman", "--image", "alpine", "--", "ps", "aux"},
+		},
+		{
+			name:     "explicit separator",
+			args:     []string{"cderun", "--", "ps"},
+			expected: []string{"cderun", "--", "ps"},
+		},
+		{
+			name:     "symlink named like a management command",
+			args:     []string{"/usr/local/bin/ps", "aux"},
+			expected: []string{"cderun", "--", "ps", "aux"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1021,3 +1104,787 @@ func TestRemoveContainerWarning(t *testing.T) {
 		assert.NotContains(t, output, "[WARN] failed to remove container (defer)")
 	})
 }
+
+func TestSecrets(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldWd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Chdir(oldWd)
+	})
+
+	tmpDir := t.TempDir()
+	require.NoError(t, os.Chdir(tmpDir))
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("CDERUN_TEST_TOKEN", "super-secret-value")
+
+	toolsContent := `
+node:
+  image: node:20
+  secrets:
+    - name: token
+      env: CDERUN_TEST_TOKEN
+`
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte(toolsContent), 0644))
+
+	t.Run("dry-run shows secret references but never values", func(t *testing.T) {
+		mockRuntime := &runtime.MockRuntime{}
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return mockRuntime, nil
+		}
+		exitFunc = func(code int) {}
+
+		for _, format := range []string{"yaml", "json", "simple"} {
+			output, err := executeCommand("--dry-run", "-f", format, "--verbose", "--verbose", "--verbose", "node")
+			require.NoError(t, err)
+			assert.Contains(t, output, "token")
+			assert.Contains(t, output, "/run/secrets/token")
+			assert.NotContains(t, output, "super-secret-value")
+		}
+		assert.Nil(t, mockRuntime.CreatedConfig)
+	})
+
+	t.Run("secret is mounted read-only and cleaned up after run", func(t *testing.T) {
+		var hostPath string
+		mockRuntime := &runtime.MockRuntime{CreatedContainerID: "secret-container"}
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return &secretCheckingRuntime{MockRuntime: mockRuntime, onCreate: func(path string) {
+				hostPath = path
+			}}, nil
+		}
+		exitFunc = func(code int) {}
+
+		output, err := executeCommand("--verbose", "--verbose", "--verbose", "node")
+		require.NoError(t, err)
+		assert.NotContains(t, output, "super-secret-value")
+
+		require.NotNil(t, mockRuntime.CreatedConfig)
+		var mount *container.VolumeMount
+		for i, v := range mockRuntime.CreatedConfig.Volumes {
+			if v.ContainerPath == "/run/secrets/token" {
+				mount = &mockRuntime.CreatedConfig.Volumes[i]
+			}
+		}
+		require.NotNil(t, mount, "secret should be bind-mounted")
+		assert.True(t, mount.ReadOnly)
+		assert.Equal(t, mount.HostPath, hostPath)
+
+		_, err = os.Stat(hostPath)
+		assert.True(t, os.IsNotExist(err), "secret file should be removed after the run")
+	})
+}
+
+// secretCheckingRuntime verifies the secret file content while the container exists.
+type secretCheckingRuntime struct {
+	*runtime.MockRuntime
+	onCreate func(path string)
+}
+
+func (m *secretCheckingRuntime) CreateContainer(ctx context.Context, config *container.ContainerConfig) (string, error) {
+	for _, v := range config.Volumes {
+		if v.ContainerPath == "/run/secrets/token" {
+			data, err := os.ReadFile(v.HostPath)
+			if err != nil || string(data) != "super-secret-value" {
+				return "", fmt.Errorf("unexpected secret content %q: %v", data, err)
+			}
+			m.onCreate(v.HostPath)
+		}
+	}
+	return m.MockRuntime.CreateContainer(ctx, config)
+}
+
+func TestCredentialForwarding(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+	})
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return &runtime.MockRuntime{}, nil
+	}
+	exitFunc = func(code int) {}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[user]\n"), 0644))
+
+	t.Run("forward-ssh-agent mounts the agent socket and sets SSH_AUTH_SOCK", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+		output, err := executeCommand("--dry-run", "-f", "json", "--image", "alpine", "--forward-ssh-agent", "git", "push")
+		require.NoError(t, err)
+		assert.Contains(t, output, `"host_path": "/tmp/agent.sock"`)
+		assert.Contains(t, output, `"container_path": "/run/ssh-agent.sock"`)
+		assert.Contains(t, output, `"SSH_AUTH_SOCK=/run/ssh-agent.sock"`)
+	})
+
+	t.Run("detects the Docker Desktop socket", func(t *testing.T) {
+		dir := t.TempDir()
+		desktop := filepath.Join(dir, ".docker", "run", "docker.sock")
+		require.NoError(t, os.MkdirAll(filepath.Dir(desktop), 0755))
+		require.NoError(t, os.WriteFile(desktop, nil, 0600))
+		link := filepath.Join(dir, "docker.sock")
+		require.NoError(t, os.Symlink(desktop, link))
+
+		assert.True(t, isDockerDesktop("docker", desktop))
+		assert.True(t, isDockerDesktop("docker", link))
+		assert.False(t, isDockerDesktop("podman", desktop))
+		assert.False(t, isDockerDesktop("docker", filepath.Join(dir, ".colima", "default", "docker.sock")))
+		assert.False(t, isDockerDesktop("docker", ""))
+	})
+
+	t.Run("warns when SSH_AUTH_SOCK is not set", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+
+		output, err := executeCommand("--dry-run", "--image", "alpine", "--forward-ssh-agent", "git", "push")
+		require.NoError(t, err)
+		assert.Contains(t, output, "[WARN] SSH agent forwarding requested but SSH_AUTH_SOCK is not set")
+		assert.NotContains(t, output, "/run/ssh-agent.sock")
+	})
+
+	t.Run("forward-git-config mounts existing files read-only", func(t *testing.T) {
+		output, err := executeCommand("--dry-run", "-f", "simple", "--image", "alpine", "git", "--cderun-forward-git-config", "status")
+		require.NoError(t, err)
+		assert.Contains(t, output, filepath.Join(home, ".gitconfig")+":/etc/gitconfig")
+		assert.NotContains(t, output, "/etc/ssh/ssh_known_hosts", "missing known_hosts should be skipped")
+	})
+
+	t.Run("forwarding can be enabled from tools.yaml", func(t *testing.T) {
+		oldWd, _ := os.Getwd()
+		require.NoError(t, os.Chdir(t.TempDir()))
+		t.Cleanup(func() { os.Chdir(oldWd) })
+		t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+		toolsContent := `
+git:
+  image: alpine/git
+  forwardSSHAgent: true
+`
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte(toolsContent), 0644))
+
+		output, err := executeCommand("--dry-run", "-f", "simple", "git", "pull")
+		require.NoError(t, err)
+		assert.Contains(t, output, "/tmp/agent.sock:/run/ssh-agent.sock")
+	})
+}
+
+func TestPortPublishing(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+	})
+
+	mockRuntime := &runtime.MockRuntime{
+		CreatedContainerID: "web",
+		InspectInfo: &runtime.ContainerInfo{
+			ID: "web",
+			Ports: []container.PortMapping{
+				{HostIP: "0.0.0.0", HostPort: "8000", ContainerPort: "8000", Protocol: "tcp"},
+				{HostIP: "0.0.0.0", HostPort: "49153", ContainerPort: "9000", Protocol: "tcp"},
+			},
+		},
+	}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mockRuntime, nil
+	}
+	exitFunc = func(code int) {}
+
+	t.Run("publish flags are passed to the runtime and bound ports are logged", func(t *testing.T) {
+		output, err := executeCommand("-p", "8000:8000", "--image", "python:3", "python", "-m", "http.server", "--cderun-publish=9000")
+		require.NoError(t, err)
+
+		require.NotNil(t, mockRuntime.CreatedConfig)
+		assert.Equal(t, []container.PortMapping{
+			{HostPort: "8000", ContainerPort: "8000", Protocol: "tcp"},
+			{ContainerPort: "9000", Protocol: "tcp"},
+		}, mockRuntime.CreatedConfig.Ports)
+		assert.Equal(t, []string{"-m", "http.server"}, mockRuntime.CreatedConfig.Args)
+		assert.Equal(t, "web", mockRuntime.InspectedContainerID)
+		assert.Contains(t, output, "[INFO] Published port: 0.0.0.0:8000:8000/tcp")
+		assert.Contains(t, output, "[INFO] Published port: 0.0.0.0:49153:9000/tcp")
+	})
+
+	t.Run("publish-all is passed to the runtime", func(t *testing.T) {
+		mockRuntime.InspectedContainerID = ""
+		_, err := executeCommand("-P", "--image", "nginx", "nginx")
+		require.NoError(t, err)
+		assert.True(t, mockRuntime.CreatedConfig.PublishAll)
+		assert.Equal(t, "web", mockRuntime.InspectedContainerID)
+	})
+
+	t.Run("ports are not inspected when nothing is published", func(t *testing.T) {
+		mockRuntime.InspectedContainerID = ""
+		_, err := executeCommand("--image", "alpine", "ls")
+		require.NoError(t, err)
+		assert.Empty(t, mockRuntime.InspectedContainerID)
+	})
+
+	t.Run("invalid port spec is a configuration error", func(t *testing.T) {
+		_, err := executeCommand("-p", "abc", "--image", "alpine", "ls")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid port spec")
+	})
+}
+
+func TestNetworkLifecycle(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldWd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		os.Chdir(oldWd)
+	})
+	exitFunc = func(code int) {}
+
+	require.NoError(t, os.Chdir(t.TempDir()))
+	toolsContent := `
+pytest:
+  image: python:3
+  network:
+    name: proj-net
+    create: true
+    remove: true
+    aliases: [tests]
+  extraHosts:
+    - host.docker.internal:host-gateway
+`
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte(toolsContent), 0644))
+
+	t.Run("creates a missing network and removes it afterwards", func(t *testing.T) {
+		mockRuntime := &runtime.MockRuntime{CreatedContainerID: "c1"}
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return mockRuntime, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.NoError(t, err)
+
+		require.Len(t, mockRuntime.CreatedNetworks, 1)
+		assert.Equal(t, "proj-net", mockRuntime.CreatedNetworks[0].Name)
+		assert.Equal(t, "true", mockRuntime.CreatedNetworks[0].Labels["cderun.managed"])
+		assert.Equal(t, "proj-net", mockRuntime.CreatedConfig.Network)
+		assert.Equal(t, []string{"tests"}, mockRuntime.CreatedConfig.NetworkAliases)
+		assert.Equal(t, []string{"host.docker.internal:host-gateway"}, mockRuntime.CreatedConfig.ExtraHosts)
+		assert.Equal(t, []string{"proj-net"}, mockRuntime.RemovedNetworks)
+	})
+
+	t.Run("reuses an existing network", func(t *testing.T) {
+		mockRuntime := &runtime.MockRuntime{
+			CreatedContainerID: "c1",
+			Networks:           map[string]bool{"proj-net": true},
+		}
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return mockRuntime, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.NoError(t, err)
+		assert.Empty(t, mockRuntime.CreatedNetworks)
+	})
+
+	t.Run("keeps a network that is still in use", func(t *testing.T) {
+		mockRuntime := &runtime.MockRuntime{
+			CreatedContainerID: "c1",
+			RemoveNetworkErr:   runtime.ErrNetworkInUse,
+		}
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return mockRuntime, nil
+		}
+
+		output, err := executeCommand("pytest")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"proj-net"}, mockRuntime.RemovedNetworks)
+		assert.NotContains(t, output, "[WARN] failed to remove network")
+	})
+
+	t.Run("network creation failure aborts the run", func(t *testing.T) {
+		mockRuntime := &runtime.MockRuntime{
+			CreatedContainerID: "c1",
+			NetworkErr:         errors.New("daemon down"),
+		}
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return mockRuntime, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "daemon down")
+		assert.Nil(t, mockRuntime.CreatedConfig)
+	})
+}
+
+// serviceRuntime hands out distinct container IDs and reports services as healthy
+// after a configurable number of health probes.
+type serviceRuntime struct {
+	*runtime.MockRuntime
+	probes       map[string]int
+	healthyAfter int
+	health       string
+}
+
+func (s *serviceRuntime) CreateContainer(ctx context.Context, config *container.ContainerConfig) (string, error) {
+	_, _ = s.MockRuntime.CreateContainer(ctx, config)
+	if len(config.NetworkAliases) == 1 && strings.HasPrefix(config.Network, "cderun-svc-") {
+		return "svc-" + config.NetworkAliases[0], s.CreateErr
+	}
+	return "main", s.CreateErr
+}
+
+func (s *serviceRuntime) InspectContainer(ctx context.Context, containerID string) (*runtime.ContainerInfo, error) {
+	s.probes[containerID]++
+	info := &runtime.ContainerInfo{ID: containerID, Running: true, Status: "running", Health: "starting"}
+	if s.probes[containerID] > s.healthyAfter {
+		info.Health = s.health
+	}
+	return info, nil
+}
+
+func TestSidecarServices(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldInterval := servicePollInterval
+	oldTimeout := serviceStartTimeout
+	oldWd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		servicePollInterval = oldInterval
+		serviceStartTimeout = oldTimeout
+		os.Chdir(oldWd)
+	})
+	exitFunc = func(code int) {}
+	servicePollInterval = time.Millisecond
+
+	require.NoError(t, os.Chdir(t.TempDir()))
+	toolsContent := `
+pytest:
+  image: python:3
+  services:
+    redis:
+      image: redis:7
+    db:
+      image: postgres:16
+      env:
+        - POSTGRES_PASSWORD=test
+      healthcheck:
+        test: pg_isready -U postgres
+        interval: 1s
+`
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte(toolsContent), 0644))
+
+	newRuntime := func(health string) *serviceRuntime {
+		return &serviceRuntime{
+			MockRuntime:  &runtime.MockRuntime{},
+			probes:       map[string]int{},
+			healthyAfter: 2,
+			health:       health,
+		}
+	}
+
+	t.Run("starts services before the tool and tears them down", func(t *testing.T) {
+		rt := newRuntime("healthy")
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return rt, nil
+		}
+
+		_, err := executeCommand("--services-logs", "pytest")
+		require.NoError(t, err)
+
+		require.Len(t, rt.CreatedNetworks, 1)
+		network := rt.CreatedNetworks[0].Name
+		assert.True(t, strings.HasPrefix(network, "cderun-svc-"))
+
+		require.Len(t, rt.CreatedConfigs, 3)
+		db, redis, main := rt.CreatedConfigs[0], rt.CreatedConfigs[1], rt.CreatedConfigs[2]
+		assert.Equal(t, "postgres:16", db.Image)
+		assert.Equal(t, []string{"db"}, db.NetworkAliases)
+		assert.Equal(t, []string{"POSTGRES_PASSWORD=test"}, db.Env)
+		require.NotNil(t, db.Healthcheck)
+		assert.Equal(t, []string{"CMD-SHELL", "pg_isready -U postgres"}, db.Healthcheck.Test)
+		assert.Equal(t, "redis:7", redis.Image)
+		assert.Equal(t, network, main.Network)
+		assert.Equal(t, "pytest", main.Labels["cderun.tool"])
+		assert.Equal(t, "db", db.Labels["cderun.service"])
+		assert.Equal(t, main.Labels["cderun.pid"], db.Labels["cderun.pid"])
+		assert.Empty(t, main.Labels["cderun.service"])
+
+		// Waited for the healthcheck, then main container removed before services
+		assert.Equal(t, 3, rt.probes["svc-db"])
+		assert.Equal(t, []string{"main", "svc-redis", "svc-db"}, rt.RemovedContainerIDs)
+		assert.Equal(t, []string{network}, rt.RemovedNetworks)
+		assert.ElementsMatch(t, []string{"svc-db", "svc-redis"}, rt.LogsContainerIDs)
+	})
+
+	t.Run("unhealthy service aborts the run", func(t *testing.T) {
+		rt := newRuntime("unhealthy")
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return rt, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `service "db" is unhealthy`)
+		assert.Len(t, rt.CreatedConfigs, 2, "main container must not be created")
+		assert.Equal(t, []string{"svc-redis", "svc-db"}, rt.RemovedContainerIDs)
+		assert.Len(t, rt.RemovedNetworks, 1)
+		assert.Equal(t, []string{"svc-db"}, rt.LogsContainerIDs, "logs of the failed service are shown")
+	})
+
+	t.Run("times out waiting for a service", func(t *testing.T) {
+		serviceStartTimeout = 20 * time.Millisecond
+		t.Cleanup(func() { serviceStartTimeout = oldTimeout })
+		rt := newRuntime("healthy")
+		rt.healthyAfter = 1 << 30
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return rt, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "timed out")
+		assert.Len(t, rt.RemovedNetworks, 1)
+	})
+
+	t.Run("dry run lists services", func(t *testing.T) {
+		output, err := executeCommand("--dry-run", "--dry-run-format", "simple", "pytest")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Services: db(postgres:16), redis(redis:7)")
+	})
+
+	t.Run("tool network stays the primary network", func(t *testing.T) {
+		toolsContent := `
+pytest:
+  image: python:3
+  network:
+    name: proj-net
+    create: true
+  services:
+    redis:
+      image: redis:7
+`
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte(toolsContent), 0644))
+		rt := newRuntime("healthy")
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return rt, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.NoError(t, err)
+		require.Len(t, rt.CreatedNetworks, 2)
+		assert.Equal(t, "proj-net", rt.CreatedNetworks[0].Name)
+		svcNetwork := rt.CreatedNetworks[1].Name
+		assert.True(t, strings.HasPrefix(svcNetwork, "cderun-svc-"))
+		assert.Equal(t, svcNetwork, rt.CreatedConfigs[0].Network)
+		assert.Equal(t, "proj-net", rt.CreatedConfigs[1].Network)
+		assert.Equal(t, []string{svcNetwork}, rt.CreatedConfigs[1].ExtraNetworks)
+	})
+
+	t.Run("host network cannot be combined with services", func(t *testing.T) {
+		toolsContent := `
+pytest:
+  image: python:3
+  network: host
+  services:
+    redis:
+      image: redis:7
+`
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte(toolsContent), 0644))
+		rt := newRuntime("healthy")
+		runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+			return rt, nil
+		}
+
+		_, err := executeCommand("pytest")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `network "host" cannot be combined with services`)
+		assert.Empty(t, rt.CreatedNetworks)
+		assert.Empty(t, rt.CreatedConfigs)
+	})
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	w := newPrefixWriter(&buf, "[db] ", &mu)
+
+	_, err := w.Write([]byte("ready to\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(" accept"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(" connections\npartial"))
+	require.NoError(t, err)
+	w.Flush()
+
+	assert.Equal(t, "[db] ready to\n[db]  accept connections\n[db] partial\n", buf.String())
+}
+
+func TestExitCodes(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+	})
+
+	var exitCode int
+	exitFunc = func(code int) { exitCode = code }
+	var mock *runtime.MockRuntime
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(m *runtime.MockRuntime)
+		args     []string
+		wantCode int
+	}{
+		{
+			name:     "configuration error",
+			args:     []string{"unknown-tool"},
+			wantCode: 125,
+		},
+		{
+			name:     "create failure",
+			setup:    func(m *runtime.MockRuntime) { m.CreateErr = errors.New("no such image") },
+			args:     []string{"--image", "alpine", "ls"},
+			wantCode: 125,
+		},
+		{
+			name: "command not found",
+			setup: func(m *runtime.MockRuntime) {
+				m.StartErr = fmt.Errorf("%w: exec: \"nope\": executable file not found in $PATH", runtime.ErrCommandNotFound)
+			},
+			args:     []string{"--image", "alpine", "nope"},
+			wantCode: 127,
+		},
+		{
+			name: "command not executable",
+			setup: func(m *runtime.MockRuntime) {
+				m.StartErr = fmt.Errorf("%w: permission denied", runtime.ErrCommandNotExecutable)
+			},
+			args:     []string{"--image", "alpine", "/etc"},
+			wantCode: 126,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock = &runtime.MockRuntime{CreatedContainerID: "c1"}
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+			_, err := executeCommand(tt.args...)
+			var exitErr *ExitError
+			require.ErrorAs(t, err, &exitErr)
+			assert.Equal(t, tt.wantCode, exitErr.Code)
+		})
+	}
+
+	t.Run("OOMKilled is reported", func(t *testing.T) {
+		mock = &runtime.MockRuntime{
+			CreatedContainerID: "c1",
+			ExitCode:           137,
+			InspectInfo:        &runtime.ContainerInfo{ID: "c1", ExitCode: 137, OOMKilled: true},
+		}
+		output, err := executeCommand("--image", "alpine", "ls")
+		require.NoError(t, err)
+		assert.Equal(t, 137, exitCode)
+		assert.Contains(t, output, "OOMKilled")
+		assert.Equal(t, "c1", mock.InspectedContainerID)
+	})
+
+	t.Run("successful runs are not inspected", func(t *testing.T) {
+		mock = &runtime.MockRuntime{CreatedContainerID: "c1"}
+		_, err := executeCommand("--image", "alpine", "ls")
+		require.NoError(t, err)
+		assert.Equal(t, 0, exitCode)
+		assert.Empty(t, mock.InspectedContainerID)
+	})
+}
+
+func TestAutoTerminal(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldTerminals := stdioTerminals
+	oldStdin := os.Stdin
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		stdioTerminals = oldTerminals
+		os.Stdin = oldStdin
+	})
+	exitFunc = func(code int) {}
+	mock := &runtime.MockRuntime{CreatedContainerID: "c1"}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+	devNull, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer devNull.Close()
+	os.Stdin = devNull
+
+	terminals := func(stdin, stdout bool) {
+		stdioTerminals = func() (bool, bool, bool) { return stdin, stdout, stdout }
+	}
+
+	t.Run("allocates a TTY when stdin and stdout are terminals", func(t *testing.T) {
+		terminals(true, true)
+		output, err := executeCommand("--tty=auto", "--interactive=auto", "--dry-run", "-f", "simple", "--image", "python:3", "python")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: true (auto: stdin and stdout are terminals)")
+		assert.Contains(t, output, "Interactive: true (auto: stdin is a terminal)")
+	})
+
+	t.Run("no TTY when stdout is redirected", func(t *testing.T) {
+		terminals(true, false)
+		output, err := executeCommand("--tty=auto", "-i=auto", "--dry-run", "-f", "simple", "--image", "python:3", "python")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: false (auto: stdout is not a terminal)")
+		assert.Contains(t, output, "Interactive: true (auto: stdin is a terminal)")
+
+		output, err = executeCommand("--tty=auto", "--dry-run", "--image", "python:3", "python")
+		require.NoError(t, err)
+		assert.Contains(t, output, "# tty: false (auto: stdout is not a terminal)")
+		assert.Contains(t, output, "tty: false")
+	})
+
+	t.Run("interactive when stdin is a pipe", func(t *testing.T) {
+		terminals(false, false)
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer r.Close()
+		defer w.Close()
+		os.Stdin = r
+		defer func() { os.Stdin = devNull }()
+
+		output, err := executeCommand("--tty=auto", "-i=auto", "--auto-stdin=false", "--dry-run", "-f", "simple", "--image", "jq", "jq")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: false (auto: stdin is not a terminal)")
+		assert.Contains(t, output, "Interactive: true (auto: stdin is a pipe or file)")
+	})
+
+	t.Run("not interactive without terminal or pipe", func(t *testing.T) {
+		terminals(false, false)
+		output, err := executeCommand("-i=auto", "--dry-run", "-f", "simple", "--image", "alpine", "ls")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Interactive: false (auto: stdin is not a terminal or pipe)")
+	})
+
+	t.Run("explicit values are not annotated", func(t *testing.T) {
+		terminals(false, false)
+		output, err := executeCommand("--tty", "--dry-run", "-f", "simple", "--image", "alpine", "sh")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: true\n")
+		assert.Contains(t, output, "Interactive: false\n")
+	})
+
+	t.Run("auto from tools config", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		oldWd, _ := os.Getwd()
+		require.NoError(t, os.Chdir(tmpDir))
+		defer os.Chdir(oldWd)
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte("python:\n  image: python:3\n  tty: auto\n  interactive: auto\n"), 0644))
+
+		terminals(true, true)
+		_, err := executeCommand("python")
+		require.NoError(t, err)
+		require.NotNil(t, mock.CreatedConfig)
+		assert.True(t, mock.CreatedConfig.TTY)
+		assert.True(t, mock.CreatedConfig.Interactive)
+
+		terminals(false, false)
+		_, err = executeCommand("python")
+		require.NoError(t, err)
+		assert.False(t, mock.CreatedConfig.TTY)
+		assert.False(t, mock.CreatedConfig.Interactive)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := executeCommand("--tty=sometimes", "--image", "alpine", "sh")
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitStreams(t *testing.T) {
+	oldFactory := runtimeFactory
+	oldExit := exitFunc
+	oldTerminals := stdioTerminals
+	t.Cleanup(func() {
+		runtimeFactory = oldFactory
+		exitFunc = oldExit
+		stdioTerminals = oldTerminals
+	})
+	exitFunc = func(code int) {}
+	mock := &runtime.MockRuntime{CreatedContainerID: "c1"}
+	runtimeFactory = func(name, socket string) (runtime.ContainerRuntime, error) {
+		return mock, nil
+	}
+
+	terminals := func(stdin, stdout, stderr bool) {
+		stdioTerminals = func() (bool, bool, bool) { return stdin, stdout, stderr }
+	}
+
+	t.Run("TTY when stdout and stderr are terminals", func(t *testing.T) {
+		terminals(true, true, true)
+		output, err := executeCommand("--tty", "--split-streams", "--dry-run", "-f", "simple", "--image", "alpine", "sh")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: true\n")
+	})
+
+	t.Run("no TTY when stderr is redirected", func(t *testing.T) {
+		terminals(true, true, false)
+		output, err := executeCommand("--tty", "--split-streams", "--dry-run", "-f", "simple", "--image", "alpine", "sh")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: false (split-streams: stderr is not a terminal)")
+
+		mock.AttachOptions = runtime.AttachOptions{}
+		_, err = executeCommand("--tty", "--split-streams", "--image", "alpine", "sh")
+		require.NoError(t, err)
+		assert.False(t, mock.CreatedConfig.TTY)
+		assert.False(t, mock.AttachOptions.TTY)
+	})
+
+	t.Run("no TTY when stdout is redirected", func(t *testing.T) {
+		terminals(true, false, true)
+		output, err := executeCommand("--tty", "--dry-run", "-f", "simple", "--image", "alpine", "sh", "--cderun-split-streams")
+		require.NoError(t, err)
+		assert.Contains(t, output, "TTY: false (split-streams: stdout is not a terminal)")
+	})
+
+	t.Run("TTY is kept without split-streams", func(t *testing.T) {
+		terminals(true, true, false)
+		_, err := executeCommand("--tty", "--image", "alpine", "sh")
+		require.NoError(t, err)
+		assert.True(t, mock.CreatedConfig.TTY)
+		assert.True(t, mock.AttachOptions.TTY)
+	})
+
+	t.Run("from tools config", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		oldWd, _ := os.Getwd()
+		require.NoError(t, os.Chdir(tmpDir))
+		defer os.Chdir(oldWd)
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte("pytest:\n  image: python:3\n  tty: true\n  splitStreams: true\n"), 0644))
+
+		terminals(true, true, false)
+		_, err := executeCommand("pytest")
+		require.NoError(t, err)
+		assert.False(t, mock.CreatedConfig.TTY)
+
+		terminals(true, true, true)
+		_, err = executeCommand("pytest")
+		require.NoError(t, err)
+		assert.True(t, mock.CreatedConfig.TTY)
+	})
+}
@@ -0,0 +1,250 @@
+package command
+
+import (
+	"bytes"
+	"cderun/internal/container"
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// For testing
+	serviceStartTimeout = 2 * time.Minute
+	servicePollInterval = 500 * time.Millisecond
+)
+
+// startServices starts the sidecar services on a private network, waits until
+// they are ready and connects the main container to that network. A network
+// configured for the tool stays the container's primary network.
+// The returned function stops the services and removes the network. It must be
+// called even if startServices returns an error.
+func startServices(ctx context.Context, rt runtime.ContainerRuntime, containerConfig *container.ContainerConfig, streamLogs bool) (func(), error) {
+	cleanupCtx := context.WithoutCancel(ctx)
+	logsCtx, stopLogs := context.WithCancel(cleanupCtx)
+	var logsWG sync.WaitGroup
+	var logsMu sync.Mutex
+
+	var networkName string
+	var serviceIDs []string
+	teardown := func() {
+		stopLogs()
+		for i := len(serviceIDs) - 1; i >= 0; i-- {
+			logging.Trace("Removing service container: %s", serviceIDs[i])
+			if err := rt.RemoveContainer(cleanupCtx, serviceIDs[i]); err != nil {
+				logging.Warn("failed to remove service container %s: %v", serviceIDs[i], err)
+			}
+		}
+		logsWG.Wait()
+		if networkName == "" {
+			return
+		}
+		logging.Trace("Removing network: %s", networkName)
+		err := rt.RemoveNetwork(cleanupCtx, networkName)
+		if errors.Is(err, runtime.ErrNetworkInUse) {
+			// The main container is kept around when --remove=false
+			logging.Debug("Network %s is still in use, keeping it", networkName)
+		} else if err != nil {
+			logging.Warn("failed to remove network %s: %v", networkName, err)
+		}
+	}
+
+	// Abort a slow startup (e.g. image pulls, health checks) on Ctrl+C while still tearing down
+	startCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	setupSignals(sigChan)
+	defer signal.Stop(sigChan)
+	go func() {
+		select {
+		case sig := <-sigChan:
+			logging.Info("Received signal %v while starting services, aborting...", sig)
+			cancel()
+		case <-startCtx.Done():
+		}
+	}()
+
+	if !joinsNetworks(containerConfig.Network) {
+		return teardown, fmt.Errorf("network %q cannot be combined with services, which need a private network", containerConfig.Network)
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return teardown, fmt.Errorf("failed to generate services network name: %w", err)
+	}
+	name := "cderun-svc-" + hex.EncodeToString(suffix)
+	logging.Debug("Creating services network: %s", name)
+	if err := rt.CreateNetwork(startCtx, &container.NetworkSpec{
+		Name:   name,
+		Labels: map[string]string{managedLabel: "true"},
+	}); err != nil {
+		return teardown, fmt.Errorf("failed to create services network: %w", err)
+	}
+	networkName = name
+
+	for _, svc := range containerConfig.Services {
+		labels := map[string]string{}
+		for k, v := range containerConfig.Labels {
+			labels[k] = v
+		}
+		labels[serviceLabel] = svc.Name
+		labels[removeLabel] = "true"
+
+		logging.Info("Starting service: %s (%s)", svc.Name, svc.Image)
+		id, err := rt.CreateContainer(startCtx, &container.ContainerConfig{
+			Image:          svc.Image,
+			Command:        svc.Command,
+			Network:        networkName,
+			NetworkAliases: []string{svc.Name},
+			Ports:          svc.Ports,
+			Env:            svc.Env,
+			Healthcheck:    svc.Healthcheck,
+			Labels:         labels,
+		})
+		if err != nil {
+			return teardown, fmt.Errorf("failed to create service %q: %w", svc.Name, err)
+		}
+		serviceIDs = append(serviceIDs, id)
+
+		if err := rt.StartContainer(startCtx, id); err != nil {
+			return teardown, fmt.Errorf("failed to start service %q: %w", svc.Name, err)
+		}
+
+		if streamLogs {
+			logsWG.Add(1)
+			go func(name, id string) {
+				defer logsWG.Done()
+				w := newPrefixWriter(os.Stderr, "["+name+"] ", &logsMu)
+				defer w.Flush()
+				if err := rt.ContainerLogs(logsCtx, id, true, w, w); err != nil && logsCtx.Err() == nil {
+					logging.Debug("Log stream of service %s ended: %v", name, err)
+				}
+			}(svc.Name, id)
+		}
+	}
+
+	// All services are started before waiting, so they become ready concurrently
+	for i, svc := range containerConfig.Services {
+		if err := waitForService(startCtx, rt, svc.Name, serviceIDs[i]); err != nil {
+			if !streamLogs && startCtx.Err() == nil {
+				// Show why the service failed
+				w := newPrefixWriter(os.Stderr, "["+svc.Name+"] ", &logsMu)
+				_ = rt.ContainerLogs(cleanupCtx, serviceIDs[i], false, w, w)
+				w.Flush()
+			}
+			return teardown, err
+		}
+		logging.Debug("Service %s is ready", svc.Name)
+	}
+
+	switch containerConfig.Network {
+	case "", "bridge", "default":
+		containerConfig.Network = networkName
+	default:
+		logging.Debug("Connecting to the services network %s in addition to %s", networkName, containerConfig.Network)
+		containerConfig.ExtraNetworks = append(containerConfig.ExtraNetworks, networkName)
+	}
+
+	return teardown, nil
+}
+
+// joinsNetworks reports whether a container in the network mode can be
+// connected to further networks. host, none and container:<id> cannot.
+func joinsNetworks(mode string) bool {
+	switch {
+	case mode == "host", mode == "none", strings.HasPrefix(mode, "container:"):
+		return false
+	}
+	return true
+}
+
+// waitForService polls the service until it is healthy, or running when it has
+// no healthcheck.
+func waitForService(ctx context.Context, rt runtime.ContainerRuntime, name, containerID string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, serviceStartTimeout)
+	defer cancel()
+	ticker := time.NewTicker(servicePollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := rt.InspectContainer(timeoutCtx, containerID)
+		if err != nil && timeoutCtx.Err() == nil {
+			return fmt.Errorf("failed to inspect service %q: %w", name, err)
+		}
+		if err == nil {
+			switch {
+			case info.Health == "healthy":
+				return nil
+			case info.Health == "unhealthy":
+				return fmt.Errorf("service %q is unhealthy", name)
+			case !info.Running && (info.Status == "exited" || info.Status == "dead"):
+				return fmt.Errorf("service %q exited with code %d", name, info.ExitCode)
+			case info.Health == "" && info.Running:
+				return nil
+			}
+			logging.Trace("Waiting for service %s (status: %s, health: %s)", name, info.Status, info.Health)
+		}
+
+		select {
+		case <-timeoutCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("timed out after %s waiting for service %q", serviceStartTimeout, name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// prefixWriter prepends a prefix to every line. Writers sharing the same mutex
+// never interleave their lines.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string, mu *sync.Mutex) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix, mu: mu}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a trailing partial line, if any.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		_ = p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
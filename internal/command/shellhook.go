@@ -0,0 +1,372 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type shellHookOptions struct {
+	update bool
+}
+
+var shellHookOpts = &shellHookOptions{}
+
+var shellHookCmd = &cobra.Command{
+	Use:   "shell-hook bash|zsh|fish",
+	Short: "Print shell code that activates the tools of the current project",
+	Long: `Print shell code that puts the tools of the current project on PATH.
+
+Whenever the working directory changes, the hook looks for .tools.yaml in the
+directory and its parents. Inside a project, a directory with a shim for each
+tool is prepended to PATH, so "node" runs "cderun node" with the tools file of
+the project. The directory is removed from PATH again when leaving the project.
+
+A tools file can give its tools access to the host, e.g. with volumes or
+mountSocket, and its tools shadow host commands like "git". Like direnv, the
+hook only activates tools files allowed with "cderun shell-hook allow", and
+they must be allowed again after every change.
+
+Add one of these to your shell configuration:
+  bash  eval "$(cderun shell-hook bash)"     in ~/.bashrc
+  zsh   eval "$(cderun shell-hook zsh)"      in ~/.zshrc
+  fish  cderun shell-hook fish | source      in ~/.config/fish/config.fish`,
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if shellHookOpts.update {
+			// Runs on every directory change, so errors must stay short
+			cmd.SilenceUsage = true
+			dir, err := updateProjectShims(".")
+			var notAllowed *notAllowedError
+			if errors.As(err, &notAllowed) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "cderun: %v\nReview it and run \"cderun shell-hook allow\" to put its tools on PATH\n", err)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if dir != "" {
+				fmt.Fprintln(cmd.OutOrStdout(), dir)
+			}
+			return nil
+		}
+
+		if len(args) != 1 {
+			return fmt.Errorf("shell-hook requires a shell: bash, zsh or fish")
+		}
+		exe, err := cderunExecutable()
+		if err != nil {
+			return err
+		}
+		var script string
+		switch args[0] {
+		case "bash":
+			script = strings.ReplaceAll(bashHook, "@CDERUN@", shellQuote(exe))
+		case "zsh":
+			script = strings.ReplaceAll(zshHook, "@CDERUN@", shellQuote(exe))
+		case "fish":
+			script = strings.ReplaceAll(fishHook, "@CDERUN@", fishQuote(exe))
+		default:
+			return fmt.Errorf("unsupported shell %q: must be bash, zsh or fish", args[0])
+		}
+		fmt.Fprint(cmd.OutOrStdout(), script)
+		return nil
+	},
+}
+
+var shellHookAllowCmd = &cobra.Command{
+	Use:   "allow [DIR]",
+	Short: "Allow the shell hook to activate the tools of a project",
+	Long: `Allow the shell hook to put the tools of the .tools.yaml in DIR (default: the
+current directory) or its parents on PATH. Review the file first: its tools
+can access the host, e.g. with volumes or mountSocket.
+
+The permission covers the current content of the tools file and of the Compose
+files its tools are based on. After any change, the shims refuse to run until
+the file is allowed again.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		toolsFile, err := projectToolsFile(args)
+		if err != nil {
+			return err
+		}
+		tools, err := config.LoadToolsFile(toolsFile)
+		if err != nil {
+			return err
+		}
+		digest, err := config.ToolsFileDigest(toolsFile)
+		if err != nil {
+			return err
+		}
+		dir, err := allowedDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, digest), []byte(toolsFile), 0600); err != nil {
+			return fmt.Errorf("failed to allow %s: %w", toolsFile, err)
+		}
+		// Refresh shims that are already on PATH
+		if _, err := updateProjectShims(filepath.Dir(toolsFile)); err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(tools))
+		for name := range tools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(cmd.OutOrStdout(), "Allowed %s (%s)\nThe tools are put on PATH the next time you enter the project\n", toolsFile, strings.Join(names, ", "))
+		return nil
+	},
+}
+
+var shellHookDenyCmd = &cobra.Command{
+	Use:   "deny [DIR]",
+	Short: "Revoke the permission given with shell-hook allow",
+	Long: `Revoke the permission given with "cderun shell-hook allow" for the
+.tools.yaml in DIR (default: the current directory) or its parents, and remove
+the shims of the project.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		toolsFile, err := projectToolsFile(args)
+		if err != nil {
+			return err
+		}
+		dir, err := allowedDir()
+		if err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			if data, err := os.ReadFile(path); err == nil && string(data) == toolsFile {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("failed to deny %s: %w", toolsFile, err)
+				}
+			}
+		}
+		shimDir, err := projectShimDir(toolsFile)
+		if err != nil {
+			return err
+		}
+		if err := removeShims(shimDir, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Denied %s\n", toolsFile)
+		return nil
+	},
+}
+
+// The hooks only call cderun when the working directory changes. The shim
+// directory printed by "shell-hook --update" is the same for every directory of
+// a project, so PATH is only touched when entering or leaving a project.
+const bashHook = `_cderun_hook() {
+  [ "$PWD" = "${_CDERUN_PWD-}" ] && return
+  _CDERUN_PWD=$PWD
+  local dir
+  dir=$(@CDERUN@ shell-hook --update)
+  [ "$dir" = "${_CDERUN_SHIMS-}" ] && return
+  if [ -n "${_CDERUN_SHIMS-}" ]; then
+    PATH=":$PATH:"
+    PATH=${PATH//:"$_CDERUN_SHIMS":/:}
+    PATH=${PATH#:}
+    PATH=${PATH%:}
+  fi
+  [ -n "$dir" ] && PATH="$dir:$PATH"
+  _CDERUN_SHIMS=$dir
+}
+if [[ ";${PROMPT_COMMAND-};" != *";_cderun_hook;"* ]]; then
+  PROMPT_COMMAND="_cderun_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`
+
+const zshHook = `_cderun_hook() {
+  local dir
+  dir=$(@CDERUN@ shell-hook --update)
+  [[ "$dir" == "${_CDERUN_SHIMS-}" ]] && return
+  [[ -n "${_CDERUN_SHIMS-}" ]] && path=(${path:#${(b)_CDERUN_SHIMS}})
+  [[ -n "$dir" ]] && path=("$dir" $path)
+  typeset -g _CDERUN_SHIMS=$dir
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _cderun_hook
+_cderun_hook
+`
+
+const fishHook = `function _cderun_hook --on-variable PWD
+    set -l dir (@CDERUN@ shell-hook --update)
+    test "$dir" = "$_cderun_shims"; and return
+    if test -n "$_cderun_shims"
+        set -l i (contains -i -- $_cderun_shims $PATH); and set -e PATH[$i]
+    end
+    test -n "$dir"; and set -gx PATH $dir $PATH
+    set -g _cderun_shims $dir
+end
+_cderun_hook
+`
+
+// notAllowedError is returned by updateProjectShims for a tools file that has
+// not been allowed with "cderun shell-hook allow", or has changed since.
+type notAllowedError struct {
+	toolsFile string
+}
+
+func (e *notAllowedError) Error() string {
+	return fmt.Sprintf("%s is not allowed (new, or changed since it was allowed)", e.toolsFile)
+}
+
+// updateProjectShims finds the tools file of the project containing dir and
+// writes a shim for each of its tools into the project's shim directory,
+// removing shims of tools that are gone. It returns the shim directory, or ""
+// outside of a project. Tools files that are not allowed get no shims.
+func updateProjectShims(dir string) (string, error) {
+	toolsFile, err := config.FindToolsFile(dir)
+	if err != nil || toolsFile == "" {
+		return "", err
+	}
+	shimDir, err := projectShimDir(toolsFile)
+	if err != nil {
+		return "", err
+	}
+	digest, err := config.ToolsFileDigest(toolsFile)
+	if err != nil {
+		return "", err
+	}
+	if allowed, err := isAllowed(digest); err != nil {
+		return "", err
+	} else if !allowed {
+		if err := removeShims(shimDir, nil); err != nil {
+			return "", err
+		}
+		return "", &notAllowedError{toolsFile: toolsFile}
+	}
+
+	tools, err := config.LoadToolsFile(toolsFile)
+	if err != nil {
+		return "", err
+	}
+	exe, err := cderunExecutable()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(shimDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", shimDir, err)
+	}
+	if err := removeShims(shimDir, tools); err != nil {
+		return "", err
+	}
+	// The shims check the digest, so they stop working when the file changes
+	env := []string{"CDERUN_TOOLS_FILE=" + toolsFile, "CDERUN_TOOLS_DIGEST=" + digest}
+	for tool := range tools {
+		if err := writeShim(filepath.Join(shimDir, tool), exe, tool, env); err != nil {
+			return "", fmt.Errorf("failed to write shim for %s: %w", tool, err)
+		}
+	}
+	return shimDir, nil
+}
+
+// removeShims removes the shims in shimDir of tools that are not in keep. Other
+// files are left alone.
+func removeShims(shimDir string, keep config.ToolsConfig) error {
+	entries, err := os.ReadDir(shimDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", shimDir, err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(shimDir, e.Name())
+		if _, ok := keep[e.Name()]; !ok && isCderunLink(path) {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// projectToolsFile returns the tools file for the optional directory argument
+// of allow and deny.
+func projectToolsFile(args []string) (string, error) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	toolsFile, err := config.FindToolsFile(dir)
+	if err != nil {
+		return "", err
+	}
+	if toolsFile == "" {
+		return "", fmt.Errorf("no .tools.yaml found in %s or its parents", dir)
+	}
+	return toolsFile, nil
+}
+
+// allowedDir returns the directory recording the allowed tools files. Each file
+// is named after the digest of an allowed tools file and contains its path.
+func allowedDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "cderun", "allowed"), nil
+}
+
+// isAllowed reports whether the tools file with the given digest is allowed.
+func isAllowed(digest string) (bool, error) {
+	dir, err := allowedDir()
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(filepath.Join(dir, digest))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// projectShimDir returns the shim directory of the project with the given tools
+// file. It is named after the project directory and a hash of its path, so
+// projects with the same name get separate directories.
+func projectShimDir(toolsFile string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find cache directory: %w", err)
+	}
+	project := filepath.Dir(toolsFile)
+	sum := sha256.Sum256([]byte(project))
+	name := filepath.Base(project) + "-" + hex.EncodeToString(sum[:6])
+	return filepath.Join(cache, "cderun", "shims", name), nil
+}
+
+// fishQuote quotes s for fish, where backslashes are special in single quotes.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func init() {
+	shellHookCmd.Flags().BoolVar(&shellHookOpts.update, "update", false, "Update the shims of the current project and print their directory")
+	_ = shellHookCmd.Flags().MarkHidden("update")
+
+	shellHookCmd.AddCommand(shellHookAllowCmd, shellHookDenyCmd)
+
+	rootCmd.AddCommand(shellHookCmd)
+}
@@ -0,0 +1,113 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellHook(t *testing.T) {
+	oldWd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(oldWd) })
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	exe, err := cderunExecutable()
+	require.NoError(t, err)
+
+	t.Run("scripts", func(t *testing.T) {
+		for _, shell := range []string{"bash", "zsh", "fish"} {
+			out, err := executeCommand("shell-hook", shell)
+			require.NoError(t, err, shell)
+			assert.Contains(t, out, "_cderun_hook", shell)
+			assert.Contains(t, out, exe+"' shell-hook --update", shell)
+		}
+		assert.Equal(t, `'C:\\cderun\'s'`, fishQuote(`C:\cderun's`))
+
+		_, err := executeCommand("shell-hook", "tcsh")
+		assert.ErrorContains(t, err, `unsupported shell "tcsh"`)
+		_, err = executeCommand("shell-hook")
+		assert.ErrorContains(t, err, "requires a shell")
+	})
+
+	project := filepath.Join(t.TempDir(), "app")
+	sub := filepath.Join(project, "src")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+	toolsFile := filepath.Join(project, ".tools.yaml")
+	require.NoError(t, os.WriteFile(toolsFile, []byte("node:\n  image: node:20\nnpm:\n  image: node:20\n"), 0644))
+
+	t.Run("not allowed", func(t *testing.T) {
+		require.NoError(t, os.Chdir(sub))
+		out, err := executeCommand("shell-hook", "--update")
+		require.NoError(t, err)
+		assert.Equal(t, "cderun: "+toolsFile+" is not allowed (new, or changed since it was allowed)\nReview it and run \"cderun shell-hook allow\" to put its tools on PATH\n", out)
+	})
+
+	var dir string
+	t.Run("update", func(t *testing.T) {
+		require.NoError(t, os.Chdir(sub))
+		out, err := executeCommand("shell-hook", "allow")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Allowed "+toolsFile+" (node, npm)\n")
+
+		out, err = executeCommand("shell-hook", "--update")
+		require.NoError(t, err)
+		shimDir := filepath.Join(os.Getenv("XDG_CACHE_HOME"), "cderun", "shims")
+		dir = out[:len(out)-1]
+		assert.Equal(t, shimDir, filepath.Dir(dir))
+		assert.Contains(t, filepath.Base(dir), "app-")
+
+		digest, err := config.ToolsFileDigest(toolsFile)
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(dir, "node"))
+		require.NoError(t, err)
+		assert.Equal(t, "#!/bin/sh\n"+shimMarker+"\nCDERUN_TOOLS_FILE="+shellQuote(toolsFile)+" CDERUN_TOOLS_DIGEST='"+digest+"' exec "+shellQuote(exe)+" -- 'node' \"$@\"\n", string(data))
+
+		// A changed file must be allowed again
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes"), []byte("mine"), 0644))
+		require.NoError(t, os.WriteFile(toolsFile, []byte("node:\n  image: node:22\n"), 0644))
+		out, err = executeCommand("shell-hook", "--update")
+		require.NoError(t, err)
+		assert.Contains(t, out, "is not allowed")
+		assert.NoFileExists(t, filepath.Join(dir, "node"))
+
+		// Shims of removed tools are deleted, other files are kept
+		_, err = executeCommand("shell-hook", "allow", project)
+		require.NoError(t, err)
+		out2, err := executeCommand("shell-hook", "--update")
+		require.NoError(t, err)
+		assert.Equal(t, dir+"\n", out2, "the directory is the same for the whole project")
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"node", "notes"}, names)
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		out, err := executeCommand("shell-hook", "deny", sub)
+		require.NoError(t, err)
+		assert.Equal(t, "Denied "+toolsFile+"\n", out)
+		assert.NoFileExists(t, filepath.Join(dir, "node"))
+		assert.FileExists(t, filepath.Join(dir, "notes"))
+
+		out, err = executeCommand("shell-hook", "--update")
+		require.NoError(t, err)
+		assert.Contains(t, out, "is not allowed")
+
+		_, err = executeCommand("shell-hook", "deny", os.Getenv("HOME"))
+		assert.ErrorContains(t, err, "no .tools.yaml found")
+	})
+
+	t.Run("outside of a project", func(t *testing.T) {
+		dir, err := updateProjectShims(os.Getenv("HOME"))
+		require.NoError(t, err)
+		assert.Empty(t, dir)
+	})
+}
@@ -0,0 +1,158 @@
+package command
+
+import (
+	"cderun/internal/logging"
+	"cderun/internal/runtime"
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// For testing: time to wait for the container to exit after StopContainer returned
+var killGracePeriod = 5 * time.Second
+
+// getSignalName returns the standard name for a signal.
+func getSignalName(sig os.Signal) string {
+	for name, s := range signalsByName {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// lookupSignals returns the signals to subscribe to for the given names.
+// Interrupt signals are always included; names unsupported on this platform are skipped.
+func lookupSignals(names []string) []os.Signal {
+	var signals []os.Signal
+	seen := map[os.Signal]bool{}
+	add := func(sig os.Signal) {
+		if !seen[sig] {
+			seen[sig] = true
+			signals = append(signals, sig)
+		}
+	}
+	for _, name := range names {
+		sig, ok := signalsByName[name]
+		if !ok {
+			logging.Debug("Signal %s is not supported on this platform", name)
+			continue
+		}
+		add(sig)
+	}
+	for _, sig := range signalsByName {
+		if isInterruptSignal(sig) {
+			add(sig)
+		}
+	}
+	return signals
+}
+
+// signalForwarder relays signals received by cderun to a container.
+type signalForwarder struct {
+	rt          runtime.ContainerRuntime
+	containerID string
+	tty         bool
+	stopTimeout time.Duration
+	// execSignal signals the processes of an exec session instead of the
+	// container, since the Engine API cannot signal exec sessions.
+	execSignal func(ctx context.Context, name string) error
+
+	mu           sync.Mutex
+	terminatedBy os.Signal // Interrupt that made cderun stop the container
+}
+
+// run relays signals from sigChan to the container until ctx is done.
+// The first interrupt is forwarded, a second one stops the container gracefully
+// with StopContainer and a third one gives up waiting via cancel.
+// Without a TTY, a terminal stop is forwarded and then suspends cderun itself;
+// with a TTY, Ctrl+Z reaches the container through the terminal instead.
+func (f *signalForwarder) run(ctx context.Context, cancel context.CancelFunc, sigChan chan os.Signal) {
+	forward := func(name string) {
+		logging.Debug("Forwarding signal %s to container", name)
+		if err := f.signal(ctx, name); err != nil {
+			logging.Warn("failed to forward signal %s: %v", name, err)
+		}
+	}
+
+	interrupts := 0
+	for {
+		select {
+		case sig := <-sigChan:
+			switch {
+			case isInterruptSignal(sig):
+				interrupts++
+				switch interrupts {
+				case 1:
+					forward(getSignalName(sig))
+				case 2:
+					logging.Info("Received second interrupt, stopping container (interrupt again to force)...")
+					f.setTerminatedBy(sig)
+					go f.stop(ctx, cancel)
+				default:
+					logging.Info("Received third interrupt, terminating...")
+					f.setTerminatedBy(sig)
+					cancel()
+					return
+				}
+			case isSuspendSignal(sig) && !f.tty:
+				forward(getSignalName(sig))
+				suspendSelf()
+				forward("SIGCONT")
+			default:
+				forward(getSignalName(sig))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *signalForwarder) signal(ctx context.Context, name string) error {
+	if f.execSignal != nil {
+		return f.execSignal(ctx, name)
+	}
+	return f.rt.SignalContainer(ctx, f.containerID, name)
+}
+
+// stop stops the container with its stop signal, killing it after the stop
+// timeout, and cancels the run if it still has not exited. An exec session is
+// killed right away since the container is shared with other sessions.
+func (f *signalForwarder) stop(ctx context.Context, cancel context.CancelFunc) {
+	if f.execSignal != nil {
+		if err := f.execSignal(ctx, "SIGKILL"); err != nil {
+			logging.Warn("failed to kill exec session: %v", err)
+		}
+	} else if err := f.rt.StopContainer(ctx, f.containerID, f.stopTimeout); err != nil {
+		logging.Warn("failed to stop container: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(killGracePeriod):
+	}
+
+	logging.Warn("Container did not exit after being stopped, terminating...")
+	cancel()
+}
+
+func (f *signalForwarder) setTerminatedBy(sig os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.terminatedBy = sig
+}
+
+// exitCode returns 128+n for the interrupt that made cderun stop the container.
+func (f *signalForwarder) exitCode() (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.terminatedBy == nil {
+		return 0, false
+	}
+	if s, ok := f.terminatedBy.(syscall.Signal); ok {
+		return 128 + int(s), true
+	}
+	return 130, true
+}
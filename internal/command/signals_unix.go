@@ -9,6 +9,19 @@ import (
 	"syscall"
 )
 
+// signalsByName maps the names of forwardable signals to the signals of this platform.
+var signalsByName = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTSTP": syscall.SIGTSTP,
+	"SIGCONT": syscall.SIGCONT,
+	"SIGALRM": syscall.SIGALRM,
+}
+
 // setupSignals sets up SIGINT and SIGTERM notification.
 func setupSignals(sigChan chan os.Signal) {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -19,14 +32,17 @@ func setupResizeSignal(resizeChan chan os.Signal) {
 	signal.Notify(resizeChan, syscall.SIGWINCH)
 }
 
-// getSignalName returns the standard name for a signal.
-func getSignalName(sig os.Signal) string {
-	switch sig {
-	case syscall.SIGINT:
-		return "SIGINT"
-	case syscall.SIGTERM:
-		return "SIGTERM"
-	default:
-		return sig.String()
-	}
+// isInterruptSignal reports whether sig asks cderun to terminate.
+func isInterruptSignal(sig os.Signal) bool {
+	return sig == syscall.SIGINT || sig == syscall.SIGTERM
+}
+
+// isSuspendSignal reports whether sig is a terminal stop (Ctrl+Z).
+func isSuspendSignal(sig os.Signal) bool {
+	return sig == syscall.SIGTSTP
+}
+
+// suspendSelf stops the cderun process and returns once it is continued.
+func suspendSelf() {
+	_ = syscall.Kill(os.Getpid(), syscall.SIGSTOP)
 }
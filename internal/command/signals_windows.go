@@ -8,6 +8,12 @@ import (
 	"os/signal"
 )
 
+// signalsByName maps the names of forwardable signals to the signals of this platform.
+// Only Ctrl+C is delivered as a signal on Windows.
+var signalsByName = map[string]os.Signal{
+	"SIGINT": os.Interrupt,
+}
+
 // setupSignals sets up SIGINT notification on Windows.
 func setupSignals(sigChan chan os.Signal) {
 	signal.Notify(sigChan, os.Interrupt)
@@ -18,10 +24,15 @@ func setupResizeSignal(resizeChan chan os.Signal) {
 	// SIGWINCH is not available on Windows
 }
 
-// getSignalName returns the standard name for a signal on Windows.
-func getSignalName(sig os.Signal) string {
-	if sig == os.Interrupt {
-		return "SIGINT"
-	}
-	return sig.String()
+// isInterruptSignal reports whether sig asks cderun to terminate.
+func isInterruptSignal(sig os.Signal) bool {
+	return sig == os.Interrupt
 }
+
+// isSuspendSignal always returns false because Windows has no job control.
+func isSuspendSignal(sig os.Signal) bool {
+	return false
+}
+
+// suspendSelf is a stub for Windows.
+func suspendSelf() {}
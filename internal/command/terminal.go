@@ -0,0 +1,99 @@
+package command
+
+import (
+	"cderun/internal/config"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// For testing: reports whether stdin, stdout and stderr are terminals
+var stdioTerminals = func() (stdin, stdout, stderr bool) {
+	return term.IsTerminal(int(os.Stdin.Fd())), term.IsTerminal(int(os.Stdout.Fd())), term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// boolOrAutoValue is a flag value that accepts true, false or auto.
+// Like a bool flag, it means true when given without a value (e.g. --tty).
+type boolOrAutoValue config.BoolOrAuto
+
+func newBoolOrAutoValue(val config.BoolOrAuto, p *config.BoolOrAuto) *boolOrAutoValue {
+	*p = val
+	return (*boolOrAutoValue)(p)
+}
+
+func (v *boolOrAutoValue) Set(s string) error {
+	b, err := config.ParseBoolOrAuto(s)
+	if err != nil {
+		return err
+	}
+	*v = boolOrAutoValue(b)
+	return nil
+}
+
+func (v *boolOrAutoValue) String() string { return string(*v) }
+
+func (v *boolOrAutoValue) Type() string { return "bool|auto" }
+
+// decideTTY returns whether to allocate a TTY and, for "auto", why.
+// A TTY is only allocated automatically when both stdin and stdout are terminals,
+// so piping into or out of a tool keeps working.
+func decideTTY(mode config.BoolOrAuto) (bool, string) {
+	if !mode.IsAuto() {
+		return mode.Bool(), ""
+	}
+	stdin, stdout, _ := stdioTerminals()
+	switch {
+	case !stdin:
+		return false, "stdin is not a terminal"
+	case !stdout:
+		return false, "stdout is not a terminal"
+	}
+	return true, "stdin and stdout are terminals"
+}
+
+// decideContainerTTY applies split-streams on top of decideTTY and returns a note
+// on how the value was decided, e.g. "auto: stdin is not a terminal".
+// A TTY carries stdout and stderr as one stream, so with split-streams it is only
+// allocated when neither is redirected, e.g. "cderun --tty foo 2>err.log" gets
+// separate streams instead of err.log staying empty.
+func decideContainerTTY(resolved *config.ResolvedConfig) (bool, string) {
+	tty, reason := decideTTY(resolved.TTY)
+	if tty && resolved.SplitStreams {
+		_, stdout, stderr := stdioTerminals()
+		switch {
+		case !stdout:
+			return false, "split-streams: stdout is not a terminal"
+		case !stderr:
+			return false, "split-streams: stderr is not a terminal"
+		}
+	}
+	if reason == "" {
+		return tty, ""
+	}
+	return tty, "auto: " + reason
+}
+
+// decideInteractive returns whether to keep stdin open and, for "auto", why.
+// Stdin is attached automatically when it is a terminal or a pipe.
+func decideInteractive(mode config.BoolOrAuto) (bool, string) {
+	if !mode.IsAuto() {
+		return mode.Bool(), ""
+	}
+	if stdin, _, _ := stdioTerminals(); stdin {
+		return true, "stdin is a terminal"
+	}
+	if stdinIsPipe() {
+		return true, "stdin is a pipe or file"
+	}
+	return false, "stdin is not a terminal or pipe"
+}
+
+// autoNote explains how an "auto" setting was decided, e.g. "auto: stdin is a terminal".
+// It is empty for settings given explicitly.
+func autoNote(mode config.BoolOrAuto, decide func(config.BoolOrAuto) (bool, string)) string {
+	if !mode.IsAuto() {
+		return ""
+	}
+	_, reason := decide(mode)
+	return "auto: " + reason
+}
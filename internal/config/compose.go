@@ -0,0 +1,735 @@
+package config
+
+import (
+	"bufio"
+	"cderun/internal/logging"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComposePaths are the file names Docker Compose looks for, in order.
+var ComposePaths = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// ComposeFile holds the parts of a Compose file that cderun maps onto tools.
+// See https://compose-spec.io.
+type ComposeFile struct {
+	Name     string                     `yaml:"name"`
+	Services map[string]ComposeService  `yaml:"services"`
+	Networks map[string]*ComposeNetwork `yaml:"networks"`
+
+	dir     string // Project directory: the directory of the file
+	project string
+	// forImport keeps host values out of the environment, see LoadComposeForImport
+	forImport bool
+}
+
+type ComposeService struct {
+	Image       string          `yaml:"image"`
+	Build       *ComposeBuild   `yaml:"build"`
+	Volumes     []ComposeVolume `yaml:"volumes"`
+	Environment composeMapping  `yaml:"environment"`
+	WorkingDir  string          `yaml:"working_dir"`
+	User        string          `yaml:"user"`
+	NetworkMode string          `yaml:"network_mode"`
+	Networks    yaml.Node       `yaml:"networks"`
+	Ports       []ComposePort   `yaml:"ports"`
+	ExtraHosts  yaml.Node       `yaml:"extra_hosts"`
+}
+
+// ComposeBuild is the build section of a service, either the context or a mapping.
+type ComposeBuild struct {
+	Context    string         `yaml:"context"`
+	Dockerfile string         `yaml:"dockerfile"`
+	Args       composeMapping `yaml:"args"`
+	Target     string         `yaml:"target"`
+}
+
+// UnmarshalYAML accepts both `build: ./app` and `build: {context: ./app}`.
+func (b *ComposeBuild) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*b = ComposeBuild{Context: value.Value}
+		return nil
+	}
+	type plain ComposeBuild
+	return value.Decode((*plain)(b))
+}
+
+type ComposeNetwork struct {
+	Name     string `yaml:"name"`
+	External bool   `yaml:"external"`
+}
+
+// ComposeVolume is a volume in the short ("./src:/src:ro") or the long syntax.
+type ComposeVolume struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only"`
+}
+
+// UnmarshalYAML accepts both the short and the long volume syntax.
+func (v *ComposeVolume) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		type plain ComposeVolume
+		return value.Decode((*plain)(v))
+	}
+	parts := strings.Split(value.Value, ":")
+	switch len(parts) {
+	case 1: // Anonymous volume
+		*v = ComposeVolume{Type: "volume", Target: parts[0]}
+		return nil
+	case 2, 3:
+		*v = ComposeVolume{Source: parts[0], Target: parts[1]}
+		if len(parts) == 3 {
+			v.ReadOnly = strings.Contains(","+parts[2]+",", ",ro,")
+		}
+	default:
+		return fmt.Errorf("invalid volume %q", value.Value)
+	}
+	// Like Compose, a source that is not a path is a named volume
+	v.Type = "volume"
+	if isComposePath(v.Source) {
+		v.Type = "bind"
+	}
+	return nil
+}
+
+func isComposePath(s string) bool {
+	return strings.HasPrefix(s, ".") || strings.HasPrefix(s, "~") || filepath.IsAbs(s)
+}
+
+// ComposePort is a port in the short ("8080:80") or the long syntax, in the
+// format of ToolConfig.Ports.
+type ComposePort string
+
+// UnmarshalYAML accepts both the short and the long port syntax.
+func (p *ComposePort) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = ComposePort(value.Value)
+		return nil
+	}
+	var long struct {
+		Target    string `yaml:"target"`
+		Published string `yaml:"published"`
+		HostIP    string `yaml:"host_ip"`
+		Protocol  string `yaml:"protocol"`
+	}
+	if err := value.Decode(&long); err != nil {
+		return err
+	}
+	s := long.Target
+	if long.Published != "" {
+		s = long.Published + ":" + s
+	}
+	if long.HostIP != "" {
+		s = long.HostIP + ":" + s
+	}
+	if long.Protocol != "" {
+		s += "/" + long.Protocol
+	}
+	*p = ComposePort(s)
+	return nil
+}
+
+// composeMapping is a list of KEY=VALUE or a mapping, as used by environment
+// and build args. A nil value takes the value from the host environment.
+type composeMapping map[string]*string
+
+// UnmarshalYAML accepts both `[KEY=VALUE, KEY]` and `{KEY: VALUE, KEY: }`.
+func (m *composeMapping) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		*m = make(composeMapping, len(list))
+		for _, item := range list {
+			k, v, ok := strings.Cut(item, "=")
+			if ok {
+				(*m)[k] = &v
+			} else {
+				(*m)[k] = nil
+			}
+		}
+		return nil
+	}
+	var mapping map[string]*string
+	if err := value.Decode(&mapping); err != nil {
+		return err
+	}
+	*m = mapping
+	return nil
+}
+
+// resolve returns the values with nil ones taken from the host environment.
+// Unset variables are left out, like in Compose.
+func (m composeMapping) resolve() map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if v != nil {
+			out[k] = *v
+		} else if env, ok := os.LookupEnv(k); ok {
+			out[k] = env
+		}
+	}
+	return out
+}
+
+// importEntries returns the entries for the tools file in key order. Entries
+// taken from the host, KEY and KEY=${KEY}, stay bare names that are resolved
+// when the tool runs. Other values are written as they are, uninterpolated.
+func (m composeMapping) importEntries(service string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var entries []string
+	for _, k := range keys {
+		v := m[k]
+		switch {
+		case v == nil || *v == "$"+k || *v == "${"+k+"}":
+			entries = append(entries, k)
+		case strings.Contains(strings.ReplaceAll(*v, "$$", ""), "$"):
+			logging.Warn("compose: %s of service %s is not interpolated, so host values are not written to the tools file", k, service)
+			entries = append(entries, k+"="+*v)
+		default:
+			entries = append(entries, k+"="+strings.ReplaceAll(*v, "$$", "$"))
+		}
+	}
+	return entries
+}
+
+// withoutHostValues returns the values, leaving out the ones that would be
+// taken from the host environment.
+func (m composeMapping) withoutHostValues(service string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if v == nil {
+			logging.Warn("compose: skipping build arg %s of service %s, it would be taken from the host", k, service)
+			continue
+		}
+		out[k] = *v
+	}
+	return out
+}
+
+// FindCompose returns the first Compose file found in dir, or an empty string
+// if there is none.
+func FindCompose(dir string) (string, error) {
+	for _, name := range ComposePaths {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fmt.Errorf("stat compose file %s: %w", p, err)
+		}
+		return p, nil
+	}
+	return "", nil
+}
+
+// LoadCompose reads a Compose file and interpolates variables like Compose:
+// from the environment, then from the .env file of the project directory.
+func LoadCompose(file string) (*ComposeFile, error) {
+	return loadCompose(file, false)
+}
+
+// LoadComposeForImport reads a Compose file for writing its services to the
+// tools file. The environment of the services is not interpolated, and entries
+// taken from the host stay bare names that are resolved when the tool runs, so
+// no host or .env values are written to the tools file.
+func LoadComposeForImport(file string) (*ComposeFile, error) {
+	return loadCompose(file, true)
+}
+
+func loadCompose(file string, forImport bool) (*ComposeFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file %s: %w", file, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve compose directory: %w", err)
+	}
+	dotenv, err := loadDotenv(filepath.Join(dir, ".env"))
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := dotenv[name]
+		return v, ok
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal compose file %s: %w", file, err)
+	}
+	seen := map[*yaml.Node]bool{}
+	if forImport {
+		// Marking the nodes as seen skips their interpolation
+		for _, n := range environmentNodes(&doc) {
+			seen[n] = true
+		}
+	}
+	if err := interpolateNode(&doc, lookup, seen); err != nil {
+		return nil, fmt.Errorf("compose file %s: %w", file, err)
+	}
+	cfg := &ComposeFile{dir: dir, forImport: forImport}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal compose file %s: %w", file, err)
+	}
+
+	// Same precedence as Compose without -p
+	cfg.project, _ = lookup("COMPOSE_PROJECT_NAME")
+	if cfg.project == "" {
+		cfg.project = cfg.Name
+	}
+	if cfg.project == "" {
+		cfg.project = filepath.Base(dir)
+	}
+	cfg.project = strings.TrimLeft(invalidProjectChars.ReplaceAllString(strings.ToLower(cfg.project), ""), "_-")
+	return cfg, nil
+}
+
+var invalidProjectChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// environmentNodes returns the environment sections of the services of a
+// Compose document.
+func environmentNodes(doc *yaml.Node) []*yaml.Node {
+	var nodes []*yaml.Node
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	services := mappingValue(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 1; i < len(services.Content); i += 2 {
+		if env := mappingValue(services.Content[i], "environment"); env != nil {
+			nodes = append(nodes, env)
+		}
+	}
+	return nodes
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ServiceNames returns the names of the services in alphabetical order.
+func (c *ComposeFile) ServiceNames() []string {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ToolConfig maps a service onto a tool. Paths on the host are absolute. The
+// tool joins the network of the service (prefixed with the project name like
+// Compose does) only if the service declares one, so the Compose project does
+// not have to be running. Settings that cannot be mapped are logged and skipped.
+func (c *ComposeFile) ToolConfig(service string) (ToolConfig, error) {
+	svc, ok := c.Services[service]
+	if !ok {
+		return ToolConfig{}, fmt.Errorf("service %s not found", service)
+	}
+
+	tool := ToolConfig{Image: svc.Image, Workdir: svc.WorkingDir, User: svc.User}
+	if svc.Build != nil {
+		if strings.Contains(svc.Build.Context, "://") || strings.HasPrefix(svc.Build.Context, "git@") {
+			return ToolConfig{}, fmt.Errorf("service %s: remote build contexts are not supported", service)
+		}
+		tool.Build = &BuildConfig{
+			Context:    c.path(svc.Build.Context),
+			Dockerfile: svc.Build.Dockerfile,
+			Target:     svc.Build.Target,
+		}
+		var args map[string]string
+		if c.forImport {
+			args = svc.Build.Args.withoutHostValues(service)
+		} else {
+			args = svc.Build.Args.resolve()
+		}
+		if len(args) > 0 {
+			tool.Build.Args = args
+		}
+	}
+	if tool.Image == "" && tool.Build == nil {
+		return ToolConfig{}, fmt.Errorf("service %s has neither image nor build", service)
+	}
+
+	for _, v := range svc.Volumes {
+		if v.Type != "bind" {
+			logging.Warn("compose: skipping %s volume %s of service %s, only bind mounts are supported", v.Type, v.Target, service)
+			continue
+		}
+		volume := c.path(v.Source) + ":" + v.Target
+		if v.ReadOnly {
+			volume += ":ro"
+		}
+		tool.Volumes = append(tool.Volumes, volume)
+	}
+
+	if c.forImport {
+		tool.Env = svc.Environment.importEntries(service)
+	} else {
+		env := svc.Environment.resolve()
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			tool.Env = append(tool.Env, k+"="+env[k])
+		}
+	}
+
+	for _, p := range svc.Ports {
+		tool.Ports = append(tool.Ports, string(p))
+	}
+
+	switch svc.ExtraHosts.Kind {
+	case yaml.SequenceNode:
+		for _, n := range svc.ExtraHosts.Content {
+			// Both "host:ip" and "host=ip" are accepted by Compose
+			host, ip, ok := strings.Cut(n.Value, "=")
+			if !ok {
+				host, ip, _ = strings.Cut(n.Value, ":")
+			}
+			tool.ExtraHosts = append(tool.ExtraHosts, host+":"+ip)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(svc.ExtraHosts.Content); i += 2 {
+			tool.ExtraHosts = append(tool.ExtraHosts, svc.ExtraHosts.Content[i].Value+":"+svc.ExtraHosts.Content[i+1].Value)
+		}
+	}
+
+	network, err := c.network(service, svc)
+	if err != nil {
+		return ToolConfig{}, err
+	}
+	tool.Network = network
+	return tool, nil
+}
+
+// network returns the network of a service: network_mode, or the first of its
+// networks with the name Compose gives it.
+func (c *ComposeFile) network(service string, svc ComposeService) (NetworkConfig, error) {
+	if svc.NetworkMode != "" {
+		if strings.Contains(svc.NetworkMode, ":") {
+			logging.Warn("compose: skipping network_mode %s of service %s", svc.NetworkMode, service)
+			return NetworkConfig{}, nil
+		}
+		return NetworkConfig{Name: svc.NetworkMode}, nil
+	}
+
+	var key string
+	var aliases []string
+	switch svc.Networks.Kind {
+	case 0:
+		return NetworkConfig{}, nil
+	case yaml.SequenceNode:
+		if len(svc.Networks.Content) > 0 {
+			key = svc.Networks.Content[0].Value
+		}
+	case yaml.MappingNode:
+		if len(svc.Networks.Content) >= 2 {
+			key = svc.Networks.Content[0].Value
+			var opts struct {
+				Aliases []string `yaml:"aliases"`
+			}
+			if err := svc.Networks.Content[1].Decode(&opts); err != nil {
+				return NetworkConfig{}, fmt.Errorf("service %s: invalid networks: %w", service, err)
+			}
+			aliases = opts.Aliases
+		}
+	}
+	if key == "" {
+		return NetworkConfig{}, nil
+	}
+	if len(svc.Networks.Content) > 2 || (svc.Networks.Kind == yaml.SequenceNode && len(svc.Networks.Content) > 1) {
+		logging.Warn("compose: service %s has several networks, only joining %s", service, key)
+	}
+
+	name := c.project + "_" + key
+	if n := c.Networks[key]; n != nil {
+		switch {
+		case n.Name != "":
+			name = n.Name
+		case n.External:
+			name = key
+		}
+	}
+	return NetworkConfig{Name: name, Aliases: aliases}, nil
+}
+
+// path resolves a path of the Compose file against the project directory.
+func (c *ComposeFile) path(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.dir, p)
+}
+
+// ParseComposeRef splits a reference like "compose.yaml#app" into the file and
+// the service.
+func ParseComposeRef(ref string) (string, string, error) {
+	file, service, ok := strings.Cut(ref, "#")
+	if !ok || file == "" || service == "" {
+		return "", "", fmt.Errorf("invalid compose reference %q: must be FILE#SERVICE", ref)
+	}
+	return file, service, nil
+}
+
+// resolveComposeTool returns the tool for the compose reference of tool, with
+// the settings of tool itself taking precedence. Relative files are resolved
+// against dir.
+func resolveComposeTool(dir string, tool ToolConfig) (ToolConfig, error) {
+	file, service, err := ParseComposeRef(tool.Compose)
+	if err != nil {
+		return ToolConfig{}, err
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	compose, err := LoadCompose(file)
+	if err != nil {
+		return ToolConfig{}, err
+	}
+	base, err := compose.ToolConfig(service)
+	if err != nil {
+		return ToolConfig{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	// Every field set in the tools file replaces the one from the service. The
+	// image and the build are one setting: an image in the tools file is used
+	// as is instead of building the service, and a build in the tools file
+	// replaces the image of the service.
+	merged := tool
+	if tool.Image == "" && tool.Build == nil {
+		merged.Image, merged.Build = base.Image, base.Build
+	}
+	if merged.Workdir == "" {
+		merged.Workdir = base.Workdir
+	}
+	if merged.User == "" {
+		merged.User = base.User
+	}
+	if merged.Volumes == nil {
+		merged.Volumes = base.Volumes
+	}
+	if merged.Env == nil {
+		merged.Env = base.Env
+	}
+	if merged.Ports == nil {
+		merged.Ports = base.Ports
+	}
+	if merged.ExtraHosts == nil {
+		merged.ExtraHosts = base.ExtraHosts
+	}
+	if merged.Network.Name == "" {
+		merged.Network = base.Network
+	}
+	return merged, nil
+}
+
+// loadDotenv reads KEY=VALUE lines from a .env file. A missing file is empty.
+func loadDotenv(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	defer f.Close()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[strings.TrimSpace(k)] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return env, nil
+}
+
+// interpolateNode interpolates the values (not the keys) of a YAML tree. Nodes
+// shared through anchors are only interpolated once.
+func interpolateNode(n *yaml.Node, lookup func(string) (string, bool), seen map[*yaml.Node]bool) error {
+	if seen[n] {
+		return nil
+	}
+	seen[n] = true
+	switch n.Kind {
+	case yaml.ScalarNode:
+		v, err := interpolate(n.Value, lookup)
+		if err != nil {
+			return err
+		}
+		n.Value = v
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := interpolateNode(n.Content[i], lookup, seen); err != nil {
+				return err
+			}
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := interpolateNode(c, lookup, seen); err != nil {
+				return err
+			}
+		}
+	case yaml.AliasNode:
+		return interpolateNode(n.Alias, lookup, seen)
+	}
+	return nil
+}
+
+// interpolate expands $VAR and ${VAR} with the modifiers of Compose:
+// ${VAR:-default}, ${VAR-default}, ${VAR:?error}, ${VAR?error},
+// ${VAR:+replacement} and ${VAR+replacement}. "$$" is a literal "$".
+func interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			sb.WriteByte('$')
+			i++
+		case next == '{':
+			// Find the closing brace, allowing nested ${...} in defaults
+			depth, end := 0, -1
+			for j := i + 1; j < len(s) && end < 0; j++ {
+				switch s[j] {
+				case '{':
+					depth++
+				case '}':
+					if depth--; depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end < 0 {
+				return "", fmt.Errorf("invalid interpolation format for %q", s)
+			}
+			v, err := expandBraced(s[i+2:end], lookup)
+			if err != nil {
+				return "", fmt.Errorf("%w in %q", err, s)
+			}
+			sb.WriteString(v)
+			i = end
+		case next == '_' || next >= 'a' && next <= 'z' || next >= 'A' && next <= 'Z':
+			j := i + 1
+			for j < len(s) && isVarChar(s[j]) {
+				j++
+			}
+			v, _ := lookup(s[i+1 : j])
+			sb.WriteString(v)
+			i = j - 1
+		default:
+			sb.WriteByte('$')
+		}
+	}
+	return sb.String(), nil
+}
+
+func isVarChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// expandBraced expands the inside of ${...}.
+func expandBraced(expr string, lookup func(string) (string, bool)) (string, error) {
+	n := 0
+	for n < len(expr) && isVarChar(expr[n]) {
+		n++
+	}
+	name, op := expr[:n], expr[n:]
+	if name == "" {
+		return "", fmt.Errorf("invalid interpolation format")
+	}
+	value, set := lookup(name)
+	if op == "" {
+		return value, nil
+	}
+
+	for _, modifier := range []string{":-", ":?", ":+", "-", "?", "+"} {
+		arg, ok := strings.CutPrefix(op, modifier)
+		if !ok {
+			continue
+		}
+		// With a colon, an empty value counts as unset
+		present := set
+		if strings.HasPrefix(modifier, ":") {
+			present = set && value != ""
+		}
+		switch modifier[len(modifier)-1] {
+		case '-':
+			if present {
+				return value, nil
+			}
+			return interpolate(arg, lookup)
+		case '?':
+			if present {
+				return value, nil
+			}
+			msg, err := interpolate(arg, lookup)
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("required variable %s is missing a value: %s", name, msg)
+		case '+':
+			if present {
+				return interpolate(arg, lookup)
+			}
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("invalid interpolation format")
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"TAG": "1.2", "EMPTY": "", "NAME": "app"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	cases := []struct {
+		in, out string
+	}{
+		{"node:${TAG}", "node:1.2"},
+		{"node:$TAG", "node:1.2"},
+		{"$NAME-$TAG.log", "app-1.2.log"},
+		{"${UNSET}", ""},
+		{"${UNSET:-20}", "20"},
+		{"${EMPTY:-20}", "20"},
+		{"${EMPTY-20}", ""},
+		{"${UNSET-20}", "20"},
+		{"${TAG:+set}", "set"},
+		{"${EMPTY:+set}", ""},
+		{"${EMPTY+set}", "set"},
+		{"${UNSET+set}", ""},
+		{"${UNSET:-${NAME}-${TAG}}", "app-1.2"},
+		{"$$HOME and $$$TAG", "$HOME and $1.2"},
+		{"cost: 5$", "cost: 5$"},
+		{"${TAG:?must be set}", "1.2"},
+	}
+	for _, c := range cases {
+		out, err := interpolate(c.in, lookup)
+		require.NoError(t, err, c.in)
+		assert.Equal(t, c.out, out, c.in)
+	}
+
+	_, err := interpolate("${UNSET:?set it in .env}", lookup)
+	assert.ErrorContains(t, err, "required variable UNSET is missing a value: set it in .env")
+	_, err = interpolate("${EMPTY?x}", lookup)
+	assert.NoError(t, err)
+	for _, in := range []string{"${TAG", "${}", "${TAG!}"} {
+		_, err = interpolate(in, lookup)
+		assert.ErrorContains(t, err, "invalid interpolation format", in)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My Project")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("# defaults\nNODE_VERSION=20\nexport PORT='3000'\nDB_NAME=dev\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(`
+x-env: &env
+  LOG_LEVEL: debug
+services:
+  web:
+    image: node:${NODE_VERSION}
+    working_dir: /app
+    user: "1000:1000"
+    environment:
+      <<: *env
+      DB_URL: postgres://db/${DB_NAME}
+      PRICE: $$5
+      CDERUN_TEST_HOST_VALUE:
+    volumes:
+      - .:/app
+      - ./config:/app/config:ro
+      - node_modules:/app/node_modules
+      - type: bind
+        source: ~/.npmrc
+        target: /root/.npmrc
+        read_only: true
+    ports:
+      - "${PORT}:3000"
+      - target: 9229
+        published: "9229"
+        host_ip: 127.0.0.1
+    extra_hosts:
+      - "api.local:10.0.0.1"
+      - "auth.local=10.0.0.2"
+    networks:
+      backend:
+        aliases: [www]
+  builder:
+    build:
+      context: ./docker
+      dockerfile: Dockerfile.ci
+      args:
+        - GO_VERSION=1.24
+      target: ci
+    network_mode: host
+  shared:
+    image: alpine
+    networks: [external-net]
+networks:
+  backend: {}
+  external-net:
+    external: true
+`), 0644))
+	t.Setenv("CDERUN_TEST_HOST_VALUE", "from-host")
+	t.Setenv("DB_NAME", "test") // The environment takes precedence over .env
+
+	compose, err := LoadCompose(filepath.Join(dir, "compose.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"builder", "shared", "web"}, compose.ServiceNames())
+
+	web, err := compose.ToolConfig("web")
+	require.NoError(t, err)
+	home, _ := os.UserHomeDir()
+	assert.Equal(t, ToolConfig{
+		Image:   "node:20",
+		Workdir: "/app",
+		User:    "1000:1000",
+		Env: []string{
+			"CDERUN_TEST_HOST_VALUE=from-host",
+			"DB_URL=postgres://db/test",
+			"LOG_LEVEL=debug",
+			"PRICE=$5",
+		},
+		Volumes: []string{
+			dir + ":/app",
+			filepath.Join(dir, "config") + ":/app/config:ro",
+			filepath.Join(home, ".npmrc") + ":/root/.npmrc:ro",
+		},
+		Ports:      []string{"3000:3000", "127.0.0.1:9229:9229"},
+		ExtraHosts: []string{"api.local:10.0.0.1", "auth.local:10.0.0.2"},
+		Network:    NetworkConfig{Name: "myproject_backend", Aliases: []string{"www"}},
+	}, web)
+
+	builder, err := compose.ToolConfig("builder")
+	require.NoError(t, err)
+	assert.Equal(t, &BuildConfig{
+		Context:    filepath.Join(dir, "docker"),
+		Dockerfile: "Dockerfile.ci",
+		Args:       map[string]string{"GO_VERSION": "1.24"},
+		Target:     "ci",
+	}, builder.Build)
+	assert.Equal(t, "host", builder.Network.Name)
+
+	shared, err := compose.ToolConfig("shared")
+	require.NoError(t, err)
+	assert.Equal(t, "external-net", shared.Network.Name)
+
+	_, err = compose.ToolConfig("db")
+	assert.ErrorContains(t, err, "service db not found")
+
+	t.Run("import keeps host values out", func(t *testing.T) {
+		compose, err := LoadComposeForImport(filepath.Join(dir, "compose.yaml"))
+		require.NoError(t, err)
+		web, err := compose.ToolConfig("web")
+		require.NoError(t, err)
+		assert.Equal(t, "node:20", web.Image)
+		assert.Equal(t, []string{
+			"CDERUN_TEST_HOST_VALUE",
+			"DB_URL=postgres://db/${DB_NAME}",
+			"LOG_LEVEL=debug",
+			"PRICE=$5",
+		}, web.Env)
+	})
+
+	t.Run("project name", func(t *testing.T) {
+		t.Setenv("COMPOSE_PROJECT_NAME", "ci")
+		compose, err := LoadCompose(filepath.Join(dir, "compose.yaml"))
+		require.NoError(t, err)
+		web, err := compose.ToolConfig("web")
+		require.NoError(t, err)
+		assert.Equal(t, "ci_backend", web.Network.Name)
+	})
+
+	t.Run("required variable", func(t *testing.T) {
+		file := filepath.Join(dir, "required.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("services:\n  app:\n    image: ${IMAGE:?IMAGE is required}\n"), 0644))
+		_, err := LoadCompose(file)
+		assert.ErrorContains(t, err, "required variable IMAGE is missing a value")
+	})
+}
+
+func TestToolsConfigCompose(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "deploy"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "deploy", "compose.yaml"), []byte(`
+services:
+  app:
+    image: python:3.12
+    working_dir: /src
+    volumes: [..:/src]
+    environment: [DEBUG=1]
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".tools.yaml"), []byte(`
+python:
+  compose: deploy/compose.yaml#app
+  env: [DEBUG=0]
+broken:
+  compose: deploy/compose.yaml
+`), 0644))
+
+	oldWd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(oldWd) })
+
+	_, _, err := LoadToolsConfig()
+	assert.ErrorContains(t, err, `tool broken: invalid compose reference "deploy/compose.yaml"`)
+
+	require.NoError(t, os.WriteFile(".tools.yaml", []byte("python:\n  compose: deploy/compose.yaml#app\n  env: [DEBUG=0]\n"), 0644))
+	tools, _, err := LoadToolsConfig()
+	require.NoError(t, err)
+	python := tools["python"]
+	assert.Equal(t, "python:3.12", python.Image)
+	assert.Equal(t, "/src", python.Workdir)
+	assert.Equal(t, []string{dir + ":/src"}, python.Volumes, "paths are relative to the compose file")
+	assert.Equal(t, []string{"DEBUG=0"}, python.Env, "the tools file takes precedence")
+
+	t.Run("image and build", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "deploy", "compose.yaml"), []byte(`
+services:
+  built:
+    build: .
+    working_dir: /src
+  pulled:
+    image: node:20
+`), 0644))
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte(`
+fromService:
+  compose: deploy/compose.yaml#built
+withImage:
+  compose: deploy/compose.yaml#built
+  image: node:22
+withBuild:
+  compose: deploy/compose.yaml#pulled
+  build: ./tools
+`), 0644))
+		tools, _, err := LoadToolsConfig()
+		require.NoError(t, err)
+
+		assert.Empty(t, tools["fromService"].Image)
+		require.NotNil(t, tools["fromService"].Build)
+		assert.Equal(t, filepath.Join(dir, "deploy"), tools["fromService"].Build.Context)
+
+		assert.Equal(t, "node:22", tools["withImage"].Image)
+		assert.Nil(t, tools["withImage"].Build, "the image of the tool is not built")
+		assert.Equal(t, "/src", tools["withImage"].Workdir)
+
+		assert.Empty(t, tools["withBuild"].Image, "the build of the tool is not tagged as the service image")
+		require.NotNil(t, tools["withBuild"].Build)
+		assert.Equal(t, "tools", tools["withBuild"].Build.Context, "relative to the tools file")
+	})
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,16 +20,26 @@ type CDERunConfig struct {
 	RuntimePath string         `yaml:"runtimePath"`
 	Defaults    ConfigDefaults `yaml:"defaults"`
 	Logging     LoggingConfig  `yaml:"logging"`
+	ReapOrphans *bool          `yaml:"reapOrphans"`
 }
 
 type ConfigDefaults struct {
-	TTY          *bool  `yaml:"tty"`
-	Interactive  *bool  `yaml:"interactive"`
-	Network      string `yaml:"network"`
-	Remove       *bool  `yaml:"remove"`
-	MountCderun  *bool  `yaml:"mountCderun"`
-	DryRun       *bool  `yaml:"dryRun"`
-	DryRunFormat string `yaml:"dryRunFormat"`
+	TTY              BoolOrAuto    `yaml:"tty"`
+	Interactive      BoolOrAuto    `yaml:"interactive"`
+	Network          string        `yaml:"network"`
+	Remove           *bool         `yaml:"remove"`
+	MountCderun      *bool         `yaml:"mountCderun"`
+	DryRun           *bool         `yaml:"dryRun"`
+	DryRunFormat     string        `yaml:"dryRunFormat"`
+	ForwardSSHAgent  *bool         `yaml:"forwardSSHAgent"`
+	ForwardGitConfig *bool         `yaml:"forwardGitConfig"`
+	AutoStdin        *bool         `yaml:"autoStdin"`
+	DetachKeys       string        `yaml:"detachKeys"`
+	DrainTimeout     string        `yaml:"drainTimeout"`
+	SplitStreams     *bool         `yaml:"splitStreams"`
+	OutputLog        string        `yaml:"outputLog"`
+	OutputLogFormat  string        `yaml:"outputLogFormat"`
+	Capture          CaptureConfig `yaml:"capture"`
 }
 
 type LoggingConfig struct {
@@ -42,17 +59,206 @@ type LoggingRotationConfig struct {
 }
 
 type ToolConfig struct {
-	Image       string   `yaml:"image"`
-	TTY         *bool    `yaml:"tty"`
-	Interactive *bool    `yaml:"interactive"`
-	Network     string   `yaml:"network"`
-	Remove      *bool    `yaml:"remove"`
-	Volumes     []string `yaml:"volumes"`
-	Env         []string `yaml:"env"`
-	Workdir     string   `yaml:"workdir"`
-	MountCderun *bool    `yaml:"mountCderun"`
-	DryRun      *bool    `yaml:"dryRun"`
-	DryRunFormat string   `yaml:"dryRunFormat"`
+	Image            string                   `yaml:"image,omitempty"`
+	Build            *BuildConfig             `yaml:"build,omitempty"`
+	Compose          string                   `yaml:"compose,omitempty"` // FILE#SERVICE the other settings are based on
+	Packages         []string                 `yaml:"packages,omitempty"`
+	PackageManager   string                   `yaml:"packageManager,omitempty"`
+	TTY              BoolOrAuto               `yaml:"tty,omitempty"`
+	Interactive      BoolOrAuto               `yaml:"interactive,omitempty"`
+	Network          NetworkConfig            `yaml:"network,omitempty"`
+	Remove           *bool                    `yaml:"remove,omitempty"`
+	Volumes          []string                 `yaml:"volumes,omitempty"`
+	Env              []string                 `yaml:"env,omitempty"`
+	Workdir          string                   `yaml:"workdir,omitempty"`
+	User             string                   `yaml:"user,omitempty"`
+	MountCderun      *bool                    `yaml:"mountCderun,omitempty"`
+	DryRun           *bool                    `yaml:"dryRun,omitempty"`
+	DryRunFormat     string                   `yaml:"dryRunFormat,omitempty"`
+	Secrets          []SecretConfig           `yaml:"secrets,omitempty"`
+	ForwardSSHAgent  *bool                    `yaml:"forwardSSHAgent,omitempty"`
+	ForwardGitConfig *bool                    `yaml:"forwardGitConfig,omitempty"`
+	Ports            []string                 `yaml:"ports,omitempty"`
+	PublishAll       *bool                    `yaml:"publishAll,omitempty"`
+	ExtraHosts       []string                 `yaml:"extraHosts,omitempty"`
+	Services         map[string]ServiceConfig `yaml:"services,omitempty"`
+	ServicesLogs     *bool                    `yaml:"servicesLogs,omitempty"`
+	KeepAlive        *bool                    `yaml:"keepAlive,omitempty"`
+	IdleTimeout      string                   `yaml:"idleTimeout,omitempty"`
+	KeepAliveCommand []string                 `yaml:"keepAliveCommand,omitempty"`
+	ForwardSignals   []string                 `yaml:"forwardSignals,omitempty"`
+	StopSignal       string                   `yaml:"stopSignal,omitempty"`
+	StopTimeout      string                   `yaml:"stopTimeout,omitempty"`
+	AutoStdin        *bool                    `yaml:"autoStdin,omitempty"`
+	DetachKeys       string                   `yaml:"detachKeys,omitempty"`
+	DrainTimeout     string                   `yaml:"drainTimeout,omitempty"`
+	SplitStreams     *bool                    `yaml:"splitStreams,omitempty"`
+	OutputLog        string                   `yaml:"outputLog,omitempty"`
+	OutputLogFormat  string                   `yaml:"outputLogFormat,omitempty"`
+	Capture          CaptureConfig            `yaml:"capture,omitempty"`
+	Completion       string                   `yaml:"completion,omitempty"` // files (default), none or cobra
+}
+
+// SecretConfig describes a secret that is mounted into the container as a file.
+// Exactly one of File, Env or Command must be set.
+type SecretConfig struct {
+	Name    string `yaml:"name"`
+	File    string `yaml:"file"`
+	Env     string `yaml:"env"`
+	Command string `yaml:"command"`
+	Target  string `yaml:"target"`
+}
+
+// CaptureConfig names files that receive a copy of the tool's stdout and stderr.
+type CaptureConfig struct {
+	Stdout string `yaml:"stdout"`
+	Stderr string `yaml:"stderr"`
+}
+
+// BuildConfig describes how to build the image of a tool from a Dockerfile.
+// In YAML it can be written either as the context directory or as a mapping.
+type BuildConfig struct {
+	Context    string            `yaml:"context,omitempty"`
+	Dockerfile string            `yaml:"dockerfile,omitempty"`
+	Args       map[string]string `yaml:"args,omitempty"`
+	Target     string            `yaml:"target,omitempty"`
+}
+
+// UnmarshalYAML accepts both `build: ./tools/lint` and `build: {context: ., target: lint}`.
+func (b *BuildConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*b = BuildConfig{Context: value.Value}
+		return nil
+	}
+	type plain BuildConfig
+	return value.Decode((*plain)(b))
+}
+
+// MarshalYAML writes the short form when only the context is set.
+func (b BuildConfig) MarshalYAML() (interface{}, error) {
+	if b.Dockerfile == "" && len(b.Args) == 0 && b.Target == "" {
+		return b.Context, nil
+	}
+	type plain BuildConfig
+	return plain(b), nil
+}
+
+// NetworkConfig describes the network a tool joins. In YAML it can be written
+// either as a plain network name or as a mapping with lifecycle options.
+type NetworkConfig struct {
+	Name     string   `yaml:"name,omitempty"`
+	Create   bool     `yaml:"create,omitempty"`
+	Internal bool     `yaml:"internal,omitempty"`
+	Remove   bool     `yaml:"remove,omitempty"`
+	Aliases  []string `yaml:"aliases,omitempty"`
+}
+
+// UnmarshalYAML accepts both `network: host` and `network: {name: proj-net, create: true}`.
+func (n *NetworkConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*n = NetworkConfig{Name: value.Value}
+		return nil
+	}
+	type plain NetworkConfig
+	return value.Decode((*plain)(n))
+}
+
+// MarshalYAML writes the short form when only the name is set.
+func (n NetworkConfig) MarshalYAML() (interface{}, error) {
+	if !n.Create && !n.Internal && !n.Remove && len(n.Aliases) == 0 {
+		return n.Name, nil
+	}
+	type plain NetworkConfig
+	return plain(n), nil
+}
+
+// BoolOrAuto is a boolean setting that can also be "auto", meaning it is decided
+// at run time (e.g. from whether stdin is a terminal). The zero value means unset.
+type BoolOrAuto string
+
+const (
+	BoolTrue  BoolOrAuto = "true"
+	BoolFalse BoolOrAuto = "false"
+	BoolAuto  BoolOrAuto = "auto"
+)
+
+// ParseBoolOrAuto accepts "auto", every value accepted by strconv.ParseBool and,
+// like YAML booleans, yes/no and on/off.
+func ParseBoolOrAuto(s string) (BoolOrAuto, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return BoolAuto, nil
+	case "yes", "on":
+		return BoolTrue, nil
+	case "no", "off":
+		return BoolFalse, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q: must be true, false or auto", s)
+	}
+	if b {
+		return BoolTrue, nil
+	}
+	return BoolFalse, nil
+}
+
+// IsAuto reports whether the value is decided at run time.
+func (b BoolOrAuto) IsAuto() bool {
+	return b == BoolAuto
+}
+
+// Bool reports whether the value is true. "auto" and unset are false.
+func (b BoolOrAuto) Bool() bool {
+	return b == BoolTrue
+}
+
+// UnmarshalYAML accepts both `tty: true` and `tty: auto`.
+func (b *BoolOrAuto) UnmarshalYAML(value *yaml.Node) error {
+	v, err := ParseBoolOrAuto(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// ServiceConfig describes a sidecar container that is started next to the tool,
+// e.g. a database for integration tests. The service is reachable by its name.
+type ServiceConfig struct {
+	Image       string             `yaml:"image"`
+	Command     []string           `yaml:"command"`
+	Env         []string           `yaml:"env"`
+	Ports       []string           `yaml:"ports"`
+	Healthcheck *HealthcheckConfig `yaml:"healthcheck"`
+}
+
+// HealthcheckConfig mirrors the Docker/Compose healthcheck options.
+// Durations use Go syntax (e.g. "2s", "1m").
+type HealthcheckConfig struct {
+	Test        HealthcheckTest `yaml:"test"`
+	Interval    string          `yaml:"interval"`
+	Timeout     string          `yaml:"timeout"`
+	Retries     int             `yaml:"retries"`
+	StartPeriod string          `yaml:"startPeriod"`
+}
+
+// HealthcheckTest is the healthcheck command. A plain string is run through the
+// container's shell (CMD-SHELL); a list is used as in Docker (["CMD", "pg_isready"]).
+type HealthcheckTest []string
+
+// UnmarshalYAML accepts both `test: pg_isready` and `test: [CMD, pg_isready]`.
+func (h *HealthcheckTest) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = HealthcheckTest{"CMD-SHELL", value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*h = list
+	return nil
 }
 
 type ToolsConfig map[string]ToolConfig
@@ -89,7 +295,27 @@ func LoadCDERunConfig() (*CDERunConfig, string, error) {
 }
 
 // LoadToolsConfig searches for .tools.yaml in predefined locations and loads the first one found.
+// CDERUN_TOOLS_FILE overrides the search, e.g. for the shims of shell-hook that
+// run in any subdirectory of a project. If CDERUN_TOOLS_DIGEST is set too, the
+// file is only loaded if its ToolsFileDigest still matches.
 func LoadToolsConfig() (ToolsConfig, string, error) {
+	if path := os.Getenv("CDERUN_TOOLS_FILE"); path != "" {
+		if digest := os.Getenv("CDERUN_TOOLS_DIGEST"); digest != "" {
+			current, err := ToolsFileDigest(path)
+			if err != nil {
+				return nil, "", err
+			}
+			if current != digest {
+				return nil, "", fmt.Errorf("tools file %s has changed since it was allowed: review it and run \"cderun shell-hook allow\" in %s", path, filepath.Dir(path))
+			}
+		}
+		cfg, err := LoadToolsFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return cfg, path, nil
+	}
+
 	paths := []string{
 		".tools.yaml",
 	}
@@ -105,16 +331,182 @@ func LoadToolsConfig() (ToolsConfig, string, error) {
 			}
 			return nil, "", fmt.Errorf("stat tools file %s: %w", path, err)
 		}
-
-		data, err := os.ReadFile(path)
+		cfg, err := LoadToolsFile(path)
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to read tools file %s: %w", path, err)
-		}
-		var cfg ToolsConfig
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			return nil, "", fmt.Errorf("failed to unmarshal tools file %s: %w", path, err)
+			return nil, "", err
 		}
 		return cfg, path, nil
 	}
 	return nil, "", nil
 }
+
+// LoadToolsFile loads the tools file at path.
+func LoadToolsFile(path string) (ToolsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tools file %s: %w", path, err)
+	}
+	var cfg ToolsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tools file %s: %w", path, err)
+	}
+	for name, tool := range cfg {
+		if tool.Compose != "" {
+			resolved, err := resolveComposeTool(filepath.Dir(path), tool)
+			if err != nil {
+				return nil, fmt.Errorf("tool %s: %w", name, err)
+			}
+			cfg[name] = resolved
+		}
+	}
+	// Build contexts and volumes like "./src:/src" are relative to the tools
+	// file, not the working directory. Bind mounts need an absolute path.
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tools file %s: %w", path, err)
+	}
+	for _, tool := range cfg {
+		if tool.Build != nil && !filepath.IsAbs(tool.Build.Context) {
+			tool.Build.Context = filepath.Join(filepath.Dir(path), tool.Build.Context)
+		}
+		for i, v := range tool.Volumes {
+			host, rest, ok := strings.Cut(v, ":")
+			if ok && (host == "." || host == ".." || strings.HasPrefix(host, "./") || strings.HasPrefix(host, "../")) {
+				tool.Volumes[i] = filepath.Join(dir, host) + ":" + rest
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// ToolsFileDigest returns a hash of the absolute path and content of the tools
+// file at path and of the Compose files (with their .env) its tools are based
+// on, so any change to the settings of the tools changes the digest.
+func ToolsFileDigest(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tools file %s: %w", path, err)
+	}
+	var tools map[string]struct {
+		Compose string `yaml:"compose"`
+	}
+	if err := yaml.Unmarshal(data, &tools); err != nil {
+		return "", fmt.Errorf("failed to unmarshal tools file %s: %w", path, err)
+	}
+
+	files := []string{path}
+	seen := map[string]bool{}
+	for _, tool := range tools {
+		file, _, err := ParseComposeRef(tool.Compose)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file, filepath.Join(filepath.Dir(file), ".env"))
+		}
+	}
+	sort.Strings(files[1:])
+
+	h := sha256.New()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		// Lengths keep the boundaries between files unambiguous
+		fmt.Fprintf(h, "%d:%s%d:%t:", len(file), file, len(content), err == nil)
+		h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FindToolsFile returns the .tools.yaml in dir or the nearest parent directory,
+// or "" if there is none.
+func FindToolsFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ".tools.yaml")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("stat tools file %s: %w", path, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// ErrToolExists is returned by WriteTools when a tool is already defined.
+var ErrToolExists = errors.New("already exists")
+
+// WriteTools adds tools to the tools file at path in alphabetical order,
+// creating the file if needed. Comments and the other tools in the file are
+// kept. Existing tools with the same names are only replaced when replace is
+// true; otherwise the file is left unchanged.
+func WriteTools(path string, tools ToolsConfig, replace bool) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read tools file %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to unmarshal tools file %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("tools file %s is not a mapping of tool names", path)
+	}
+
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var value yaml.Node
+		if err := value.Encode(tools[name]); err != nil {
+			return fmt.Errorf("failed to marshal tool %s: %w", name, err)
+		}
+		replaced := false
+		for i := 0; i < len(root.Content); i += 2 {
+			if root.Content[i].Value == name {
+				if !replace {
+					return fmt.Errorf("tool %s %w in %s", name, ErrToolExists, path)
+				}
+				root.Content[i+1] = &value
+				replaced = true
+			}
+		}
+		if !replaced {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &value)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to marshal tools file %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write tools file %s: %w", path, err)
+	}
+	return nil
+}
@@ -43,7 +43,7 @@ defaults:
 		assert.NotNil(t, cfg)
 		assert.Equal(t, ".cderun.yaml", path)
 		assert.Equal(t, "docker", cfg.Runtime)
-		assert.True(t, *cfg.Defaults.TTY)
+		assert.Equal(t, BoolTrue, cfg.Defaults.TTY)
 	})
 
 	t.Run("found in home dir", func(t *testing.T) {
@@ -108,6 +108,210 @@ node:
 		tool, ok := cfg["node"]
 		assert.True(t, ok)
 		assert.Equal(t, "node:20-alpine", tool.Image)
-		assert.True(t, *tool.TTY)
+		assert.Equal(t, BoolTrue, tool.TTY)
 	})
+
+	t.Run("network as name or mapping", func(t *testing.T) {
+		content := `
+curl:
+  image: curlimages/curl
+  network: host
+pytest:
+  image: python:3
+  network:
+    name: proj-net
+    create: true
+    remove: true
+    aliases: [tests]
+  extraHosts:
+    - host.docker.internal:host-gateway
+`
+		err := os.WriteFile(".tools.yaml", []byte(content), 0644)
+		require.NoError(t, err)
+		defer os.Remove(".tools.yaml")
+
+		cfg, _, err := LoadToolsConfig()
+		require.NoError(t, err)
+		assert.Equal(t, NetworkConfig{Name: "host"}, cfg["curl"].Network)
+		assert.Equal(t, NetworkConfig{Name: "proj-net", Create: true, Remove: true, Aliases: []string{"tests"}}, cfg["pytest"].Network)
+		assert.Equal(t, []string{"host.docker.internal:host-gateway"}, cfg["pytest"].ExtraHosts)
+	})
+
+	t.Run("services with string or list healthcheck", func(t *testing.T) {
+		content := `
+pytest:
+  image: python:3
+  services:
+    db:
+      image: postgres:16
+      healthcheck:
+        test: pg_isready
+        retries: 5
+    cache:
+      image: redis:7
+      healthcheck:
+        test: [CMD, redis-cli, ping]
+`
+		err := os.WriteFile(".tools.yaml", []byte(content), 0644)
+		require.NoError(t, err)
+		defer os.Remove(".tools.yaml")
+
+		cfg, _, err := LoadToolsConfig()
+		require.NoError(t, err)
+		services := cfg["pytest"].Services
+		require.Len(t, services, 2)
+		assert.Equal(t, HealthcheckTest{"CMD-SHELL", "pg_isready"}, services["db"].Healthcheck.Test)
+		assert.Equal(t, 5, services["db"].Healthcheck.Retries)
+		assert.Equal(t, HealthcheckTest{"CMD", "redis-cli", "ping"}, services["cache"].Healthcheck.Test)
+	})
+
+	t.Run("tty and interactive as bool or auto", func(t *testing.T) {
+		content := `
+python:
+  image: python:3
+  tty: auto
+  interactive: yes
+jq:
+  image: jq
+  tty: false
+`
+		err := os.WriteFile(".tools.yaml", []byte(content), 0644)
+		require.NoError(t, err)
+		defer os.Remove(".tools.yaml")
+
+		cfg, _, err := LoadToolsConfig()
+		require.NoError(t, err)
+		assert.Equal(t, BoolAuto, cfg["python"].TTY)
+		assert.Equal(t, BoolTrue, cfg["python"].Interactive)
+		assert.Equal(t, BoolFalse, cfg["jq"].TTY)
+		assert.Equal(t, BoolOrAuto(""), cfg["jq"].Interactive)
+
+		err = os.WriteFile(".tools.yaml", []byte("python:\n  tty: sometimes\n"), 0644)
+		require.NoError(t, err)
+		_, _, err = LoadToolsConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("build as context or mapping", func(t *testing.T) {
+		content := `
+lint:
+  build: ./tools/lint
+test:
+  image: registry.local/test
+  build:
+    context: /srv/test
+    dockerfile: docker/Dockerfile.ci
+    args:
+      GO_VERSION: "1.22"
+    target: ci
+`
+		err := os.WriteFile(".tools.yaml", []byte(content), 0644)
+		require.NoError(t, err)
+		defer os.Remove(".tools.yaml")
+
+		cfg, _, err := LoadToolsConfig()
+		require.NoError(t, err)
+		assert.Equal(t, &BuildConfig{Context: filepath.Join("tools", "lint")}, cfg["lint"].Build)
+		assert.Equal(t, &BuildConfig{
+			Context:    "/srv/test",
+			Dockerfile: "docker/Dockerfile.ci",
+			Args:       map[string]string{"GO_VERSION": "1.22"},
+			Target:     "ci",
+		}, cfg["test"].Build)
+	})
+
+	t.Run("build context relative to the tools file", func(t *testing.T) {
+		homeDir := t.TempDir()
+		t.Setenv("HOME", homeDir)
+		t.Setenv("USERPROFILE", homeDir)
+		configDir := filepath.Join(homeDir, ".config", "cderun")
+		require.NoError(t, os.MkdirAll(configDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(configDir, "tools.yaml"), []byte("lint:\n  build: lint\n"), 0644))
+
+		cfg, _, err := LoadToolsConfig()
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(configDir, "lint"), cfg["lint"].Build.Context)
+	})
+
+	t.Run("CDERUN_TOOLS_FILE", func(t *testing.T) {
+		file := filepath.Join(tmpDir, "project", ".tools.yaml")
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, os.WriteFile(file, []byte("node:\n  image: node:22\n"), 0644))
+		require.NoError(t, os.WriteFile(".tools.yaml", []byte("node:\n  image: node:20\n"), 0644))
+		defer os.Remove(".tools.yaml")
+		t.Setenv("CDERUN_TOOLS_FILE", file)
+
+		cfg, path, err := LoadToolsConfig()
+		require.NoError(t, err)
+		assert.Equal(t, file, path)
+		assert.Equal(t, "node:22", cfg["node"].Image)
+
+		digest, err := ToolsFileDigest(file)
+		require.NoError(t, err)
+		t.Setenv("CDERUN_TOOLS_DIGEST", digest)
+		_, _, err = LoadToolsConfig()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(file, []byte("node:\n  image: node:22\n  mountSocket: true\n"), 0644))
+		_, _, err = LoadToolsConfig()
+		assert.ErrorContains(t, err, "has changed since it was allowed")
+		t.Setenv("CDERUN_TOOLS_DIGEST", "")
+
+		t.Setenv("CDERUN_TOOLS_FILE", filepath.Join(tmpDir, "missing.yaml"))
+		_, _, err = LoadToolsConfig()
+		assert.ErrorContains(t, err, "failed to read tools file")
+	})
+}
+
+func TestToolsFileDigest(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, ".tools.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("app:\n  compose: compose.yaml#app\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services:\n  app:\n    image: node\n"), 0644))
+
+	digest, err := ToolsFileDigest(file)
+	require.NoError(t, err)
+	assert.Len(t, digest, 64)
+	again, err := ToolsFileDigest(file)
+	require.NoError(t, err)
+	assert.Equal(t, digest, again)
+
+	// The Compose file and its .env are covered too
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("TAG=1\n"), 0644))
+	withEnv, err := ToolsFileDigest(file)
+	require.NoError(t, err)
+	assert.NotEqual(t, digest, withEnv)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services:\n  app:\n    image: node\n    privileged: true\n"), 0644))
+	changed, err := ToolsFileDigest(file)
+	require.NoError(t, err)
+	assert.NotEqual(t, withEnv, changed)
+
+	// The same content elsewhere is a different file
+	other := filepath.Join(t.TempDir(), ".tools.yaml")
+	require.NoError(t, os.WriteFile(other, []byte("app:\n  image: node\n"), 0644))
+	require.NoError(t, os.WriteFile(file, []byte("app:\n  image: node\n"), 0644))
+	a, err := ToolsFileDigest(file)
+	require.NoError(t, err)
+	b, err := ToolsFileDigest(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func TestFindToolsFile(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "src", "pkg")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+
+	found, err := FindToolsFile(sub)
+	require.NoError(t, err)
+	assert.NotContains(t, found, root, "a .tools.yaml above the temp dir may be found")
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".tools.yaml"), nil, 0644))
+	found, err = FindToolsFile(sub)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, ".tools.yaml"), found)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", ".tools.yaml"), nil, 0644))
+	found, err = FindToolsFile(sub)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "src", ".tools.yaml"), found, "the nearest file wins")
 }
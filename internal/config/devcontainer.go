@@ -0,0 +1,403 @@
+package config
+
+import (
+	"bytes"
+	"cderun/internal/logging"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DevcontainerPaths are the locations searched for devcontainer.json, relative
+// to the working directory.
+var DevcontainerPaths = []string{
+	filepath.Join(".devcontainer", "devcontainer.json"),
+	".devcontainer.json",
+}
+
+// DevcontainerConfig holds the parts of a devcontainer.json that cderun maps
+// onto a ToolConfig. See https://containers.dev/implementors/json_reference/.
+type DevcontainerConfig struct {
+	Name              string              `json:"name"`
+	Image             string              `json:"image"`
+	Build             *DevcontainerBuild  `json:"build"`
+	DockerFile        string              `json:"dockerFile"` // Deprecated form of build.dockerfile
+	Context           string              `json:"context"`    // Deprecated form of build.context
+	DockerComposeFile json.RawMessage     `json:"dockerComposeFile"`
+	Mounts            []DevcontainerMount `json:"mounts"`
+	WorkspaceMount    *DevcontainerMount  `json:"workspaceMount"`
+	WorkspaceFolder   string              `json:"workspaceFolder"`
+	ContainerEnv      map[string]string   `json:"containerEnv"`
+	RemoteUser        string              `json:"remoteUser"`
+	ContainerUser     string              `json:"containerUser"`
+	RunArgs           []string            `json:"runArgs"`
+	ForwardPorts      []json.RawMessage   `json:"forwardPorts"`
+
+	// dir is the directory of devcontainer.json, root the local workspace folder:
+	// the directory containing .devcontainer or .devcontainer.json.
+	dir  string
+	root string
+	// keepLocalEnv leaves ${localEnv:...} unexpanded, see ImportToolConfig
+	keepLocalEnv bool
+}
+
+type DevcontainerBuild struct {
+	Dockerfile string            `json:"dockerfile"`
+	Context    string            `json:"context"`
+	Args       map[string]string `json:"args"`
+	Target     string            `json:"target"`
+}
+
+// DevcontainerMount is a mount in either the string form used by "docker run
+// --mount" ("source=...,target=...,type=bind") or the object form.
+type DevcontainerMount struct {
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readonly"`
+}
+
+// UnmarshalJSON accepts both the string and the object form of a mount.
+func (m *DevcontainerMount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		type plain DevcontainerMount
+		return json.Unmarshal(data, (*plain)(m))
+	}
+	*m = DevcontainerMount{}
+	for _, field := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch strings.ToLower(key) {
+		case "type":
+			m.Type = value
+		case "source", "src":
+			m.Source = value
+		case "target", "destination", "dst":
+			m.Target = value
+		case "readonly", "ro":
+			m.ReadOnly = value == "" || value == "true" || value == "1"
+		}
+	}
+	return nil
+}
+
+// FindDevcontainer returns the first devcontainer.json found in
+// DevcontainerPaths, or an empty string if there is none.
+func FindDevcontainer() (string, error) {
+	for _, p := range DevcontainerPaths {
+		if _, err := os.Stat(p); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fmt.Errorf("stat devcontainer file %s: %w", p, err)
+		}
+		return p, nil
+	}
+	return "", nil
+}
+
+// LoadDevcontainer reads a devcontainer.json. Like VS Code, it accepts comments
+// and trailing commas.
+func LoadDevcontainer(file string) (*DevcontainerConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read devcontainer file %s: %w", file, err)
+	}
+	var cfg DevcontainerConfig
+	if err := json.Unmarshal(stripTrailingCommas(stripComments(data)), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse devcontainer file %s: %w", file, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve devcontainer directory: %w", err)
+	}
+	cfg.dir, cfg.root = dir, dir
+	if filepath.Base(dir) == ".devcontainer" {
+		cfg.root = filepath.Dir(dir)
+	}
+	return &cfg, nil
+}
+
+// ToolConfig maps the devcontainer onto a tool. The local workspace folder is
+// mounted like in VS Code (at /workspaces/<name> by default) and used as the
+// working directory. Paths on the host are absolute. Settings that cannot be
+// mapped are logged and skipped.
+func (d *DevcontainerConfig) ToolConfig() (ToolConfig, error) {
+	var tool ToolConfig
+	if len(d.DockerComposeFile) > 0 {
+		return tool, fmt.Errorf("devcontainers based on dockerComposeFile are not supported")
+	}
+
+	workspaceFolder := d.WorkspaceFolder
+	if workspaceFolder == "" {
+		workspaceFolder = "/workspaces/" + filepath.Base(d.root)
+	}
+	workspaceFolder = d.expand(workspaceFolder, "")
+	tool.Workdir = workspaceFolder
+
+	// Build
+	switch {
+	case d.Build != nil || d.DockerFile != "":
+		build := DevcontainerBuild{Dockerfile: d.DockerFile, Context: d.Context}
+		if d.Build != nil {
+			build = *d.Build
+		}
+		if build.Dockerfile == "" {
+			return tool, fmt.Errorf("build.dockerfile is required")
+		}
+		// Both paths are relative to devcontainer.json, while cderun expects the
+		// Dockerfile relative to the context.
+		context := filepath.Join(d.dir, d.expand(build.Context, workspaceFolder))
+		dockerfile, err := filepath.Rel(context, filepath.Join(d.dir, build.Dockerfile))
+		if err != nil {
+			return tool, fmt.Errorf("failed to locate dockerfile: %w", err)
+		}
+		tool.Build = &BuildConfig{
+			Context:    context,
+			Dockerfile: filepath.ToSlash(dockerfile),
+			Target:     build.Target,
+		}
+		if len(build.Args) > 0 {
+			tool.Build.Args = make(map[string]string, len(build.Args))
+			for k, v := range build.Args {
+				tool.Build.Args[k] = d.expand(v, workspaceFolder)
+			}
+		}
+	case d.Image != "":
+		tool.Image = d.expand(d.Image, workspaceFolder)
+	default:
+		return tool, fmt.Errorf("devcontainer has neither image nor build")
+	}
+
+	// Mounts, starting with the workspace
+	workspaceMount := DevcontainerMount{Type: "bind", Source: d.root, Target: workspaceFolder}
+	if d.WorkspaceMount != nil {
+		workspaceMount = *d.WorkspaceMount
+	}
+	for _, m := range append([]DevcontainerMount{workspaceMount}, d.Mounts...) {
+		if m.Type != "" && m.Type != "bind" {
+			logging.Warn("devcontainer: skipping %s mount of %s, only bind mounts are supported", m.Type, m.Target)
+			continue
+		}
+		volume := d.expand(m.Source, workspaceFolder) + ":" + d.expand(m.Target, workspaceFolder)
+		if m.ReadOnly {
+			volume += ":ro"
+		}
+		tool.Volumes = append(tool.Volumes, volume)
+	}
+
+	// Environment
+	keys := make([]string, 0, len(d.ContainerEnv))
+	for k := range d.ContainerEnv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tool.Env = append(tool.Env, d.envEntry(k, d.ContainerEnv[k], workspaceFolder))
+	}
+
+	tool.User = d.RemoteUser
+	if tool.User == "" {
+		tool.User = d.ContainerUser
+	}
+
+	for _, raw := range d.ForwardPorts {
+		var port int
+		if err := json.Unmarshal(raw, &port); err == nil {
+			tool.Ports = append(tool.Ports, fmt.Sprintf("%d:%d", port, port))
+			continue
+		}
+		var s string
+		_ = json.Unmarshal(raw, &s)
+		if _, err := strconv.Atoi(s); err == nil {
+			tool.Ports = append(tool.Ports, s+":"+s)
+			continue
+		}
+		// "db:5432" forwards a port of another container of a compose setup
+		logging.Warn("devcontainer: skipping forwardPorts entry %s", string(raw))
+	}
+
+	if err := d.applyRunArgs(&tool, workspaceFolder); err != nil {
+		return tool, err
+	}
+	return tool, nil
+}
+
+// ImportToolConfig is like ToolConfig, but keeps host environment values out of
+// the result, which is written to a tools file that may be committed:
+// ${localEnv:...} is not expanded, and a variable that passes a host variable
+// of the same name through is written as a bare name, resolved at run time.
+func (d *DevcontainerConfig) ImportToolConfig() (ToolConfig, error) {
+	d.keepLocalEnv = true
+	defer func() { d.keepLocalEnv = false }()
+	return d.ToolConfig()
+}
+
+// envEntry returns the env entry of a tool for the container variable name.
+func (d *DevcontainerConfig) envEntry(name, value, workspaceFolder string) string {
+	if d.keepLocalEnv && value == "${localEnv:"+name+"}" {
+		return name
+	}
+	return name + "=" + d.expand(value, workspaceFolder)
+}
+
+// applyRunArgs maps the "docker run" options that have an equivalent in
+// ToolConfig.
+func (d *DevcontainerConfig) applyRunArgs(tool *ToolConfig, workspaceFolder string) error {
+	args := d.RunArgs
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch name {
+		case "--network", "--net", "-e", "--env", "-v", "--volume", "-p", "--publish", "--add-host", "-w", "--workdir", "-u", "--user":
+		default:
+			logging.Warn("devcontainer: skipping unsupported runArgs option %s", args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return fmt.Errorf("devcontainer: runArgs option %s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if name == "-e" || name == "--env" {
+			// A bare name is taken from the host at run time, like docker does
+			if k, v, ok := strings.Cut(value, "="); ok {
+				value = d.envEntry(k, v, workspaceFolder)
+			}
+			tool.Env = append(tool.Env, value)
+			continue
+		}
+		value = d.expand(value, workspaceFolder)
+
+		switch name {
+		case "--network", "--net":
+			tool.Network = NetworkConfig{Name: value}
+		case "-v", "--volume":
+			tool.Volumes = append(tool.Volumes, value)
+		case "-p", "--publish":
+			tool.Ports = append(tool.Ports, value)
+		case "--add-host":
+			tool.ExtraHosts = append(tool.ExtraHosts, value)
+		case "-w", "--workdir":
+			tool.Workdir = value
+		case "-u", "--user":
+			tool.User = value
+		}
+	}
+	return nil
+}
+
+var devcontainerVariable = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// expand replaces the devcontainer variables that are known on the host, such
+// as ${localWorkspaceFolder} and ${localEnv:HOME}. Others, like ${containerEnv:PATH},
+// are kept as they are, and so is ${localEnv:...} for ImportToolConfig.
+func (d *DevcontainerConfig) expand(s, workspaceFolder string) string {
+	return devcontainerVariable.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[2 : len(match)-1]
+		switch name {
+		case "localWorkspaceFolder":
+			return d.root
+		case "localWorkspaceFolderBasename":
+			return filepath.Base(d.root)
+		case "containerWorkspaceFolder":
+			return workspaceFolder
+		case "containerWorkspaceFolderBasename":
+			return path.Base(workspaceFolder)
+		}
+		if rest, ok := strings.CutPrefix(name, "localEnv:"); ok {
+			if d.keepLocalEnv {
+				logging.Warn("devcontainer: %s is not expanded, so host values are not written to the tools file", match)
+				return match
+			}
+			envName, def, _ := strings.Cut(rest, ":")
+			if v, ok := os.LookupEnv(envName); ok {
+				return v
+			}
+			return def
+		}
+		return match
+	})
+}
+
+// stripComments removes // and /* */ comments outside of strings.
+func stripComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			out = append(out, c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// stripTrailingCommas removes commas before a closing bracket or brace. It
+// expects comments to be removed already.
+func stripTrailingCommas(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		} else if c == '"' {
+			inString = true
+		} else if c == ',' {
+			j := i + 1
+			for j < len(data) && strings.IndexByte(" \t\r\n", data[j]) >= 0 {
+				j++
+			}
+			if j < len(data) && (data[j] == '}' || data[j] == ']') {
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
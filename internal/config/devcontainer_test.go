@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevcontainer(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".devcontainer"), 0755))
+	write := func(content string) string {
+		t.Helper()
+		file := filepath.Join(root, ".devcontainer", "devcontainer.json")
+		require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+		return file
+	}
+	t.Setenv("CDERUN_TEST_TOKEN", "secret")
+
+	t.Run("image", func(t *testing.T) {
+		d, err := LoadDevcontainer(write(`{
+	// Comments and trailing commas are allowed
+	"name": "Node",
+	"image": "mcr.microsoft.com/devcontainers/javascript-node:20", /* inline */
+	"mounts": [
+		"source=${localEnv:HOME}/.npmrc,target=/home/node/.npmrc,type=bind,readonly",
+		{"source": "node-modules", "target": "${containerWorkspaceFolder}/node_modules", "type": "volume"},
+	],
+	"containerEnv": {"TOKEN": "${localEnv:CDERUN_TEST_TOKEN}", "URL": "http://x//y", "LEVEL": "${localEnv:CDERUN_UNSET:debug}"},
+	"remoteUser": "node",
+	"forwardPorts": [3000, "8080", "db:5432"],
+	"runArgs": ["--network=host", "--add-host", "api.local:10.0.0.1", "--cap-add=SYS_PTRACE", "-e", "DEBUG=1", "-e", "CDERUN_TEST_TOKEN"],
+}`))
+		require.NoError(t, err)
+		assert.Equal(t, "Node", d.Name)
+
+		tool, err := d.ToolConfig()
+		require.NoError(t, err)
+		workspace := "/workspaces/" + filepath.Base(root)
+		assert.Equal(t, "mcr.microsoft.com/devcontainers/javascript-node:20", tool.Image)
+		assert.Nil(t, tool.Build)
+		assert.Equal(t, workspace, tool.Workdir)
+		assert.Equal(t, []string{
+			root + ":" + workspace,
+			os.Getenv("HOME") + "/.npmrc:/home/node/.npmrc:ro",
+		}, tool.Volumes, "volume mounts are skipped")
+		assert.Equal(t, []string{"LEVEL=debug", "TOKEN=secret", "URL=http://x//y", "DEBUG=1", "CDERUN_TEST_TOKEN"}, tool.Env, "bare names are resolved at run time")
+		assert.Equal(t, "node", tool.User)
+		assert.Equal(t, []string{"3000:3000", "8080:8080"}, tool.Ports)
+		assert.Equal(t, "host", tool.Network.Name)
+		assert.Equal(t, []string{"api.local:10.0.0.1"}, tool.ExtraHosts)
+	})
+
+	t.Run("import keeps host values out", func(t *testing.T) {
+		d, err := LoadDevcontainer(write(`{
+	"image": "node:20",
+	"mounts": ["source=${localEnv:HOME}/.npmrc,target=/home/node/.npmrc,type=bind"],
+	"containerEnv": {"CDERUN_TEST_TOKEN": "${localEnv:CDERUN_TEST_TOKEN}", "TOKEN": "${localEnv:CDERUN_TEST_TOKEN}"},
+	"runArgs": ["-e", "CDERUN_TEST_TOKEN", "--env=OTHER=${localEnv:CDERUN_TEST_TOKEN}"]
+}`))
+		require.NoError(t, err)
+
+		tool, err := d.ImportToolConfig()
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"CDERUN_TEST_TOKEN",
+			"TOKEN=${localEnv:CDERUN_TEST_TOKEN}",
+			"CDERUN_TEST_TOKEN",
+			"OTHER=${localEnv:CDERUN_TEST_TOKEN}",
+		}, tool.Env)
+		assert.Contains(t, tool.Volumes, "${localEnv:HOME}/.npmrc:/home/node/.npmrc")
+
+		// ToolConfig still expands them for "cderun devcontainer"
+		tool, err = d.ToolConfig()
+		require.NoError(t, err)
+		assert.Contains(t, tool.Env, "TOKEN=secret")
+	})
+
+	t.Run("build", func(t *testing.T) {
+		d, err := LoadDevcontainer(write(`{
+	"build": {"dockerfile": "Dockerfile", "context": "..", "args": {"VARIANT": "3.12"}, "target": "dev"},
+	"workspaceFolder": "/src",
+	"workspaceMount": "source=${localWorkspaceFolder},target=/src,type=bind"
+}`))
+		require.NoError(t, err)
+		tool, err := d.ToolConfig()
+		require.NoError(t, err)
+		assert.Equal(t, &BuildConfig{
+			Context:    root,
+			Dockerfile: ".devcontainer/Dockerfile",
+			Args:       map[string]string{"VARIANT": "3.12"},
+			Target:     "dev",
+		}, tool.Build)
+		assert.Empty(t, tool.Image)
+		assert.Equal(t, "/src", tool.Workdir)
+		assert.Equal(t, []string{root + ":/src"}, tool.Volumes)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		d, err := LoadDevcontainer(write(`{"dockerComposeFile": "compose.yaml", "service": "app"}`))
+		require.NoError(t, err)
+		_, err = d.ToolConfig()
+		assert.ErrorContains(t, err, "dockerComposeFile are not supported")
+
+		d, err = LoadDevcontainer(write(`{"name": "empty"}`))
+		require.NoError(t, err)
+		_, err = d.ToolConfig()
+		assert.ErrorContains(t, err, "neither image nor build")
+
+		_, err = LoadDevcontainer(write(`{"image": }`))
+		assert.ErrorContains(t, err, "failed to parse devcontainer file")
+	})
+}
+
+func TestStripJSONC(t *testing.T) {
+	in := `{"a": "// not a comment", /* c */ "b": [1, 2,], // end
+"c": "\"/*\"",}`
+	assert.JSONEq(t, `{"a": "// not a comment", "b": [1, 2], "c": "\"/*\""}`, string(stripTrailingCommas(stripComments([]byte(in)))))
+}
+
+func TestWriteTools(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".tools.yaml")
+
+	require.NoError(t, WriteTools(file, ToolsConfig{"dev": {Image: "node:20", Network: NetworkConfig{Name: "host"}}}, false))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "dev:\n  image: node:20\n  network: host\n", string(data))
+
+	require.NoError(t, os.WriteFile(file, []byte("# Project tools\npython:\n  image: python:3.12 # pinned\n"), 0644))
+	require.NoError(t, WriteTools(file, ToolsConfig{"dev": {Build: &BuildConfig{Context: "."}, Volumes: []string{".:/src"}}}, false))
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "# Project tools\npython:\n  image: python:3.12 # pinned\ndev:\n  build: .\n  volumes:\n    - .:/src\n", string(data))
+
+	err = WriteTools(file, ToolsConfig{"go": {Image: "golang"}, "python": {Image: "python:3.13"}}, false)
+	assert.ErrorIs(t, err, ErrToolExists)
+	unchanged, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, data, unchanged, "nothing is written when a tool exists")
+	require.NoError(t, WriteTools(file, ToolsConfig{"python": {Image: "python:3.13"}}, true))
+
+	tools, _, err := loadToolsFile(t, file)
+	require.NoError(t, err)
+	assert.Equal(t, "python:3.13", tools["python"].Image)
+	assert.Equal(t, ".", tools["dev"].Build.Context)
+	assert.Equal(t, []string{filepath.Dir(file) + ":/src"}, tools["dev"].Volumes, "relative volumes are resolved against the tools file")
+}
+
+func loadToolsFile(t *testing.T, file string) (ToolsConfig, string, error) {
+	t.Helper()
+	oldWd, _ := os.Getwd()
+	require.NoError(t, os.Chdir(filepath.Dir(file)))
+	t.Cleanup(func() { os.Chdir(oldWd) })
+	return LoadToolsConfig()
+}
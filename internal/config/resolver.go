@@ -6,15 +6,21 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/moby/term"
 )
 
 // ResolvedConfig contains the final values after resolution.
 type ResolvedConfig struct {
 	Image         string
-	TTY           bool
-	Interactive   bool
+	TTY           BoolOrAuto
+	Interactive   BoolOrAuto
 	Network       string
 	Remove        bool
 	Volumes       []container.VolumeMount
@@ -34,23 +40,54 @@ type ResolvedConfig struct {
 	LogFormat     string
 	LogTee        bool
 	LogTimestamp  bool
+	Secrets       []container.SecretMount
+	ForwardSSHAgent  bool
+	ForwardGitConfig bool
+	Ports            []container.PortMapping
+	PublishAll       bool
+	NetworkAliases   []string
+	NetworkCreate    *container.NetworkSpec
+	ExtraHosts       []string
+	Services         []container.ServiceSpec
+	ServicesLogs     bool
+	KeepAlive        bool
+	IdleTimeout      string
+	KeepAliveCommand []string
+	ReapOrphans      bool
+	ForwardSignals   []string
+	StopSignal       string
+	StopTimeout      string
+	AutoStdin        bool
+	DetachKeys       string
+	DrainTimeout     string
+	SplitStreams     bool
+	OutputLog        string
+	OutputLogFormat  string
+	CaptureStdout    string
+	CaptureStderr    string
+	// Build is set when the image is built from a Dockerfile. Image is then the
+	// repository the build is tagged in, or empty for the default.
+	Build *BuildConfig
+	// Packages are installed on top of Image in a derived image
+	Packages       []string
+	PackageManager string
 }
 
 // CLIOptions represents values from CLI flags.
 type CLIOptions struct {
 	Image                string
 	ImageSet             bool
-	TTY                  bool
+	TTY                  BoolOrAuto
 	TTYSet               bool
-	Interactive          bool
+	Interactive          BoolOrAuto
 	InteractiveSet       bool
 	Network              string
 	NetworkSet           bool
 	Remove               bool
 	RemoveSet            bool
-	CderunTTY            bool
+	CderunTTY            BoolOrAuto
 	CderunTTYSet         bool
-	CderunInteractive    bool
+	CderunInteractive    BoolOrAuto
 	CderunInteractiveSet bool
 	CderunImage          string
 	CderunImageSet       bool
@@ -110,6 +147,58 @@ type CLIOptions struct {
 	CderunLogTee          bool
 	CderunLogTeeSet       bool
 	CderunVerbose         int
+	ForwardSSHAgent             bool
+	ForwardSSHAgentSet          bool
+	CderunForwardSSHAgent       bool
+	CderunForwardSSHAgentSet    bool
+	ForwardGitConfig            bool
+	ForwardGitConfigSet         bool
+	CderunForwardGitConfig      bool
+	CderunForwardGitConfigSet   bool
+	Publish                     []string
+	CderunPublish               []string
+	PublishAll                  bool
+	PublishAllSet               bool
+	CderunPublishAll            bool
+	CderunPublishAllSet         bool
+	NetworkAliases              []string
+	CderunNetworkAliases        []string
+	AddHosts                    []string
+	CderunAddHosts              []string
+	ServicesLogs                bool
+	ServicesLogsSet             bool
+	CderunServicesLogs          bool
+	CderunServicesLogsSet       bool
+	KeepAlive                   bool
+	KeepAliveSet                bool
+	CderunKeepAlive             bool
+	CderunKeepAliveSet          bool
+	AutoStdin                   bool
+	AutoStdinSet                bool
+	CderunAutoStdin             bool
+	CderunAutoStdinSet          bool
+	DetachKeys                  string
+	DetachKeysSet               bool
+	CderunDetachKeys            string
+	CderunDetachKeysSet         bool
+	DrainTimeout                string
+	DrainTimeoutSet             bool
+	CderunDrainTimeout          string
+	CderunDrainTimeoutSet       bool
+	SplitStreams                bool
+	SplitStreamsSet             bool
+	CderunSplitStreams          bool
+	CderunSplitStreamsSet       bool
+	OutputLog                   string
+	OutputLogSet                bool
+	CderunOutputLog             string
+	CderunOutputLogSet          bool
+	OutputLogFormat             string
+	OutputLogFormatSet          bool
+	CderunOutputLogFormat       string
+	CderunOutputLogFormatSet    bool
+	Capture                     []string
+	CderunCapture               []string
 }
 
 // Resolve combines CLI flags, environment variables, tool-specific config, and global defaults.
@@ -125,46 +214,89 @@ func Resolve(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERu
 	} else if env := os.Getenv("CDERUN_IMAGE"); env != "" {
 		res.Image = env
 	} else if tools != nil {
-		if tool, ok := tools[subcommand]; ok && tool.Image != "" {
+		if tool, ok := tools[subcommand]; ok && tool.Build != nil {
+			// The image is tagged by the caller once the build inputs are hashed
+			build, err := resolveBuild(tool.Build)
+			if err != nil {
+				return nil, err
+			}
+			res.Build = build
+			res.Image = tool.Image
+		} else if ok && tool.Image != "" {
 			res.Image = tool.Image
 		}
 	}
 
-	if res.Image == "" {
+	if res.Image == "" && res.Build == nil {
 		return nil, fmt.Errorf("no image mapping found for tool: %s", subcommand)
 	}
 	logging.Debug("Resolved Image: %s", res.Image)
 
-	// 2. Resolve TTY
-	res.TTY = resolveBool(
+	// Packages apply to any image of the tool, including one given with --image
+	if tool, ok := tools[subcommand]; ok && len(tool.Packages) > 0 {
+		if tool.Build != nil {
+			return nil, fmt.Errorf("packages cannot be combined with build for tool %s, install them in the Dockerfile", subcommand)
+		}
+		res.Packages = tool.Packages
+		res.PackageManager = tool.PackageManager
+	}
+
+	// 2. Resolve TTY ("auto" is decided by the caller from the terminal state)
+	tty, err := resolveBoolOrAuto(
 		cli.CderunTTYSet, cli.CderunTTY,
 		cli.TTYSet, cli.TTY,
 		"CDERUN_TTY",
-		subcommand, tools, func(t ToolConfig) *bool { return t.TTY },
-		global, func(g CDERunConfig) *bool { return g.Defaults.TTY },
-		false,
+		subcommand, tools, func(t ToolConfig) BoolOrAuto { return t.TTY },
+		global, func(g CDERunConfig) BoolOrAuto { return g.Defaults.TTY },
+		BoolFalse,
 	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tty setting: %w", err)
+	}
+	res.TTY = tty
 
 	// 3. Resolve Interactive
-	res.Interactive = resolveBool(
+	interactive, err := resolveBoolOrAuto(
 		cli.CderunInteractiveSet, cli.CderunInteractive,
 		cli.InteractiveSet, cli.Interactive,
 		"CDERUN_INTERACTIVE",
-		subcommand, tools, func(t ToolConfig) *bool { return t.Interactive },
-		global, func(g CDERunConfig) *bool { return g.Defaults.Interactive },
-		false,
+		subcommand, tools, func(t ToolConfig) BoolOrAuto { return t.Interactive },
+		global, func(g CDERunConfig) BoolOrAuto { return g.Defaults.Interactive },
+		BoolFalse,
 	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interactive setting: %w", err)
+	}
+	res.Interactive = interactive
 
 	// 4. Resolve Network
 	res.Network = resolveString(
 		cli.CderunNetworkSet, cli.CderunNetwork,
 		cli.NetworkSet, cli.Network,
 		"CDERUN_NETWORK",
-		subcommand, tools, func(t ToolConfig) string { return t.Network },
+		subcommand, tools, func(t ToolConfig) string { return t.Network.Name },
 		global, func(g CDERunConfig) string { return g.Defaults.Network },
 		"bridge",
 	)
 
+	// Network lifecycle options only apply when the tool's own network is used
+	if tools != nil {
+		if tool, ok := tools[subcommand]; ok && tool.Network.Name != "" && tool.Network.Name == res.Network {
+			res.NetworkAliases = append(res.NetworkAliases, tool.Network.Aliases...)
+			if tool.Network.Create {
+				res.NetworkCreate = &container.NetworkSpec{
+					Name:     tool.Network.Name,
+					Internal: tool.Network.Internal,
+					Remove:   tool.Network.Remove,
+				}
+			} else if tool.Network.Remove || tool.Network.Internal {
+				logging.Warn("network %q: internal and remove are only applied together with create", tool.Network.Name)
+			}
+		}
+	}
+	res.NetworkAliases = append(res.NetworkAliases, cli.NetworkAliases...)
+	res.NetworkAliases = append(res.NetworkAliases, cli.CderunNetworkAliases...)
+
 	// 5. Resolve Remove
 	res.Remove = resolveBool(
 		cli.CderunRemoveSet, cli.CderunRemove,
@@ -185,12 +317,26 @@ func Resolve(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERu
 		"",
 	)
 
-	// 8. Tool-specific settings (Volumes, Env)
+	// 8. Tool-specific settings (Volumes, Env, User, Secrets, Ports)
 	var toolsEnv []string
+	var toolsPorts []string
 	if tools != nil {
 		if tool, ok := tools[subcommand]; ok {
 			res.Volumes = parseVolumes(tool.Volumes)
+			res.User = tool.User
 			toolsEnv = tool.Env
+			toolsPorts = tool.Ports
+			res.ExtraHosts = append(res.ExtraHosts, tool.ExtraHosts...)
+			secrets, err := parseSecrets(tool.Secrets)
+			if err != nil {
+				return nil, err
+			}
+			res.Secrets = secrets
+			services, err := parseServices(tool.Services)
+			if err != nil {
+				return nil, err
+			}
+			res.Services = services
 		}
 	}
 
@@ -202,29 +348,37 @@ func Resolve(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERu
 		res.Volumes = append(res.Volumes, parseVolumes(cli.CderunVolumes)...)
 	}
 
-	// Resolve Env (P1 > P2 > P4)
-	res.Env = resolveEnvValues(mergeEnv(toolsEnv, cli.Env, cli.CderunEnv))
+	// 9b. Merge extra hosts (P4 + P2 + P1)
+	res.ExtraHosts = append(res.ExtraHosts, cli.AddHosts...)
+	res.ExtraHosts = append(res.ExtraHosts, cli.CderunAddHosts...)
+	for _, h := range res.ExtraHosts {
+		if !strings.Contains(h, ":") && !strings.Contains(h, "=") {
+			return nil, fmt.Errorf("invalid extra host %q: expected host:ip", h)
+		}
+	}
 
-	// 11. Resolve Runtime
-	res.Runtime = resolveString(
-		cli.CderunRuntimeSet, cli.CderunRuntime,
-		cli.RuntimeSet, cli.Runtime,
-		"CDERUN_RUNTIME",
-		"", nil, nil, // No tool-specific runtime
-		global, func(g CDERunConfig) string { return g.Runtime },
-		"docker",
-	)
+	// 10. Merge published ports (P4 + P2 + P1)
+	ports, err := parsePorts(append(append(append([]string{}, toolsPorts...), cli.Publish...), cli.CderunPublish...))
+	if err != nil {
+		return nil, err
+	}
+	res.Ports = ports
 
-	// 12. Resolve Socket
-	res.Socket = resolveString(
-		cli.CderunMountSocketSet, cli.CderunMountSocket,
-		cli.MountSocketSet, cli.MountSocket,
-		"CDERUN_MOUNT_SOCKET",
-		"", nil, nil,
-		nil, nil, // Global doesn't have socket path yet in schema but could
-		"/var/run/docker.sock",
+	res.PublishAll = resolveBool(
+		cli.CderunPublishAllSet, cli.CderunPublishAll,
+		cli.PublishAllSet, cli.PublishAll,
+		"CDERUN_PUBLISH_ALL",
+		subcommand, tools, func(t ToolConfig) *bool { return t.PublishAll },
+		nil, nil,
+		false,
 	)
 
+	// Resolve Env (P1 > P2 > P4)
+	res.Env = resolveEnvValues(mergeEnv(toolsEnv, cli.Env, cli.CderunEnv))
+
+	// 11-12. Resolve Runtime and Socket
+	res.Runtime, res.Socket = ResolveRuntime(cli, global)
+
 	// Determine if the socket was explicitly set to a mountable value
 	// We only consider cderun-specific settings for mounting detection.
 	var rawSocket string
@@ -237,9 +391,6 @@ func Resolve(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERu
 	}
 	res.SocketSet = rawSocket != "" && isMountableSocket(rawSocket)
 
-	// Special handling for unix:// prefix
-	res.Socket = strings.TrimPrefix(res.Socket, "unix://")
-
 	// 13. Resolve MountCderun
 	res.MountCderun = resolveBool(
 		cli.CderunMountCderunSet, cli.CderunMountCderun,
@@ -342,9 +493,337 @@ func Resolve(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERu
 		true, // Default to true
 	)
 
+	// 18. Resolve credential forwarding
+	res.ForwardSSHAgent = resolveBool(
+		cli.CderunForwardSSHAgentSet, cli.CderunForwardSSHAgent,
+		cli.ForwardSSHAgentSet, cli.ForwardSSHAgent,
+		"CDERUN_FORWARD_SSH_AGENT",
+		subcommand, tools, func(t ToolConfig) *bool { return t.ForwardSSHAgent },
+		global, func(g CDERunConfig) *bool { return g.Defaults.ForwardSSHAgent },
+		false,
+	)
+
+	res.ForwardGitConfig = resolveBool(
+		cli.CderunForwardGitConfigSet, cli.CderunForwardGitConfig,
+		cli.ForwardGitConfigSet, cli.ForwardGitConfig,
+		"CDERUN_FORWARD_GIT_CONFIG",
+		subcommand, tools, func(t ToolConfig) *bool { return t.ForwardGitConfig },
+		global, func(g CDERunConfig) *bool { return g.Defaults.ForwardGitConfig },
+		false,
+	)
+
+	// 19. Resolve sidecar service log streaming
+	res.ServicesLogs = resolveBool(
+		cli.CderunServicesLogsSet, cli.CderunServicesLogs,
+		cli.ServicesLogsSet, cli.ServicesLogs,
+		"CDERUN_SERVICES_LOGS",
+		subcommand, tools, func(t ToolConfig) *bool { return t.ServicesLogs },
+		nil, nil,
+		false,
+	)
+
+	// 20. Resolve keep-alive mode
+	res.KeepAlive = resolveBool(
+		cli.CderunKeepAliveSet, cli.CderunKeepAlive,
+		cli.KeepAliveSet, cli.KeepAlive,
+		"CDERUN_KEEP_ALIVE",
+		subcommand, tools, func(t ToolConfig) *bool { return t.KeepAlive },
+		nil, nil,
+		false,
+	)
+	res.IdleTimeout = resolveString(
+		false, "",
+		false, "",
+		"CDERUN_IDLE_TIMEOUT",
+		subcommand, tools, func(t ToolConfig) string { return t.IdleTimeout },
+		nil, nil,
+		defaultIdleTimeout,
+	)
+	if _, err := time.ParseDuration(res.IdleTimeout); err != nil {
+		return nil, fmt.Errorf("invalid idle timeout %q: %w", res.IdleTimeout, err)
+	}
+	if tools != nil {
+		if tool, ok := tools[subcommand]; ok && len(tool.KeepAliveCommand) > 0 {
+			res.KeepAliveCommand = tool.KeepAliveCommand
+		}
+	}
+
+	// 21. Resolve forwarded signals
+	res.ForwardSignals = defaultForwardSignals
+	if env := os.Getenv("CDERUN_FORWARD_SIGNALS"); env != "" {
+		res.ForwardSignals = strings.Split(env, ",")
+	} else if tools != nil {
+		if tool, ok := tools[subcommand]; ok && tool.ForwardSignals != nil {
+			res.ForwardSignals = tool.ForwardSignals
+		}
+	}
+	signals, err := normalizeSignals(res.ForwardSignals)
+	if err != nil {
+		return nil, err
+	}
+	res.ForwardSignals = signals
+
+	// 22. Resolve graceful stop settings
+	res.StopSignal = normalizeSignalName(resolveString(
+		false, "",
+		false, "",
+		"CDERUN_STOP_SIGNAL",
+		subcommand, tools, func(t ToolConfig) string { return t.StopSignal },
+		nil, nil,
+		"",
+	))
+	res.StopTimeout = resolveString(
+		false, "",
+		false, "",
+		"CDERUN_STOP_TIMEOUT",
+		subcommand, tools, func(t ToolConfig) string { return t.StopTimeout },
+		nil, nil,
+		defaultStopTimeout,
+	)
+	if d, err := time.ParseDuration(res.StopTimeout); err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid stop timeout %q", res.StopTimeout)
+	}
+
+	// 23. Resolve automatic stdin attachment for pipes and files
+	res.AutoStdin = resolveBool(
+		cli.CderunAutoStdinSet, cli.CderunAutoStdin,
+		cli.AutoStdinSet, cli.AutoStdin,
+		"CDERUN_AUTO_STDIN",
+		subcommand, tools, func(t ToolConfig) *bool { return t.AutoStdin },
+		global, func(g CDERunConfig) *bool { return g.Defaults.AutoStdin },
+		true,
+	)
+
+	// 24. Resolve orphan container cleanup
+	res.ReapOrphans = resolveBool(
+		false, false,
+		false, false,
+		"CDERUN_REAP_ORPHANS",
+		"", nil, nil,
+		global, func(g CDERunConfig) *bool { return g.ReapOrphans },
+		true,
+	)
+
+	// 25. Resolve the detach key sequence
+	detachKeys, err := ResolveDetachKeys(subcommand, cli, tools, global)
+	if err != nil {
+		return nil, err
+	}
+	res.DetachKeys = detachKeys
+
+	// 26. Resolve how long to wait for remaining output after the container exits
+	drainTimeout, err := ResolveDrainTimeout(subcommand, cli, tools, global)
+	if err != nil {
+		return nil, err
+	}
+	res.DrainTimeout = drainTimeout
+
+	// 27. Resolve whether to keep stdout and stderr apart instead of allocating a TTY
+	res.SplitStreams = resolveBool(
+		cli.CderunSplitStreamsSet, cli.CderunSplitStreams,
+		cli.SplitStreamsSet, cli.SplitStreams,
+		"CDERUN_SPLIT_STREAMS",
+		subcommand, tools, func(t ToolConfig) *bool { return t.SplitStreams },
+		global, func(g CDERunConfig) *bool { return g.Defaults.SplitStreams },
+		false,
+	)
+
+	// 28. Resolve copies of the output written to files
+	res.OutputLog = resolveString(
+		cli.CderunOutputLogSet, cli.CderunOutputLog,
+		cli.OutputLogSet, cli.OutputLog,
+		"CDERUN_OUTPUT_LOG",
+		subcommand, tools, func(t ToolConfig) string { return t.OutputLog },
+		global, func(g CDERunConfig) string { return g.Defaults.OutputLog },
+		"",
+	)
+	res.OutputLogFormat = strings.ToLower(resolveString(
+		cli.CderunOutputLogFormatSet, cli.CderunOutputLogFormat,
+		cli.OutputLogFormatSet, cli.OutputLogFormat,
+		"CDERUN_OUTPUT_LOG_FORMAT",
+		subcommand, tools, func(t ToolConfig) string { return t.OutputLogFormat },
+		global, func(g CDERunConfig) string { return g.Defaults.OutputLogFormat },
+		"text",
+	))
+	if res.OutputLogFormat != "text" && res.OutputLogFormat != "jsonl" {
+		return nil, fmt.Errorf("invalid output log format %q: must be text or jsonl", res.OutputLogFormat)
+	}
+	cliCapture, err := parseCapture(cli.Capture)
+	if err != nil {
+		return nil, err
+	}
+	cderunCapture, err := parseCapture(cli.CderunCapture)
+	if err != nil {
+		return nil, err
+	}
+	resolveCapture := func(stream string, toolGetter func(ToolConfig) string, globalGetter func(CDERunConfig) string) string {
+		p1, p1Set := cderunCapture[stream]
+		p2, p2Set := cliCapture[stream]
+		return resolveString(
+			p1Set, p1,
+			p2Set, p2,
+			"CDERUN_CAPTURE_"+strings.ToUpper(stream),
+			subcommand, tools, toolGetter,
+			global, globalGetter,
+			"",
+		)
+	}
+	res.CaptureStdout = resolveCapture("stdout",
+		func(t ToolConfig) string { return t.Capture.Stdout },
+		func(g CDERunConfig) string { return g.Defaults.Capture.Stdout },
+	)
+	res.CaptureStderr = resolveCapture("stderr",
+		func(t ToolConfig) string { return t.Capture.Stderr },
+		func(g CDERunConfig) string { return g.Defaults.Capture.Stderr },
+	)
+
 	return res, nil
 }
 
+const defaultIdleTimeout = "15m"
+
+// defaultForwardSignals are forwarded to the container unless configured otherwise.
+var defaultForwardSignals = []string{"SIGINT", "SIGTERM", "SIGHUP", "SIGQUIT", "SIGUSR1", "SIGUSR2", "SIGTSTP"}
+
+// forwardableSignals lists the signals that can be forwarded. SIGKILL and SIGSTOP
+// cannot be caught, SIGWINCH is used for terminal resizing.
+var forwardableSignals = map[string]bool{
+	"SIGHUP": true, "SIGINT": true, "SIGQUIT": true, "SIGTERM": true, "SIGUSR1": true,
+	"SIGUSR2": true, "SIGTSTP": true, "SIGCONT": true, "SIGALRM": true,
+}
+
+// normalizeSignals converts names like "hup" or "SIGHUP" to "SIGHUP" and removes duplicates.
+func normalizeSignals(names []string) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	for _, n := range names {
+		name := normalizeSignalName(n)
+		if name == "" {
+			continue
+		}
+		if !forwardableSignals[name] {
+			return nil, fmt.Errorf("signal %q cannot be forwarded", n)
+		}
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// resolveBuild fills in the defaults of a build section and makes the context absolute.
+func resolveBuild(b *BuildConfig) (*BuildConfig, error) {
+	res := *b
+	if res.Context == "" {
+		res.Context = "."
+	}
+	abs, err := filepath.Abs(res.Context)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build context %q: %w", res.Context, err)
+	}
+	res.Context = abs
+	if res.Dockerfile == "" {
+		res.Dockerfile = "Dockerfile"
+	}
+	return &res, nil
+}
+
+// parseCapture parses --capture values like "stdout=out.log" into files by stream.
+func parseCapture(values []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, v := range values {
+		stream, file, ok := strings.Cut(v, "=")
+		stream = strings.ToLower(strings.TrimSpace(stream))
+		if !ok || file == "" || (stream != "stdout" && stream != "stderr") {
+			return nil, fmt.Errorf("invalid capture %q: must be stdout=FILE or stderr=FILE", v)
+		}
+		result[stream] = file
+	}
+	return result, nil
+}
+
+// normalizeSignalName converts names like "hup" to "SIGHUP". Signal numbers are kept as-is.
+func normalizeSignalName(n string) string {
+	name := strings.ToUpper(strings.TrimSpace(n))
+	if name == "" || strings.HasPrefix(name, "SIG") {
+		return name
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return name
+	}
+	return "SIG" + name
+}
+
+// defaultStopTimeout matches the default of "docker stop".
+const defaultStopTimeout = "10s"
+
+// defaultDetachKeys matches the default of "docker attach".
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ResolveDetachKeys resolves the key sequence that detaches from a TTY session.
+// Management commands pass the tool of the container, or an empty subcommand.
+func ResolveDetachKeys(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERunConfig) (string, error) {
+	keys := resolveString(
+		cli.CderunDetachKeysSet, cli.CderunDetachKeys,
+		cli.DetachKeysSet, cli.DetachKeys,
+		"CDERUN_DETACH_KEYS",
+		subcommand, tools, func(t ToolConfig) string { return t.DetachKeys },
+		global, func(g CDERunConfig) string { return g.Defaults.DetachKeys },
+		defaultDetachKeys,
+	)
+	if _, err := term.ToBytes(keys); err != nil {
+		return "", fmt.Errorf("invalid detach keys %q: %w", keys, err)
+	}
+	return keys, nil
+}
+
+// defaultDrainTimeout bounds the wait for output after the container exits in
+// case the stream never reports EOF.
+const defaultDrainTimeout = "5s"
+
+// ResolveDrainTimeout resolves how long to wait for the output stream to end after
+// the container exits. 0 waits until the stream ends.
+func ResolveDrainTimeout(subcommand string, cli CLIOptions, tools ToolsConfig, global *CDERunConfig) (string, error) {
+	timeout := resolveString(
+		cli.CderunDrainTimeoutSet, cli.CderunDrainTimeout,
+		cli.DrainTimeoutSet, cli.DrainTimeout,
+		"CDERUN_DRAIN_TIMEOUT",
+		subcommand, tools, func(t ToolConfig) string { return t.DrainTimeout },
+		global, func(g CDERunConfig) string { return g.Defaults.DrainTimeout },
+		defaultDrainTimeout,
+	)
+	if d, err := time.ParseDuration(timeout); err != nil || d < 0 {
+		return "", fmt.Errorf("invalid drain timeout %q", timeout)
+	}
+	return timeout, nil
+}
+
+// ResolveRuntime resolves the container runtime and its socket path.
+// Unlike Resolve it does not need a tool, so management commands can use it.
+func ResolveRuntime(cli CLIOptions, global *CDERunConfig) (string, string) {
+	runtimeName := resolveString(
+		cli.CderunRuntimeSet, cli.CderunRuntime,
+		cli.RuntimeSet, cli.Runtime,
+		"CDERUN_RUNTIME",
+		"", nil, nil, // No tool-specific runtime
+		global, func(g CDERunConfig) string { return g.Runtime },
+		"docker",
+	)
+
+	socket := resolveString(
+		cli.CderunMountSocketSet, cli.CderunMountSocket,
+		cli.MountSocketSet, cli.MountSocket,
+		"CDERUN_MOUNT_SOCKET",
+		"", nil, nil,
+		nil, nil, // Global doesn't have socket path yet in schema but could
+		"/var/run/docker.sock",
+	)
+
+	// Special handling for unix:// prefix
+	return runtimeName, strings.TrimPrefix(socket, "unix://")
+}
+
 func isMountableSocket(s string) bool {
 	if strings.HasPrefix(s, "unix://") {
 		return true
@@ -379,6 +858,20 @@ func resolveBool(p1Set bool, p1Val bool, p2Set bool, p2Val bool, envKey string,
 	return fallback
 }
 
+// resolveBoolOrAuto resolves a setting that accepts true, false or auto with the
+// same priority as resolveBool. Unlike resolveBool, an invalid environment value is an error.
+func resolveBoolOrAuto(p1Set bool, p1Val BoolOrAuto, p2Set bool, p2Val BoolOrAuto, envKey string, subcommand string, tools ToolsConfig, toolGetter func(ToolConfig) BoolOrAuto, global *CDERunConfig, globalGetter func(CDERunConfig) BoolOrAuto, fallback BoolOrAuto) (BoolOrAuto, error) {
+	s := resolveString(
+		p1Set, string(p1Val),
+		p2Set, string(p2Val),
+		envKey,
+		subcommand, tools, func(t ToolConfig) string { return string(toolGetter(t)) },
+		global, func(g CDERunConfig) string { return string(globalGetter(g)) },
+		string(fallback),
+	)
+	return ParseBoolOrAuto(s)
+}
+
 func resolveString(p1Set bool, p1Val string, cliSet bool, cliVal string, envKey string, subcommand string, tools ToolsConfig, toolGetter func(ToolConfig) string, global *CDERunConfig, globalGetter func(CDERunConfig) string, fallback string) string {
 	if p1Set {
 		return p1Val
@@ -442,6 +935,154 @@ func resolveEnvValues(env []string) []string {
 	return res
 }
 
+// defaultSecretDir is where secrets are mounted when no explicit target is given.
+const defaultSecretDir = "/run/secrets"
+
+func parseSecrets(secrets []SecretConfig) ([]container.SecretMount, error) {
+	var mounts []container.SecretMount
+	seen := make(map[string]bool)
+	for _, s := range secrets {
+		if s.Name == "" {
+			return nil, fmt.Errorf("secret name must not be empty")
+		}
+		if strings.ContainsAny(s.Name, `/\`) || s.Name == "." || s.Name == ".." {
+			return nil, fmt.Errorf("invalid secret name %q", s.Name)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("duplicate secret name %q", s.Name)
+		}
+		seen[s.Name] = true
+
+		mount := container.SecretMount{Name: s.Name}
+		sources := 0
+		if s.File != "" {
+			mount.SourceType, mount.Source = "file", s.File
+			sources++
+		}
+		if s.Env != "" {
+			mount.SourceType, mount.Source = "env", s.Env
+			sources++
+		}
+		if s.Command != "" {
+			mount.SourceType, mount.Source = "command", s.Command
+			sources++
+		}
+		if sources != 1 {
+			return nil, fmt.Errorf("secret %q must have exactly one of file, env or command", s.Name)
+		}
+
+		mount.ContainerPath = s.Target
+		if mount.ContainerPath == "" {
+			mount.ContainerPath = defaultSecretDir + "/" + s.Name
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// parsePorts parses Docker-style port specs: [ip:][hostPort:]containerPort[/proto].
+// Port ranges such as 8000-8002:8000-8002 are expanded into individual mappings.
+func parsePorts(specs []string) ([]container.PortMapping, error) {
+	var mappings []container.PortMapping
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		parsed, err := nat.ParsePortSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port spec %q: %w", spec, err)
+		}
+		for _, p := range parsed {
+			mappings = append(mappings, container.PortMapping{
+				HostIP:        p.Binding.HostIP,
+				HostPort:      p.Binding.HostPort,
+				ContainerPort: p.Port.Port(),
+				Protocol:      p.Port.Proto(),
+			})
+		}
+	}
+	return mappings, nil
+}
+
+// serviceNamePattern restricts service names to valid network aliases.
+var serviceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// parseServices converts the services map into specs sorted by name so that
+// services start in a stable order.
+func parseServices(services map[string]ServiceConfig) ([]container.ServiceSpec, error) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var specs []container.ServiceSpec
+	for _, name := range names {
+		s := services[name]
+		if !serviceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid service name %q", name)
+		}
+		if s.Image == "" {
+			return nil, fmt.Errorf("service %q: image is required", name)
+		}
+		ports, err := parsePorts(s.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		healthcheck, err := parseHealthcheck(s.Healthcheck)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		specs = append(specs, container.ServiceSpec{
+			Name:        name,
+			Image:       s.Image,
+			Command:     s.Command,
+			Env:         resolveEnvValues(s.Env),
+			Ports:       ports,
+			Healthcheck: healthcheck,
+		})
+	}
+	return specs, nil
+}
+
+func parseHealthcheck(h *HealthcheckConfig) (*container.Healthcheck, error) {
+	if h == nil {
+		return nil, nil
+	}
+	if len(h.Test) == 0 {
+		return nil, fmt.Errorf("healthcheck test must not be empty")
+	}
+	test := []string(h.Test)
+	switch test[0] {
+	case "CMD", "CMD-SHELL", "NONE":
+	default:
+		// A bare list is an exec-form command, as in Compose
+		test = append([]string{"CMD"}, test...)
+	}
+	for _, d := range []struct{ name, value string }{
+		{"interval", h.Interval},
+		{"timeout", h.Timeout},
+		{"startPeriod", h.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d.value); err != nil {
+			return nil, fmt.Errorf("invalid healthcheck %s %q: %w", d.name, d.value, err)
+		}
+	}
+	if h.Retries < 0 {
+		return nil, fmt.Errorf("healthcheck retries must not be negative")
+	}
+	return &container.Healthcheck{
+		Test:        test,
+		Interval:    h.Interval,
+		Timeout:     h.Timeout,
+		Retries:     h.Retries,
+		StartPeriod: h.StartPeriod,
+	}, nil
+}
+
 func parseVolumes(vols []string) []container.VolumeMount {
 	var mounts []container.VolumeMount
 	for _, v := range vols {
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"cderun/internal/container"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,32 +16,32 @@ func TestResolve(t *testing.T) {
 
 	t.Run("P2 CLI takes priority over P4 Tool and P5 Global", func(t *testing.T) {
 		cli := CLIOptions{
-			TTY:    true,
+			TTY:    BoolTrue,
 			TTYSet: true,
 		}
 		tools := ToolsConfig{
 			"node": ToolConfig{
 				Image: "node:20",
-				TTY:   ptr(false),
+				TTY:   BoolFalse,
 			},
 		}
 		global := &CDERunConfig{
 			Defaults: ConfigDefaults{
-				TTY: ptr(false),
+				TTY: BoolFalse,
 			},
 		}
 
 		res, err := Resolve("node", cli, tools, global)
 		require.NoError(t, err)
-		assert.True(t, res.TTY)
+		assert.Equal(t, BoolTrue, res.TTY)
 		assert.Equal(t, "node:20", res.Image)
 	})
 
 	t.Run("P1 Override takes priority over P2 CLI", func(t *testing.T) {
 		cli := CLIOptions{
-			TTY:          true,
+			TTY:          BoolTrue,
 			TTYSet:       true,
-			CderunTTY:    false,
+			CderunTTY:    BoolFalse,
 			CderunTTYSet: true,
 		}
 		tools := ToolsConfig{
@@ -49,7 +52,7 @@ func TestResolve(t *testing.T) {
 
 		res, err := Resolve("node", cli, tools, nil)
 		require.NoError(t, err)
-		assert.False(t, res.TTY)
+		assert.Equal(t, BoolFalse, res.TTY)
 	})
 
 	t.Run("P3 Env Var priority", func(t *testing.T) {
@@ -58,13 +61,43 @@ func TestResolve(t *testing.T) {
 		tools := ToolsConfig{
 			"node": ToolConfig{
 				Image: "node:20",
-				TTY:   ptr(false),
+				TTY:   BoolFalse,
 			},
 		}
 
 		res, err := Resolve("node", cli, tools, nil)
 		require.NoError(t, err)
-		assert.True(t, res.TTY)
+		assert.Equal(t, BoolTrue, res.TTY)
+	})
+
+	t.Run("TTY and Interactive auto", func(t *testing.T) {
+		tools := ToolsConfig{
+			"python": ToolConfig{
+				Image:       "python:3",
+				TTY:         BoolAuto,
+				Interactive: BoolAuto,
+			},
+		}
+
+		res, err := Resolve("python", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, BoolAuto, res.TTY)
+		assert.Equal(t, BoolAuto, res.Interactive)
+
+		// Explicit values still take precedence over auto
+		res, err = Resolve("python", CLIOptions{TTY: BoolFalse, TTYSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, BoolFalse, res.TTY)
+
+		t.Setenv("CDERUN_INTERACTIVE", "AUTO")
+		res, err = Resolve("python", CLIOptions{}, ToolsConfig{"python": ToolConfig{Image: "python:3"}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, BoolFalse, res.TTY)
+		assert.Equal(t, BoolAuto, res.Interactive)
+
+		t.Setenv("CDERUN_INTERACTIVE", "maybe")
+		_, err = Resolve("python", CLIOptions{}, tools, nil)
+		assert.ErrorContains(t, err, "invalid interactive setting")
 	})
 
 	t.Run("Image resolution from ToolConfig", func(t *testing.T) {
@@ -261,4 +294,402 @@ func TestResolve(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "error", res.LogLevel)
 	})
+
+	t.Run("Secrets resolution", func(t *testing.T) {
+		tools := ToolsConfig{
+			"node": ToolConfig{
+				Image: "node:20",
+				Secrets: []SecretConfig{
+					{Name: "npm_token", Env: "NPM_TOKEN"},
+					{Name: "netrc", File: "~/.netrc", Target: "/root/.netrc"},
+				},
+			},
+		}
+
+		res, err := Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		require.Len(t, res.Secrets, 2)
+		assert.Equal(t, "env", res.Secrets[0].SourceType)
+		assert.Equal(t, "NPM_TOKEN", res.Secrets[0].Source)
+		assert.Equal(t, "/run/secrets/npm_token", res.Secrets[0].ContainerPath)
+		assert.Equal(t, "file", res.Secrets[1].SourceType)
+		assert.Equal(t, "/root/.netrc", res.Secrets[1].ContainerPath)
+	})
+
+	t.Run("Invalid secrets", func(t *testing.T) {
+		cases := map[string][]SecretConfig{
+			"exactly one of":        {{Name: "a", Env: "A", File: "/a"}},
+			"must not be empty":     {{Env: "A"}},
+			"invalid secret name":   {{Name: "../a", Env: "A"}},
+			"duplicate secret name": {{Name: "a", Env: "A"}, {Name: "a", Env: "B"}},
+		}
+		for msg, secrets := range cases {
+			tools := ToolsConfig{"node": ToolConfig{Image: "node", Secrets: secrets}}
+			_, err := Resolve("node", CLIOptions{}, tools, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), msg)
+		}
+	})
+
+	t.Run("Port resolution", func(t *testing.T) {
+		tools := ToolsConfig{
+			"python": ToolConfig{
+				Image: "python:3",
+				Ports: []string{"8000:8000"},
+			},
+		}
+		cli := CLIOptions{
+			Publish:       []string{"127.0.0.1:9000:9000/udp", "[::1]::3000", "5000-5001:6000-6001"},
+			CderunPublish: []string{"4000"},
+		}
+
+		res, err := Resolve("python", cli, tools, nil)
+		require.NoError(t, err)
+		require.Len(t, res.Ports, 6)
+		assert.Equal(t, container.PortMapping{HostPort: "8000", ContainerPort: "8000", Protocol: "tcp"}, res.Ports[0])
+		assert.Equal(t, container.PortMapping{HostIP: "127.0.0.1", HostPort: "9000", ContainerPort: "9000", Protocol: "udp"}, res.Ports[1])
+		assert.Equal(t, container.PortMapping{HostIP: "::1", ContainerPort: "3000", Protocol: "tcp"}, res.Ports[2])
+		assert.Equal(t, container.PortMapping{HostPort: "5001", ContainerPort: "6001", Protocol: "tcp"}, res.Ports[4])
+		assert.Equal(t, container.PortMapping{ContainerPort: "4000", Protocol: "tcp"}, res.Ports[5])
+		assert.False(t, res.PublishAll)
+	})
+
+	t.Run("Invalid port spec", func(t *testing.T) {
+		cli := CLIOptions{Publish: []string{"80:http"}}
+		_, err := Resolve("node", cli, ToolsConfig{"node": {Image: "node"}}, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid port spec "80:http"`)
+	})
+
+	t.Run("PublishAll resolution", func(t *testing.T) {
+		ptrTrue := ptr(true)
+		tools := ToolsConfig{"node": {Image: "node", PublishAll: ptrTrue}}
+		res, err := Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.True(t, res.PublishAll)
+
+		res, err = Resolve("node", CLIOptions{CderunPublishAll: false, CderunPublishAllSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.False(t, res.PublishAll)
+	})
+
+	t.Run("Network lifecycle resolution", func(t *testing.T) {
+		tools := ToolsConfig{
+			"pytest": ToolConfig{
+				Image:      "python:3",
+				Network:    NetworkConfig{Name: "proj-net", Create: true, Internal: true, Aliases: []string{"tests"}},
+				ExtraHosts: []string{"db:10.0.0.2"},
+			},
+		}
+		cli := CLIOptions{
+			NetworkAliases: []string{"runner"},
+			AddHosts:       []string{"host.docker.internal:host-gateway"},
+		}
+
+		res, err := Resolve("pytest", cli, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "proj-net", res.Network)
+		require.NotNil(t, res.NetworkCreate)
+		assert.Equal(t, container.NetworkSpec{Name: "proj-net", Internal: true}, *res.NetworkCreate)
+		assert.Equal(t, []string{"tests", "runner"}, res.NetworkAliases)
+		assert.Equal(t, []string{"db:10.0.0.2", "host.docker.internal:host-gateway"}, res.ExtraHosts)
+
+		// Overriding the network drops the tool's lifecycle options
+		cli.Network = "host"
+		cli.NetworkSet = true
+		res, err = Resolve("pytest", cli, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "host", res.Network)
+		assert.Nil(t, res.NetworkCreate)
+		assert.Equal(t, []string{"runner"}, res.NetworkAliases)
+	})
+
+	t.Run("Invalid extra host", func(t *testing.T) {
+		_, err := Resolve("node", CLIOptions{AddHosts: []string{"nohost"}}, ToolsConfig{"node": {Image: "node"}}, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid extra host "nohost"`)
+	})
+
+	t.Run("Services resolution", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "secret")
+		tools := ToolsConfig{
+			"pytest": ToolConfig{
+				Image: "python:3",
+				Services: map[string]ServiceConfig{
+					"redis": {Image: "redis:7"},
+					"db": {
+						Image: "postgres:16",
+						Env:   []string{"POSTGRES_PASSWORD=test", "DB_PASSWORD"},
+						Ports: []string{"5432"},
+						Healthcheck: &HealthcheckConfig{
+							Test:     HealthcheckTest{"pg_isready", "-U", "postgres"},
+							Interval: "2s",
+						},
+					},
+				},
+			},
+		}
+
+		res, err := Resolve("pytest", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		require.Len(t, res.Services, 2)
+		db := res.Services[0]
+		assert.Equal(t, "db", db.Name)
+		assert.Equal(t, []string{"POSTGRES_PASSWORD=test", "DB_PASSWORD=secret"}, db.Env)
+		assert.Equal(t, []container.PortMapping{{ContainerPort: "5432", Protocol: "tcp"}}, db.Ports)
+		assert.Equal(t, &container.Healthcheck{Test: []string{"CMD", "pg_isready", "-U", "postgres"}, Interval: "2s"}, db.Healthcheck)
+		assert.Equal(t, "redis", res.Services[1].Name)
+		assert.False(t, res.ServicesLogs)
+
+		res, err = Resolve("pytest", CLIOptions{ServicesLogs: true, ServicesLogsSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.True(t, res.ServicesLogs)
+	})
+
+	t.Run("KeepAlive resolution", func(t *testing.T) {
+		ptrTrue := ptr(true)
+		tools := ToolsConfig{"git": {Image: "alpine/git", KeepAlive: ptrTrue, KeepAliveCommand: []string{"tail", "-f", "/dev/null"}}}
+		res, err := Resolve("git", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.True(t, res.KeepAlive)
+		assert.Equal(t, "15m", res.IdleTimeout)
+		assert.Equal(t, []string{"tail", "-f", "/dev/null"}, res.KeepAliveCommand)
+
+		t.Setenv("CDERUN_IDLE_TIMEOUT", "1h")
+		res, err = Resolve("git", CLIOptions{CderunKeepAlive: false, CderunKeepAliveSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.False(t, res.KeepAlive)
+		assert.Equal(t, "1h", res.IdleTimeout)
+
+		t.Setenv("CDERUN_IDLE_TIMEOUT", "forever")
+		_, err = Resolve("git", CLIOptions{}, tools, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid idle timeout "forever"`)
+	})
+
+	t.Run("ForwardSignals resolution", func(t *testing.T) {
+		tools := ToolsConfig{"node": {Image: "node:20", ForwardSignals: []string{"hup", "SIGUSR1", "HUP"}}}
+		res, err := Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"SIGHUP", "SIGUSR1"}, res.ForwardSignals)
+
+		res, err = Resolve("node", CLIOptions{}, ToolsConfig{"node": {Image: "node:20"}}, nil)
+		require.NoError(t, err)
+		assert.Contains(t, res.ForwardSignals, "SIGQUIT")
+
+		t.Setenv("CDERUN_FORWARD_SIGNALS", "INT, term")
+		res, err = Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"SIGINT", "SIGTERM"}, res.ForwardSignals)
+
+		t.Setenv("CDERUN_FORWARD_SIGNALS", "SIGKILL")
+		_, err = Resolve("node", CLIOptions{}, tools, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `signal "SIGKILL" cannot be forwarded`)
+	})
+
+	t.Run("Stop settings resolution", func(t *testing.T) {
+		tools := ToolsConfig{"nginx": {Image: "nginx", StopSignal: "quit", StopTimeout: "30s"}}
+		res, err := Resolve("nginx", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "SIGQUIT", res.StopSignal)
+		assert.Equal(t, "30s", res.StopTimeout)
+
+		res, err = Resolve("nginx", CLIOptions{}, ToolsConfig{"nginx": {Image: "nginx"}}, nil)
+		require.NoError(t, err)
+		assert.Empty(t, res.StopSignal)
+		assert.Equal(t, "10s", res.StopTimeout)
+
+		t.Setenv("CDERUN_STOP_TIMEOUT", "-1s")
+		_, err = Resolve("nginx", CLIOptions{}, tools, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid stop timeout "-1s"`)
+	})
+
+	t.Run("DetachKeys resolution", func(t *testing.T) {
+		tools := ToolsConfig{"python": ToolConfig{Image: "python:3", DetachKeys: "ctrl-x,x"}}
+
+		res, err := Resolve("node", CLIOptions{Image: "node", ImageSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ctrl-p,ctrl-q", res.DetachKeys)
+
+		res, err = Resolve("python", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ctrl-x,x", res.DetachKeys)
+
+		keys, err := ResolveDetachKeys("python", CLIOptions{DetachKeys: "ctrl-a", DetachKeysSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ctrl-a", keys)
+
+		t.Setenv("CDERUN_DETACH_KEYS", "ctrl-")
+		_, err = Resolve("python", CLIOptions{}, tools, nil)
+		assert.ErrorContains(t, err, "invalid detach keys")
+	})
+
+	t.Run("DrainTimeout resolution", func(t *testing.T) {
+		tools := ToolsConfig{"pytest": ToolConfig{Image: "python:3", DrainTimeout: "30s"}}
+
+		res, err := Resolve("node", CLIOptions{Image: "node", ImageSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "5s", res.DrainTimeout)
+
+		res, err = Resolve("pytest", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "30s", res.DrainTimeout)
+
+		timeout, err := ResolveDrainTimeout("pytest", CLIOptions{DrainTimeout: "0", DrainTimeoutSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "0", timeout)
+
+		t.Setenv("CDERUN_DRAIN_TIMEOUT", "-1s")
+		_, err = Resolve("pytest", CLIOptions{}, tools, nil)
+		assert.ErrorContains(t, err, "invalid drain timeout")
+	})
+
+	t.Run("SplitStreams resolution", func(t *testing.T) {
+		tools := ToolsConfig{"pytest": ToolConfig{Image: "python:3", SplitStreams: ptr(true)}}
+
+		res, err := Resolve("node", CLIOptions{Image: "node", ImageSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.False(t, res.SplitStreams)
+
+		res, err = Resolve("pytest", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.True(t, res.SplitStreams)
+
+		res, err = Resolve("pytest", CLIOptions{SplitStreams: false, SplitStreamsSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.False(t, res.SplitStreams)
+
+		global := &CDERunConfig{Defaults: ConfigDefaults{SplitStreams: ptr(true)}}
+		res, err = Resolve("node", CLIOptions{Image: "node", ImageSet: true}, tools, global)
+		require.NoError(t, err)
+		assert.True(t, res.SplitStreams)
+	})
+
+	t.Run("Output capture resolution", func(t *testing.T) {
+		tools := ToolsConfig{"pytest": ToolConfig{Image: "python:3", OutputLog: "pytest.log", Capture: CaptureConfig{Stdout: "tool-out.log", Stderr: "tool-err.log"}}}
+
+		res, err := Resolve("pytest", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "pytest.log", res.OutputLog)
+		assert.Equal(t, "text", res.OutputLogFormat)
+		assert.Equal(t, "tool-out.log", res.CaptureStdout)
+		assert.Equal(t, "tool-err.log", res.CaptureStderr)
+
+		// Each stream is resolved separately
+		t.Setenv("CDERUN_CAPTURE_STDERR", "env-err.log")
+		res, err = Resolve("pytest", CLIOptions{Capture: []string{"stdout=cli-out.log"}}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "cli-out.log", res.CaptureStdout)
+		assert.Equal(t, "env-err.log", res.CaptureStderr)
+
+		res, err = Resolve("pytest", CLIOptions{
+			Capture:       []string{"stdout=cli-out.log"},
+			CderunCapture: []string{"STDOUT=override.log"},
+		}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "override.log", res.CaptureStdout)
+
+		global := &CDERunConfig{Defaults: ConfigDefaults{OutputLogFormat: "JSONL"}}
+		res, err = Resolve("pytest", CLIOptions{}, tools, global)
+		require.NoError(t, err)
+		assert.Equal(t, "jsonl", res.OutputLogFormat)
+
+		_, err = Resolve("pytest", CLIOptions{OutputLogFormat: "xml", OutputLogFormatSet: true}, tools, nil)
+		assert.ErrorContains(t, err, "invalid output log format")
+
+		for _, v := range []string{"stdout", "stdout=", "stdin=in.log"} {
+			_, err = Resolve("pytest", CLIOptions{Capture: []string{v}}, tools, nil)
+			assert.ErrorContains(t, err, "invalid capture", v)
+		}
+	})
+
+	t.Run("Build resolution", func(t *testing.T) {
+		tools := ToolsConfig{
+			"lint": {Build: &BuildConfig{Context: "tools/lint"}},
+			"test": {Image: "registry.local/test", Build: &BuildConfig{Context: "/srv/test", Dockerfile: "Dockerfile.ci", Target: "ci"}},
+		}
+
+		res, err := Resolve("lint", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		require.NotNil(t, res.Build)
+		cwd, _ := os.Getwd()
+		assert.Equal(t, filepath.Join(cwd, "tools", "lint"), res.Build.Context)
+		assert.Equal(t, "Dockerfile", res.Build.Dockerfile)
+		assert.Empty(t, res.Image)
+
+		res, err = Resolve("test", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "registry.local/test", res.Image)
+		assert.Equal(t, &BuildConfig{Context: filepath.Clean("/srv/test"), Dockerfile: "Dockerfile.ci", Target: "ci"}, res.Build)
+
+		// An image given on the command line is used as-is
+		res, err = Resolve("lint", CLIOptions{Image: "golangci/golangci-lint", ImageSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Nil(t, res.Build)
+		assert.Equal(t, "golangci/golangci-lint", res.Image)
+	})
+
+	t.Run("Packages resolution", func(t *testing.T) {
+		tools := ToolsConfig{
+			"node": {Image: "node:20", Packages: []string{"jq", "git"}, PackageManager: "apt"},
+			"lint": {Build: &BuildConfig{Context: "tools/lint"}, Packages: []string{"jq"}},
+		}
+
+		res, err := Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "node:20", res.Image)
+		assert.Equal(t, []string{"jq", "git"}, res.Packages)
+		assert.Equal(t, "apt", res.PackageManager)
+
+		// Packages are also installed on top of an image given on the command line
+		res, err = Resolve("node", CLIOptions{Image: "node:22", ImageSet: true}, tools, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "node:22", res.Image)
+		assert.Equal(t, []string{"jq", "git"}, res.Packages)
+
+		_, err = Resolve("lint", CLIOptions{}, tools, nil)
+		assert.ErrorContains(t, err, "packages cannot be combined with build")
+	})
+
+	t.Run("ReapOrphans resolution", func(t *testing.T) {
+		tools := ToolsConfig{"node": {Image: "node:20"}}
+		res, err := Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.True(t, res.ReapOrphans, "orphans are reaped on startup by default")
+
+		global := &CDERunConfig{ReapOrphans: ptr(false)}
+		res, err = Resolve("node", CLIOptions{}, tools, global)
+		require.NoError(t, err)
+		assert.False(t, res.ReapOrphans)
+
+		t.Setenv("CDERUN_REAP_ORPHANS", "true")
+		res, err = Resolve("node", CLIOptions{}, tools, global)
+		require.NoError(t, err)
+		assert.True(t, res.ReapOrphans)
+
+		t.Setenv("CDERUN_REAP_ORPHANS", "false")
+		res, err = Resolve("node", CLIOptions{}, tools, nil)
+		require.NoError(t, err)
+		assert.False(t, res.ReapOrphans)
+	})
+
+	t.Run("Invalid services", func(t *testing.T) {
+		cases := map[string]ServiceConfig{
+			"missing image":     {},
+			"invalid duration":  {Image: "redis", Healthcheck: &HealthcheckConfig{Test: HealthcheckTest{"CMD-SHELL", "true"}, Timeout: "soon"}},
+			"empty healthcheck": {Image: "redis", Healthcheck: &HealthcheckConfig{}},
+		}
+		for name, svc := range cases {
+			tools := ToolsConfig{"pytest": {Image: "python:3", Services: map[string]ServiceConfig{"svc": svc}}}
+			_, err := Resolve("pytest", CLIOptions{}, tools, nil)
+			assert.Error(t, err, name)
+		}
+
+		tools := ToolsConfig{"pytest": {Image: "python:3", Services: map[string]ServiceConfig{"-bad": {Image: "redis"}}}}
+		_, err := Resolve("pytest", CLIOptions{}, tools, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid service name "-bad"`)
+	})
 }
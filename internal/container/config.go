@@ -3,17 +3,31 @@ package container
 // ContainerConfig represents the intermediate representation of a container execution request.
 type ContainerConfig struct {
 	// Basic settings
-	Image   string   `json:"image" yaml:"image"`
-	Command []string `json:"command" yaml:"command"`
-	Args    []string `json:"args" yaml:"args"`
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Image      string   `json:"image" yaml:"image"`
+	Entrypoint []string `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	Command    []string `json:"command" yaml:"command"`
+	Args       []string `json:"args" yaml:"args"`
 
 	// Execution options
 	TTY         bool `json:"tty" yaml:"tty"`
 	Interactive bool `json:"interactive" yaml:"interactive"`
 	Remove      bool `json:"remove" yaml:"remove"`
 
+	// Graceful stop: signal sent first and time before SIGKILL (e.g. "10s")
+	StopSignal  string `json:"stop_signal,omitempty" yaml:"stop_signal,omitempty"`
+	StopTimeout string `json:"stop_timeout,omitempty" yaml:"stop_timeout,omitempty"`
+
 	// Network
-	Network string `json:"network" yaml:"network"`
+	Network        string       `json:"network" yaml:"network"`
+	NetworkAliases []string     `json:"network_aliases,omitempty" yaml:"network_aliases,omitempty"`
+	NetworkCreate  *NetworkSpec `json:"network_create,omitempty" yaml:"network_create,omitempty"`
+	ExtraNetworks  []string     `json:"extra_networks,omitempty" yaml:"extra_networks,omitempty"`
+	ExtraHosts     []string     `json:"extra_hosts,omitempty" yaml:"extra_hosts,omitempty"`
+
+	// Published ports
+	Ports      []PortMapping `json:"ports,omitempty" yaml:"ports,omitempty"`
+	PublishAll bool          `json:"publish_all,omitempty" yaml:"publish_all,omitempty"`
 
 	// Volumes
 	Volumes []VolumeMount `json:"volumes" yaml:"volumes"`
@@ -26,6 +40,24 @@ type ContainerConfig struct {
 
 	// User
 	User string `json:"user" yaml:"user"`
+
+	// Secrets mounted as read-only files (values are never stored here)
+	Secrets []SecretMount `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+
+	// Healthcheck overrides the image's healthcheck
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+
+	// Sidecar services started on a private network before this container
+	Services []ServiceSpec `json:"services,omitempty" yaml:"services,omitempty"`
+
+	// Labels attached to the container
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// KeepAlive runs the command in a reusable long-lived container
+	KeepAlive *KeepAliveSpec `json:"keep_alive,omitempty" yaml:"keep_alive,omitempty"`
+
+	// Build creates Image from a Dockerfile when it does not exist yet
+	Build *BuildSpec `json:"build,omitempty" yaml:"build,omitempty"`
 }
 
 // VolumeMount represents a host path to container path mapping.
@@ -34,3 +66,81 @@ type VolumeMount struct {
 	ContainerPath string `json:"container_path" yaml:"container_path"`
 	ReadOnly      bool   `json:"read_only" yaml:"read_only"`
 }
+
+// SecretMount represents a secret exposed to the container as a read-only file.
+// Only a reference to the source is kept; the value is read on the host right
+// before the container is created.
+type SecretMount struct {
+	Name          string `json:"name" yaml:"name"`
+	SourceType    string `json:"source_type" yaml:"source_type"` // "file", "env" or "command"
+	Source        string `json:"source" yaml:"source"`
+	ContainerPath string `json:"container_path" yaml:"container_path"`
+}
+
+// PortMapping represents a container port published on the host.
+// An empty HostPort lets the runtime pick a free port.
+type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty" yaml:"host_ip,omitempty"`
+	HostPort      string `json:"host_port" yaml:"host_port"`
+	ContainerPort string `json:"container_port" yaml:"container_port"`
+	Protocol      string `json:"protocol" yaml:"protocol"`
+}
+
+// NetworkSpec describes a user-defined network that is created on demand.
+type NetworkSpec struct {
+	Name     string            `json:"name" yaml:"name"`
+	Internal bool              `json:"internal" yaml:"internal"`
+	Remove   bool              `json:"remove" yaml:"remove"` // Remove after the run if no container uses it
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// ServiceSpec describes a sidecar container. It joins the same private network
+// as the main container and is reachable under its Name.
+type ServiceSpec struct {
+	Name        string        `json:"name" yaml:"name"`
+	Image       string        `json:"image" yaml:"image"`
+	Command     []string      `json:"command,omitempty" yaml:"command,omitempty"`
+	Env         []string      `json:"env,omitempty" yaml:"env,omitempty"`
+	Ports       []PortMapping `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Healthcheck *Healthcheck  `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+}
+
+// Healthcheck describes how the runtime checks that a container is healthy.
+// Durations are kept in Go duration syntax so that dry-run output stays readable.
+type Healthcheck struct {
+	Test        []string `json:"test" yaml:"test"`
+	Interval    string   `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout     string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries     int      `json:"retries,omitempty" yaml:"retries,omitempty"`
+	StartPeriod string   `json:"start_period,omitempty" yaml:"start_period,omitempty"`
+}
+
+// KeepAliveSpec describes a long-lived container that is reused across runs.
+// Commands are executed in it with ExecContainer instead of creating a new container.
+type KeepAliveSpec struct {
+	Name        string   `json:"name" yaml:"name"`
+	IdleTimeout string   `json:"idle_timeout" yaml:"idle_timeout"`
+	Command     []string `json:"command" yaml:"command"` // Keeps the container running, the idle timer if empty
+}
+
+// BuildSpec describes an image built from a Dockerfile. The image is tagged with
+// a hash of its inputs, so it is only rebuilt when they change.
+type BuildSpec struct {
+	Context    string            `json:"context,omitempty" yaml:"context,omitempty"` // Absolute path on the host
+	Dockerfile string            `json:"dockerfile" yaml:"dockerfile"`               // Relative to Context
+	Args       map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+	Target     string            `json:"target,omitempty" yaml:"target,omitempty"`
+	// Inline is a generated Dockerfile (e.g. for packages). It is built without
+	// a context, so Context is empty.
+	Inline string `json:"inline,omitempty" yaml:"inline,omitempty"`
+}
+
+// ExecConfig represents a command executed in a running container.
+type ExecConfig struct {
+	Command     []string `json:"command" yaml:"command"`
+	TTY         bool     `json:"tty" yaml:"tty"`
+	Interactive bool     `json:"interactive" yaml:"interactive"`
+	Env         []string `json:"env,omitempty" yaml:"env,omitempty"`
+	Workdir     string   `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	User        string   `json:"user,omitempty" yaml:"user,omitempty"`
+}
@@ -1,16 +1,29 @@
 package runtime
 
 import (
+	"cderun/internal/build"
 	"cderun/internal/container"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	dockerbuild "github.com/docker/docker/api/types/build"
 	dockercontainer "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/moby/term"
 )
 
 // DockerRuntime implements ContainerRuntime using Docker Engine API.
@@ -39,17 +52,68 @@ func NewDockerRuntime(socket string) (*DockerRuntime, error) {
 func (d *DockerRuntime) CreateContainer(ctx context.Context, config *container.ContainerConfig) (string, error) {
 	containerConfig := &dockercontainer.Config{
 		Image:      config.Image,
+		Entrypoint: config.Entrypoint,
 		Cmd:        append(config.Command, config.Args...),
 		Tty:        config.TTY,
 		OpenStdin:  config.Interactive,
+		// Close the container's stdin when the attached client closes its end, so
+		// EOF reaches tools reading piped input. TTY sessions keep stdin open.
+		StdinOnce:  config.Interactive && !config.TTY,
 		Env:        config.Env,
 		WorkingDir: config.Workdir,
 		User:       config.User,
+		Labels:     config.Labels,
+		StopSignal: config.StopSignal,
+	}
+	if config.StopTimeout != "" {
+		timeout, err := time.ParseDuration(config.StopTimeout)
+		if err != nil {
+			return "", fmt.Errorf("invalid stop timeout %q: %w", config.StopTimeout, err)
+		}
+		seconds := stopSeconds(timeout)
+		containerConfig.StopTimeout = &seconds
 	}
 
 	hostConfig := &dockercontainer.HostConfig{
-		AutoRemove:  config.Remove,
-		NetworkMode: dockercontainer.NetworkMode(config.Network),
+		// No AutoRemove: the container must outlive its exit so cderun can drain
+		// its output and inspect it for OOMKilled. cderun removes it itself, and
+		// the containers of a crashed cderun are reaped when cderun next starts.
+		NetworkMode:     dockercontainer.NetworkMode(config.Network),
+		PublishAllPorts: config.PublishAll,
+		ExtraHosts:      config.ExtraHosts,
+	}
+
+	if config.Healthcheck != nil {
+		healthcheck, err := toHealthConfig(config.Healthcheck)
+		if err != nil {
+			return "", err
+		}
+		containerConfig.Healthcheck = healthcheck
+	}
+
+	var networkingConfig *network.NetworkingConfig
+	if len(config.NetworkAliases) > 0 {
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				config.Network: {Aliases: config.NetworkAliases},
+			},
+		}
+	}
+
+	if len(config.Ports) > 0 {
+		containerConfig.ExposedPorts = nat.PortSet{}
+		hostConfig.PortBindings = nat.PortMap{}
+		for _, p := range config.Ports {
+			port, err := nat.NewPort(p.Protocol, p.ContainerPort)
+			if err != nil {
+				return "", fmt.Errorf("invalid port %s/%s: %w", p.ContainerPort, p.Protocol, err)
+			}
+			containerConfig.ExposedPorts[port] = struct{}{}
+			hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], nat.PortBinding{
+				HostIP:   p.HostIP,
+				HostPort: p.HostPort,
+			})
+		}
 	}
 
 	for _, vol := range config.Volumes {
@@ -62,17 +126,43 @@ func (d *DockerRuntime) CreateContainer(ctx context.Context, config *container.C
 		hostConfig.Mounts = append(hostConfig.Mounts, m)
 	}
 
-	resp, err := d.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	resp, err := d.client.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, config.Name)
 	if err != nil {
 		return "", err
 	}
 
+	for _, name := range config.ExtraNetworks {
+		if err := d.client.NetworkConnect(ctx, name, resp.ID, nil); err != nil {
+			_ = d.client.ContainerRemove(context.WithoutCancel(ctx), resp.ID, dockercontainer.RemoveOptions{Force: true})
+			return "", fmt.Errorf("failed to connect container to network %s: %w", name, err)
+		}
+	}
+
 	return resp.ID, nil
 }
 
 // StartContainer starts a created container.
 func (d *DockerRuntime) StartContainer(ctx context.Context, containerID string) error {
-	return d.client.ContainerStart(ctx, containerID, dockercontainer.StartOptions{})
+	return classifyStartError(d.client.ContainerStart(ctx, containerID, dockercontainer.StartOptions{}))
+}
+
+// classifyStartError wraps errors caused by the container's command with
+// ErrCommandNotFound or ErrCommandNotExecutable, matching the docker CLI.
+func classifyStartError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "executable file not found"),
+		strings.Contains(msg, "no such file or directory"),
+		strings.Contains(msg, "system cannot find the file specified"):
+		return fmt.Errorf("%w: %v", ErrCommandNotFound, err)
+	case strings.Contains(msg, "permission denied"),
+		strings.Contains(msg, "is a directory"):
+		return fmt.Errorf("%w: %v", ErrCommandNotExecutable, err)
+	}
+	return err
 }
 
 // WaitContainer waits for a container to exit and returns its exit code.
@@ -93,7 +183,6 @@ func (d *DockerRuntime) RemoveContainer(ctx context.Context, containerID string)
 	})
 	if err != nil {
 		// Suppress errors if the container is already gone or removal is already in progress.
-		// This can happen when AutoRemove is enabled and the container finishes before the defer block runs.
 		if errdefs.IsNotFound(err) || errdefs.IsConflict(err) {
 			return nil
 		}
@@ -101,6 +190,27 @@ func (d *DockerRuntime) RemoveContainer(ctx context.Context, containerID string)
 	return err
 }
 
+// StopContainer sends the container's stop signal and kills it if it has not
+// exited after timeout.
+func (d *DockerRuntime) StopContainer(ctx context.Context, containerID string, timeout time.Duration) error {
+	seconds := stopSeconds(timeout)
+	err := d.client.ContainerStop(ctx, containerID, dockercontainer.StopOptions{Timeout: &seconds})
+	if err != nil && errdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// stopSeconds rounds a stop timeout up to whole seconds as the Engine API expects.
+func stopSeconds(timeout time.Duration) int {
+	return int((timeout + time.Second - 1) / time.Second)
+}
+
+// RenameContainer changes the name of a container.
+func (d *DockerRuntime) RenameContainer(ctx context.Context, containerID string, name string) error {
+	return d.client.ContainerRename(ctx, containerID, name)
+}
+
 // ResizeContainerTTY resizes the terminal of a container.
 func (d *DockerRuntime) ResizeContainerTTY(ctx context.Context, containerID string, rows, cols uint) error {
 	return d.client.ContainerResize(ctx, containerID, dockercontainer.ResizeOptions{
@@ -121,8 +231,42 @@ func (d *DockerRuntime) SignalContainer(ctx context.Context, containerID string,
 	return err
 }
 
+// ContainerLogs copies the logs of a container to stdout and stderr.
+// With follow set it keeps streaming until the container stops or ctx is canceled.
+func (d *DockerRuntime) ContainerLogs(ctx context.Context, containerID string, follow bool, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	resp, err := d.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	logs, err := d.client.ContainerLogs(ctx, containerID, dockercontainer.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	if resp.Config != nil && resp.Config.Tty {
+		_, err = io.Copy(stdout, logs)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	}
+	return err
+}
+
 // AttachContainer attaches to a container's IO streams.
-func (d *DockerRuntime) AttachContainer(ctx context.Context, containerID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+// With a TTY and detach keys, typing the key sequence returns ErrDetached.
+func (d *DockerRuntime) AttachContainer(ctx context.Context, containerID string, opts AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
 	if stdout == nil {
 		stdout = io.Discard
 	}
@@ -130,16 +274,33 @@ func (d *DockerRuntime) AttachContainer(ctx context.Context, containerID string,
 		stderr = io.Discard
 	}
 
+	if stdin != nil && opts.TTY && opts.DetachKeys != "" {
+		// Detect the sequence on the client like the docker CLI, the daemon would
+		// only close the stream without telling us why
+		keys, err := term.ToBytes(opts.DetachKeys)
+		if err != nil {
+			return fmt.Errorf("invalid detach keys %q: %w", opts.DetachKeys, err)
+		}
+		stdin = term.NewEscapeProxy(stdin, keys)
+	}
+
 	resp, err := d.client.ContainerAttach(ctx, containerID, dockercontainer.AttachOptions{
-		Stream: true,
-		Logs:   true,
-		Stdin:  stdin != nil,
-		Stdout: true,
-		Stderr: true,
+		Stream:     true,
+		Logs:       opts.Logs,
+		Stdin:      stdin != nil,
+		Stdout:     true,
+		Stderr:     true,
+		DetachKeys: opts.DetachKeys,
 	})
 	if err != nil {
 		return err
 	}
+	return streamHijacked(ctx, resp, opts.TTY, stdin, stdout, stderr)
+}
+
+// streamHijacked copies IO between a hijacked connection and the local streams
+// until the output ends or ctx is canceled.
+func streamHijacked(ctx context.Context, resp types.HijackedResponse, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
 	defer resp.Close()
 
 	var stdinErr error
@@ -148,6 +309,11 @@ func (d *DockerRuntime) AttachContainer(ctx context.Context, containerID string,
 	if stdin != nil {
 		go func() {
 			_, stdinErr = io.Copy(resp.Conn, stdin)
+			if errors.As(stdinErr, &term.EscapeError{}) {
+				// Detached: leave the container's stdin open for a later attach
+				close(stdinDone)
+				return
+			}
 			if err := resp.CloseWrite(); err != nil {
 				// Logging the error could be useful but we are limited in where to log.
 				// For now we just ensure EOF is signaled.
@@ -175,6 +341,9 @@ func (d *DockerRuntime) AttachContainer(ctx context.Context, containerID string,
 	case err := <-outputDone:
 		return err
 	case <-stdinDone:
+		if errors.As(stdinErr, &term.EscapeError{}) {
+			return ErrDetached
+		}
 		if stdinErr != nil {
 			return stdinErr
 		}
@@ -192,6 +361,295 @@ func (d *DockerRuntime) AttachContainer(ctx context.Context, containerID string,
 	}
 }
 
+// ExecContainer creates an exec session for a command in a running container and returns its ID.
+func (d *DockerRuntime) ExecContainer(ctx context.Context, containerID string, config *container.ExecConfig) (string, error) {
+	resp, err := d.client.ContainerExecCreate(ctx, containerID, dockercontainer.ExecOptions{
+		Cmd:          config.Command,
+		Tty:          config.TTY,
+		AttachStdin:  config.Interactive,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          config.Env,
+		WorkingDir:   config.Workdir,
+		User:         config.User,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// AttachExec starts an exec session and streams its IO until the command finishes.
+func (d *DockerRuntime) AttachExec(ctx context.Context, execID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	resp, err := d.client.ContainerExecAttach(ctx, execID, dockercontainer.ExecAttachOptions{Tty: tty})
+	if err != nil {
+		return err
+	}
+	return streamHijacked(ctx, resp, tty, stdin, stdout, stderr)
+}
+
+// ResizeExecTTY resizes the terminal of an exec session.
+func (d *DockerRuntime) ResizeExecTTY(ctx context.Context, execID string, rows, cols uint) error {
+	return d.client.ContainerExecResize(ctx, execID, dockercontainer.ResizeOptions{
+		Height: rows,
+		Width:  cols,
+	})
+}
+
+// WaitExec waits for an exec session to finish and returns its exit code.
+// The Engine API has no wait endpoint for exec sessions, so it is polled.
+func (d *DockerRuntime) WaitExec(ctx context.Context, execID string) (int, error) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		resp, err := d.client.ContainerExecInspect(ctx, execID)
+		if err != nil {
+			return 0, err
+		}
+		if !resp.Running {
+			return resp.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ImageExists reports whether an image with the given reference exists locally.
+func (d *DockerRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	_, err := d.client.ImageInspect(ctx, ref)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// BuildImage builds an image from a Dockerfile and tags it. The build progress is
+// written to output as plain text.
+func (d *DockerRuntime) BuildImage(ctx context.Context, spec *container.BuildSpec, tag string, output io.Writer) error {
+	if output == nil {
+		output = io.Discard
+	}
+
+	// Stream the context while the daemon reads it instead of buffering it in memory
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(build.Tar(spec, pw))
+	}()
+	defer pr.Close()
+
+	args := make(map[string]*string, len(spec.Args))
+	for k, v := range spec.Args {
+		args[k] = &v
+	}
+	resp, err := d.client.ImageBuild(ctx, pr, dockerbuild.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  filepath.ToSlash(spec.Dockerfile),
+		BuildArgs:   args,
+		Target:      spec.Target,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Returns the error of a failed build step
+	return jsonmessage.DisplayJSONMessagesStream(resp.Body, output, 0, false, nil)
+}
+
+// NetworkExists reports whether a network with the given name or ID exists.
+func (d *DockerRuntime) NetworkExists(ctx context.Context, name string) (bool, error) {
+	_, err := d.client.NetworkInspect(ctx, name, network.InspectOptions{})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateNetwork creates a bridge network.
+func (d *DockerRuntime) CreateNetwork(ctx context.Context, spec *container.NetworkSpec) error {
+	_, err := d.client.NetworkCreate(ctx, spec.Name, network.CreateOptions{
+		Driver:   "bridge",
+		Internal: spec.Internal,
+		Labels:   spec.Labels,
+	})
+	return err
+}
+
+// RemoveNetwork removes a network. It returns ErrNetworkInUse if containers are still attached.
+func (d *DockerRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	err := d.client.NetworkRemove(ctx, name)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		// The daemon reports active endpoints as forbidden (older versions) or conflict.
+		if errdefs.IsForbidden(err) || errdefs.IsConflict(err) {
+			return fmt.Errorf("%w: %v", ErrNetworkInUse, err)
+		}
+	}
+	return err
+}
+
+// InspectContainer returns the current state of a container.
+func (d *DockerRuntime) InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error) {
+	resp, err := d.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %v", ErrContainerNotFound, err)
+		}
+		return nil, err
+	}
+
+	info := &ContainerInfo{ID: resp.ID, Name: strings.TrimPrefix(resp.Name, "/")}
+	if t, err := time.Parse(time.RFC3339Nano, resp.Created); err == nil {
+		info.Created = t
+	}
+	if resp.Config != nil {
+		info.Image = resp.Config.Image
+		info.Labels = resp.Config.Labels
+		info.TTY = resp.Config.Tty
+		info.OpenStdin = resp.Config.OpenStdin
+	}
+	if resp.State != nil {
+		info.Running = resp.State.Running
+		info.Status = string(resp.State.Status)
+		info.ExitCode = resp.State.ExitCode
+		info.OOMKilled = resp.State.OOMKilled
+		if resp.State.Health != nil {
+			info.Health = string(resp.State.Health.Status)
+		}
+	}
+	if resp.NetworkSettings != nil {
+		for port, bindings := range resp.NetworkSettings.Ports {
+			for _, b := range bindings {
+				info.Ports = append(info.Ports, container.PortMapping{
+					HostIP:        b.HostIP,
+					HostPort:      b.HostPort,
+					ContainerPort: port.Port(),
+					Protocol:      port.Proto(),
+				})
+			}
+		}
+		sortPorts(info.Ports)
+	}
+	return info, nil
+}
+
+// sortPorts orders port mappings numerically by container port, then by
+// protocol and host IP.
+func sortPorts(ports []container.PortMapping) {
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.ContainerPort != b.ContainerPort {
+			return nat.Port(a.ContainerPort+"/"+a.Protocol).Int() < nat.Port(b.ContainerPort+"/"+b.Protocol).Int()
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.HostIP < b.HostIP
+	})
+}
+
+// toHealthConfig converts a healthcheck into the Docker representation.
+func toHealthConfig(h *container.Healthcheck) (*dockercontainer.HealthConfig, error) {
+	hc := &dockercontainer.HealthConfig{
+		Test:    h.Test,
+		Retries: h.Retries,
+	}
+	for _, d := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{h.Interval, &hc.Interval},
+		{h.Timeout, &hc.Timeout},
+		{h.StartPeriod, &hc.StartPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck duration %q: %w", d.value, err)
+		}
+		*d.target = v
+	}
+	return hc, nil
+}
+
+// ListContainers returns the containers matching the filter, newest first.
+func (d *DockerRuntime) ListContainers(ctx context.Context, filter ContainerFilter) ([]ContainerInfo, error) {
+	args := filters.NewArgs()
+	for k, v := range filter.Labels {
+		if v == "" {
+			args.Add("label", k)
+		} else {
+			args.Add("label", k+"="+v)
+		}
+	}
+	list, err := d.client.ContainerList(ctx, dockercontainer.ListOptions{
+		All:     filter.All,
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []ContainerInfo
+	for _, c := range list {
+		info := ContainerInfo{
+			ID:      c.ID,
+			Image:   c.Image,
+			Created: time.Unix(c.Created, 0),
+			Status:  string(c.State),
+			Running: c.State == dockercontainer.StateRunning,
+			Labels:  c.Labels,
+		}
+		if len(c.Names) > 0 {
+			info.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Info returns the version of the daemon and whether it runs rootless.
+func (d *DockerRuntime) Info(ctx context.Context) (*RuntimeInfo, error) {
+	info, err := d.client.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daemon info: %w", err)
+	}
+	res := &RuntimeInfo{
+		ServerVersion: info.ServerVersion,
+		APIVersion:    d.client.ClientVersion(), // Negotiated by the request above
+		OS:            info.OSType,
+		Arch:          info.Architecture,
+	}
+	for _, opt := range info.SecurityOptions {
+		if strings.Contains(opt, "name=rootless") {
+			res.Rootless = true
+		}
+	}
+	return res, nil
+}
+
 // Name returns the name of the runtime.
 func (d *DockerRuntime) Name() string {
 	return "docker"
@@ -1,9 +1,22 @@
 package runtime
 
 import (
+	"bytes"
+	"cderun/internal/container"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/term"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDockerRuntime(t *testing.T) {
@@ -13,3 +26,106 @@ func TestNewDockerRuntime(t *testing.T) {
 	assert.NotNil(t, runtime)
 	assert.Equal(t, "docker", runtime.Name())
 }
+
+func TestClassifyStartError(t *testing.T) {
+	assert.NoError(t, classifyStartError(nil))
+
+	err := classifyStartError(errors.New(`Error response from daemon: failed to create task for container: exec: "nope": executable file not found in $PATH: unknown`))
+	assert.ErrorIs(t, err, ErrCommandNotFound)
+
+	err = classifyStartError(errors.New(`exec: "/etc": permission denied: unknown`))
+	assert.ErrorIs(t, err, ErrCommandNotExecutable)
+
+	err = classifyStartError(errors.New("driver failed programming external connectivity"))
+	assert.NotErrorIs(t, err, ErrCommandNotFound)
+	assert.NotErrorIs(t, err, ErrCommandNotExecutable)
+}
+
+func TestSortPorts(t *testing.T) {
+	ports := []container.PortMapping{
+		{ContainerPort: "8080", Protocol: "tcp"},
+		{ContainerPort: "443", Protocol: "tcp", HostIP: "::"},
+		{ContainerPort: "53", Protocol: "udp"},
+		{ContainerPort: "443", Protocol: "tcp", HostIP: "0.0.0.0"},
+		{ContainerPort: "53", Protocol: "tcp"},
+		{ContainerPort: "9000", Protocol: "tcp"},
+	}
+	sortPorts(ports)
+
+	var got []string
+	for _, p := range ports {
+		got = append(got, p.HostIP+" "+p.ContainerPort+"/"+p.Protocol)
+	}
+	assert.Equal(t, []string{
+		" 53/tcp", " 53/udp", "0.0.0.0 443/tcp", ":: 443/tcp", " 8080/tcp", " 9000/tcp",
+	}, got)
+}
+
+func TestStreamHijackedPropagatesStdinEOF(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// Fake daemon side: read stdin until EOF (CloseWrite), then answer on stdout
+	// and stderr with the multiplexed stream format and close the connection.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		input, _ := io.ReadAll(conn)
+		fmt.Fprintf(stdcopy.NewStdWriter(conn, stdcopy.Stdout), "%d bytes", len(input))
+		fmt.Fprint(stdcopy.NewStdWriter(conn, stdcopy.Stderr), "done")
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	resp := types.NewHijackedResponse(conn, "")
+
+	var stdout, stderr bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = streamHijacked(ctx, resp, false, strings.NewReader("hello\nworld\n"), &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "12 bytes", stdout.String())
+	assert.Equal(t, "done", stderr.String())
+}
+
+func TestStreamHijackedDetach(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// Fake daemon side: record stdin until the client goes away
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		input, _ := io.ReadAll(conn)
+		received <- string(input)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	resp := types.NewHijackedResponse(conn, "")
+
+	keys, err := term.ToBytes("ctrl-p,ctrl-q")
+	require.NoError(t, err)
+	stdin := term.NewEscapeProxy(strings.NewReader("ls\n\x10\x11exit\n"), keys)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = streamHijacked(ctx, resp, true, stdin, io.Discard, io.Discard)
+	assert.ErrorIs(t, err, ErrDetached)
+
+	select {
+	case input := <-received:
+		assert.Equal(t, "ls\n", input, "the detach sequence and later input must not reach the container")
+	case <-ctx.Done():
+		t.Fatal("connection was not closed after detaching")
+	}
+}
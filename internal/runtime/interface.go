@@ -3,9 +3,27 @@ package runtime
 import (
 	"cderun/internal/container"
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+// ErrNetworkInUse is returned by RemoveNetwork when containers are still attached to the network.
+var ErrNetworkInUse = errors.New("network is in use")
+
+// ErrContainerNotFound is returned by InspectContainer when the container does not exist.
+var ErrContainerNotFound = errors.New("container not found")
+
+// ErrCommandNotFound is returned by StartContainer when the command does not exist in the image.
+var ErrCommandNotFound = errors.New("command not found")
+
+// ErrCommandNotExecutable is returned by StartContainer when the command cannot be executed.
+var ErrCommandNotExecutable = errors.New("command not executable")
+
+// ErrDetached is returned by AttachContainer when the user typed the detach key sequence.
+// The container keeps running.
+var ErrDetached = errors.New("detached from container")
+
 // ContainerRuntime defines the interface for interacting with container runtimes.
 type ContainerRuntime interface {
 	// Container lifecycle
@@ -13,12 +31,91 @@ type ContainerRuntime interface {
 	StartContainer(ctx context.Context, containerID string) error
 	WaitContainer(ctx context.Context, containerID string) (int, error)
 	RemoveContainer(ctx context.Context, containerID string) error
+	StopContainer(ctx context.Context, containerID string, timeout time.Duration) error
+	RenameContainer(ctx context.Context, containerID string, name string) error
 
 	// Container communication
-	AttachContainer(ctx context.Context, containerID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error
+	AttachContainer(ctx context.Context, containerID string, opts AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error
 	ResizeContainerTTY(ctx context.Context, containerID string, rows, cols uint) error
 	SignalContainer(ctx context.Context, containerID string, sig string) error
+	ContainerLogs(ctx context.Context, containerID string, follow bool, stdout, stderr io.Writer) error
+
+	// Exec sessions in running containers
+	ExecContainer(ctx context.Context, containerID string, config *container.ExecConfig) (string, error)
+	AttachExec(ctx context.Context, execID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error
+	ResizeExecTTY(ctx context.Context, execID string, rows, cols uint) error
+	WaitExec(ctx context.Context, execID string) (int, error)
+
+	// Images
+	ImageExists(ctx context.Context, ref string) (bool, error)
+	BuildImage(ctx context.Context, spec *container.BuildSpec, tag string, output io.Writer) error
+
+	// Network management
+	NetworkExists(ctx context.Context, name string) (bool, error)
+	CreateNetwork(ctx context.Context, spec *container.NetworkSpec) error
+	RemoveNetwork(ctx context.Context, name string) error
 
 	// Information
+	InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error)
+	ListContainers(ctx context.Context, filter ContainerFilter) ([]ContainerInfo, error)
+	Info(ctx context.Context) (*RuntimeInfo, error)
 	Name() string
 }
+
+// RuntimeInfo describes the daemon behind a runtime.
+type RuntimeInfo struct {
+	ServerVersion string // e.g. "27.3.1"
+	APIVersion    string // API version negotiated with the daemon, e.g. "1.47"
+	OS            string
+	Arch          string
+	Rootless      bool
+}
+
+// ContainerInfo holds the runtime state of a container.
+type ContainerInfo struct {
+	ID        string
+	Name      string
+	Image     string
+	Created   time.Time
+	Running   bool
+	Status    string                  // e.g. "created", "running", "exited"
+	Health    string                  // "starting", "healthy", "unhealthy" or empty without healthcheck
+	ExitCode  int
+	OOMKilled bool
+	TTY       bool                    // Created with a TTY
+	OpenStdin bool                    // Created with stdin kept open
+	Labels    map[string]string
+	Ports     []container.PortMapping // Ports actually bound on the host
+}
+
+// AttachOptions configures AttachContainer.
+type AttachOptions struct {
+	TTY bool
+	// DetachKeys is the key sequence (e.g. "ctrl-p,ctrl-q") that detaches a TTY
+	// session, making AttachContainer return ErrDetached. Empty disables it.
+	DetachKeys string
+	// Logs replays the output written before attaching.
+	Logs bool
+}
+
+// ContainerFilter selects containers in ListContainers.
+type ContainerFilter struct {
+	// Labels that must be present. An empty value only requires the key.
+	Labels map[string]string
+	// All includes stopped containers.
+	All bool
+}
+
+// Matches reports whether info satisfies the filter.
+func (f ContainerFilter) Matches(info ContainerInfo) bool {
+	if !f.All && !info.Running {
+		return false
+	}
+	for k, v := range f.Labels {
+		actual, ok := info.Labels[k]
+		if !ok || (v != "" && actual != v) {
+			return false
+		}
+	}
+	return true
+}
@@ -39,3 +39,17 @@ func TestMockRuntime(t *testing.T) {
 
 	assert.Equal(t, "mock", mock.Name())
 }
+
+func TestContainerFilterMatches(t *testing.T) {
+	running := ContainerInfo{Running: true, Labels: map[string]string{"cderun.managed": "true", "cderun.tool": "node"}}
+	stopped := ContainerInfo{Labels: map[string]string{"cderun.managed": "true"}}
+
+	assert.True(t, ContainerFilter{}.Matches(running))
+	assert.False(t, ContainerFilter{}.Matches(stopped))
+	assert.True(t, ContainerFilter{All: true}.Matches(stopped))
+
+	assert.True(t, ContainerFilter{Labels: map[string]string{"cderun.managed": ""}}.Matches(running))
+	assert.True(t, ContainerFilter{Labels: map[string]string{"cderun.tool": "node"}}.Matches(running))
+	assert.False(t, ContainerFilter{Labels: map[string]string{"cderun.tool": "python"}}.Matches(running))
+	assert.False(t, ContainerFilter{All: true, Labels: map[string]string{"cderun.tool": ""}}.Matches(stopped))
+}
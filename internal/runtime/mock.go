@@ -4,6 +4,8 @@ import (
 	"cderun/internal/container"
 	"context"
 	"io"
+	"sync"
+	"time"
 )
 
 // MockRuntime is a mock implementation of ContainerRuntime for testing purposes.
@@ -26,10 +28,56 @@ type MockRuntime struct {
 	AttachErr          error
 	ResizeErr          error
 	SignalErr          error
+	InspectedContainerID string
+	InspectInfo          *ContainerInfo
+	InspectErr           error
+	Networks             map[string]bool
+	CreatedNetworks      []*container.NetworkSpec
+	RemovedNetworks      []string
+	NetworkErr           error
+	RemoveNetworkErr     error
+	CreatedConfigs       []*container.ContainerConfig
+	RemovedContainerIDs  []string
+	LogsContainerIDs     []string
+	LogsOutput           string
+	LogsErr              error
+	ExecID               string
+	ExecContainerID      string
+	ExecConfigs          []*container.ExecConfig
+	ExecErr              error
+	AttachedExecID       string
+	AttachExecErr        error
+	ResizedExecID        string
+	WaitedExecID         string
+	ExecExitCode         int
+	WaitExecErr          error
+	Containers           []ContainerInfo
+	ListFilter           ContainerFilter
+	ListErr              error
+	SignaledContainerIDs []string
+	Signals              []string
+	StoppedContainerIDs  []string
+	StopTimeout          time.Duration
+	StopErr              error
+	AttachOptions        AttachOptions
+	RenamedContainerID   string
+	RenamedName          string
+	RenameErr            error
+	Images               map[string]bool
+	ImageErr             error
+	BuiltSpecs           []*container.BuildSpec
+	BuiltTags            []string
+	BuildOutput          string
+	BuildErr             error
+	RuntimeInfo          *RuntimeInfo
+	InfoErr              error
+
+	logsMu sync.Mutex // Service logs are streamed concurrently
 }
 
 func (m *MockRuntime) CreateContainer(ctx context.Context, config *container.ContainerConfig) (string, error) {
 	m.CreatedConfig = config
+	m.CreatedConfigs = append(m.CreatedConfigs, config)
 	return m.CreatedContainerID, m.CreateErr
 }
 
@@ -45,11 +93,13 @@ func (m *MockRuntime) WaitContainer(ctx context.Context, containerID string) (in
 
 func (m *MockRuntime) RemoveContainer(ctx context.Context, containerID string) error {
 	m.RemovedContainerID = containerID
+	m.RemovedContainerIDs = append(m.RemovedContainerIDs, containerID)
 	return m.RemoveErr
 }
 
-func (m *MockRuntime) AttachContainer(ctx context.Context, containerID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+func (m *MockRuntime) AttachContainer(ctx context.Context, containerID string, opts AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
 	m.AttachedContainerID = containerID
+	m.AttachOptions = opts
 	return m.AttachErr
 }
 
@@ -60,12 +110,129 @@ func (m *MockRuntime) ResizeContainerTTY(ctx context.Context, containerID string
 	return m.ResizeErr
 }
 
+func (m *MockRuntime) StopContainer(ctx context.Context, containerID string, timeout time.Duration) error {
+	m.StoppedContainerIDs = append(m.StoppedContainerIDs, containerID)
+	m.StopTimeout = timeout
+	return m.StopErr
+}
+
+func (m *MockRuntime) RenameContainer(ctx context.Context, containerID string, name string) error {
+	m.RenamedContainerID = containerID
+	m.RenamedName = name
+	return m.RenameErr
+}
+
 func (m *MockRuntime) SignalContainer(ctx context.Context, containerID string, sig string) error {
 	m.SignaledContainerID = containerID
+	m.SignaledContainerIDs = append(m.SignaledContainerIDs, containerID)
+	m.Signals = append(m.Signals, sig)
 	m.Signal = sig
 	return m.SignalErr
 }
 
+func (m *MockRuntime) ContainerLogs(ctx context.Context, containerID string, follow bool, stdout, stderr io.Writer) error {
+	m.logsMu.Lock()
+	m.LogsContainerIDs = append(m.LogsContainerIDs, containerID)
+	m.logsMu.Unlock()
+	if m.LogsOutput != "" && stdout != nil {
+		_, _ = io.WriteString(stdout, m.LogsOutput)
+	}
+	return m.LogsErr
+}
+
+func (m *MockRuntime) ExecContainer(ctx context.Context, containerID string, config *container.ExecConfig) (string, error) {
+	m.ExecContainerID = containerID
+	m.ExecConfigs = append(m.ExecConfigs, config)
+	return m.ExecID, m.ExecErr
+}
+
+func (m *MockRuntime) AttachExec(ctx context.Context, execID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.AttachedExecID = execID
+	return m.AttachExecErr
+}
+
+func (m *MockRuntime) ResizeExecTTY(ctx context.Context, execID string, rows, cols uint) error {
+	m.ResizedExecID = execID
+	m.Rows = rows
+	m.Cols = cols
+	return m.ResizeErr
+}
+
+func (m *MockRuntime) WaitExec(ctx context.Context, execID string) (int, error) {
+	m.WaitedExecID = execID
+	return m.ExecExitCode, m.WaitExecErr
+}
+
+func (m *MockRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	return m.Images[ref], m.ImageErr
+}
+
+func (m *MockRuntime) BuildImage(ctx context.Context, spec *container.BuildSpec, tag string, output io.Writer) error {
+	m.BuiltSpecs = append(m.BuiltSpecs, spec)
+	m.BuiltTags = append(m.BuiltTags, tag)
+	if m.BuildOutput != "" && output != nil {
+		_, _ = io.WriteString(output, m.BuildOutput)
+	}
+	if m.BuildErr != nil {
+		return m.BuildErr
+	}
+	if m.Images == nil {
+		m.Images = make(map[string]bool)
+	}
+	m.Images[tag] = true
+	return nil
+}
+
+func (m *MockRuntime) NetworkExists(ctx context.Context, name string) (bool, error) {
+	return m.Networks[name], m.NetworkErr
+}
+
+func (m *MockRuntime) CreateNetwork(ctx context.Context, spec *container.NetworkSpec) error {
+	m.CreatedNetworks = append(m.CreatedNetworks, spec)
+	if m.Networks == nil {
+		m.Networks = make(map[string]bool)
+	}
+	m.Networks[spec.Name] = true
+	return m.NetworkErr
+}
+
+func (m *MockRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	m.RemovedNetworks = append(m.RemovedNetworks, name)
+	if m.RemoveNetworkErr == nil {
+		delete(m.Networks, name)
+	}
+	return m.RemoveNetworkErr
+}
+
+func (m *MockRuntime) InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error) {
+	m.InspectedContainerID = containerID
+	if m.InspectInfo != nil {
+		return m.InspectInfo, m.InspectErr
+	}
+	return &ContainerInfo{ID: containerID}, m.InspectErr
+}
+
+func (m *MockRuntime) ListContainers(ctx context.Context, filter ContainerFilter) ([]ContainerInfo, error) {
+	m.ListFilter = filter
+	var result []ContainerInfo
+	for _, c := range m.Containers {
+		if filter.Matches(c) {
+			result = append(result, c)
+		}
+	}
+	return result, m.ListErr
+}
+
+func (m *MockRuntime) Info(ctx context.Context) (*RuntimeInfo, error) {
+	if m.InfoErr != nil {
+		return nil, m.InfoErr
+	}
+	if m.RuntimeInfo == nil {
+		return &RuntimeInfo{ServerVersion: "mock", APIVersion: "1.47"}, nil
+	}
+	return m.RuntimeInfo, nil
+}
+
 func (m *MockRuntime) Name() string {
 	return "mock"
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 )
 
 // NewPodmanRuntime creates a new Podman runtime instance.
@@ -28,13 +29,58 @@ func (p *PodmanRuntime) WaitContainer(ctx context.Context, containerID string) (
 func (p *PodmanRuntime) RemoveContainer(ctx context.Context, containerID string) error {
 	return fmt.Errorf("podman runtime not implemented")
 }
-func (p *PodmanRuntime) AttachContainer(ctx context.Context, containerID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+func (p *PodmanRuntime) AttachContainer(ctx context.Context, containerID string, opts AttachOptions, stdin io.Reader, stdout, stderr io.Writer) error {
 	return fmt.Errorf("podman runtime not implemented")
 }
 func (p *PodmanRuntime) ResizeContainerTTY(ctx context.Context, containerID string, rows, cols uint) error {
 	return fmt.Errorf("podman runtime not implemented")
 }
+func (p *PodmanRuntime) StopContainer(ctx context.Context, containerID string, timeout time.Duration) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) RenameContainer(ctx context.Context, containerID string, name string) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
 func (p *PodmanRuntime) SignalContainer(ctx context.Context, containerID string, sig string) error {
 	return fmt.Errorf("podman runtime not implemented")
 }
+func (p *PodmanRuntime) ContainerLogs(ctx context.Context, containerID string, follow bool, stdout, stderr io.Writer) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) ExecContainer(ctx context.Context, containerID string, config *container.ExecConfig) (string, error) {
+	return "", fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) AttachExec(ctx context.Context, execID string, tty bool, stdin io.Reader, stdout, stderr io.Writer) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) ResizeExecTTY(ctx context.Context, execID string, rows, cols uint) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) WaitExec(ctx context.Context, execID string) (int, error) {
+	return 0, fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) NetworkExists(ctx context.Context, name string) (bool, error) {
+	return false, fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) CreateNetwork(ctx context.Context, spec *container.NetworkSpec) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	return false, fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) BuildImage(ctx context.Context, spec *container.BuildSpec, tag string, output io.Writer) error {
+	return fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error) {
+	return nil, fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) ListContainers(ctx context.Context, filter ContainerFilter) ([]ContainerInfo, error) {
+	return nil, fmt.Errorf("podman runtime not implemented")
+}
+func (p *PodmanRuntime) Info(ctx context.Context) (*RuntimeInfo, error) {
+	return nil, fmt.Errorf("podman runtime not implemented")
+}
 func (p *PodmanRuntime) Name() string { return "podman" }
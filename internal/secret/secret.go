@@ -0,0 +1,170 @@
+package secret
+
+import (
+	"cderun/internal/container"
+	"cderun/internal/logging"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+)
+
+// dirPrefix starts the names of the secrets directories, followed by the owner
+// passed to Materialize.
+const dirPrefix = "cderun-secrets-"
+
+var (
+	// For testing
+	lookupEnv    = os.LookupEnv
+	shellCommand = func(command string) *exec.Cmd {
+		if goruntime.GOOS == "windows" {
+			return exec.Command("cmd", "/C", command)
+		}
+		return exec.Command("sh", "-c", command)
+	}
+)
+
+// Materialize reads each secret from its source and writes the value into a
+// private temporary directory on the host, preferably on a tmpfs. It returns
+// read-only bind mounts for the written files and a cleanup function that
+// removes the directory. The owner identifies the calling process, so that
+// RemoveStale can clean up after it if it is killed; it must not contain "-".
+//
+// Secret values are never logged or stored in the ContainerConfig.
+func Materialize(secrets []container.SecretMount, owner string) ([]container.VolumeMount, func(), error) {
+	if len(secrets) == 0 {
+		return nil, func() {}, nil
+	}
+
+	base, tmpfs := baseDir()
+	if !tmpfs {
+		logging.Warn("secrets are written to %s, which is not a tmpfs; they stay on disk if cderun is killed. Set XDG_RUNTIME_DIR to a tmpfs directory", base)
+	}
+	dir, err := os.MkdirTemp(base, dirPrefix+owner+"-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to restrict secrets directory: %w", err)
+	}
+
+	var mounts []container.VolumeMount
+	for _, s := range secrets {
+		value, err := read(s)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to read secret %q: %w", s.Name, err)
+		}
+
+		hostPath := filepath.Join(dir, s.Name)
+		// The directory is private to the current user; the file itself must stay
+		// readable for non-root users inside the container.
+		if err := os.WriteFile(hostPath, value, 0444); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to write secret %q: %w", s.Name, err)
+		}
+
+		mounts = append(mounts, container.VolumeMount{
+			HostPath:      hostPath,
+			ContainerPath: s.ContainerPath,
+			ReadOnly:      true,
+		})
+	}
+	return mounts, cleanup, nil
+}
+
+func read(s container.SecretMount) ([]byte, error) {
+	switch s.SourceType {
+	case "file":
+		return os.ReadFile(expandHome(s.Source))
+	case "env":
+		value, ok := lookupEnv(s.Source)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", s.Source)
+		}
+		return []byte(value), nil
+	case "command":
+		cmd := shellCommand(s.Source)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("command failed: %w", err)
+		}
+		// Commands like `pass show` terminate their output with a newline. Only
+		// one is removed, so values like PEM keys keep their own line breaks.
+		value := strings.TrimSuffix(string(out), "\n")
+		return []byte(strings.TrimSuffix(value, "\r")), nil
+	default:
+		return nil, fmt.Errorf("unsupported secret source %q", s.SourceType)
+	}
+}
+
+// candidateDirs returns the directories secrets may be written to, in order of
+// preference: XDG_RUNTIME_DIR, a per-user tmpfs on most Linux systems, then
+// /dev/shm and the OS temporary directory.
+func candidateDirs() []string {
+	var dirs []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if goruntime.GOOS == "linux" {
+		dirs = append(dirs, "/dev/shm")
+	}
+	return append(dirs, os.TempDir())
+}
+
+// baseDir returns the first candidate directory on a tmpfs, so secrets never
+// reach the disk, or the OS temporary directory if there is none. The second
+// result reports whether the directory is on a tmpfs.
+func baseDir() (string, bool) {
+	for _, dir := range candidateDirs() {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() && isTmpfs(dir) {
+			return dir, true
+		}
+	}
+	return os.TempDir(), false
+}
+
+// RemoveStale removes the secrets directories whose owner is gone, e.g. after
+// cderun was killed with SIGKILL. It returns the removed directories.
+func RemoveStale(ownerGone func(owner string) bool) ([]string, error) {
+	var removed []string
+	seen := map[string]bool{}
+	for _, base := range candidateDirs() {
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+		matches, err := filepath.Glob(filepath.Join(base, dirPrefix+"*"))
+		if err != nil {
+			return removed, err
+		}
+		for _, dir := range matches {
+			owner := strings.TrimPrefix(filepath.Base(dir), dirPrefix)
+			i := strings.LastIndex(owner, "-")
+			if i < 0 || !ownerGone(owner[:i]) {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				return removed, fmt.Errorf("failed to remove %s: %w", dir, err)
+			}
+			removed = append(removed, dir)
+		}
+	}
+	return removed, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
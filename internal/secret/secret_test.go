@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"cderun/internal/container"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterialize(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	t.Run("no secrets", func(t *testing.T) {
+		mounts, cleanup, err := Materialize(nil, "1.1")
+		require.NoError(t, err)
+		assert.Empty(t, mounts)
+		cleanup()
+	})
+
+	t.Run("reads file, env and command sources", func(t *testing.T) {
+		srcFile := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(srcFile, []byte("from-file"), 0600))
+		t.Setenv("CDERUN_TEST_SECRET", "from-env")
+
+		secrets := []container.SecretMount{
+			{Name: "file", SourceType: "file", Source: srcFile, ContainerPath: "/run/secrets/file"},
+			{Name: "env", SourceType: "env", Source: "CDERUN_TEST_SECRET", ContainerPath: "/run/secrets/env"},
+			{Name: "cmd", SourceType: "command", Source: "echo from-command", ContainerPath: "/etc/cmd"},
+			{Name: "pem", SourceType: "command", Source: `printf 'line1\nline2\n\n'`, ContainerPath: "/etc/pem"},
+			{Name: "crlf", SourceType: "command", Source: `printf 'value\r\n'`, ContainerPath: "/etc/crlf"},
+		}
+
+		mounts, cleanup, err := Materialize(secrets, "1.1")
+		require.NoError(t, err)
+		require.Len(t, mounts, 5)
+
+		// Only the final newline of a command's output is removed
+		expected := []string{"from-file", "from-env", "from-command", "line1\nline2\n", "value"}
+		for i, m := range mounts {
+			assert.True(t, m.ReadOnly)
+			assert.Equal(t, secrets[i].ContainerPath, m.ContainerPath)
+			data, err := os.ReadFile(m.HostPath)
+			require.NoError(t, err)
+			assert.Equal(t, expected[i], string(data))
+		}
+
+		dir := filepath.Dir(mounts[0].HostPath)
+		assert.Regexp(t, `^cderun-secrets-1\.1-\d+$`, filepath.Base(dir))
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+		cleanup()
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err), "secrets directory should be removed")
+	})
+
+	t.Run("missing env var is an error", func(t *testing.T) {
+		secrets := []container.SecretMount{
+			{Name: "missing", SourceType: "env", Source: "CDERUN_TEST_SECRET_MISSING"},
+		}
+		_, _, err := Materialize(secrets, "1.1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to read secret "missing"`)
+	})
+
+	t.Run("failing command is an error", func(t *testing.T) {
+		secrets := []container.SecretMount{
+			{Name: "broken", SourceType: "command", Source: "exit 3"},
+		}
+		_, _, err := Materialize(secrets, "1.1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "command failed")
+	})
+}
+
+func TestRemoveStale(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	secrets := []container.SecretMount{
+		{Name: "env", SourceType: "env", Source: "HOME", ContainerPath: "/run/secrets/env"},
+	}
+
+	gone, _, err := Materialize(secrets, "ns.100")
+	require.NoError(t, err)
+	alive, cleanup, err := Materialize(secrets, "ns.200")
+	require.NoError(t, err)
+	defer cleanup()
+
+	removed, err := RemoveStale(func(owner string) bool { return owner == "ns.100" })
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Dir(gone[0].HostPath)}, removed)
+	_, err = os.Stat(gone[0].HostPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(alive[0].HostPath)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package secret
+
+import "syscall"
+
+// Filesystem magic numbers of statfs(2) for memory-backed filesystems
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// isTmpfs reports whether dir is on a memory-backed filesystem.
+func isTmpfs(dir string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false
+	}
+	return st.Type == tmpfsMagic || st.Type == ramfsMagic
+}
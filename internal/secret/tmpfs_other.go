@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package secret
+
+// isTmpfs reports whether dir is on a memory-backed filesystem. Only Linux
+// is checked; elsewhere secrets are assumed to be on disk.
+func isTmpfs(dir string) bool {
+	return false
+}
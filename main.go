@@ -2,6 +2,7 @@ package main
 
 import (
 	"cderun/internal/command"
+	"errors"
 	"fmt"
 	"os"
 )
@@ -9,6 +10,10 @@ import (
 func main() {
 	if err := command.Execute(os.Args); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		var exitErr *command.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(1)
 	}
 }